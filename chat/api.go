@@ -0,0 +1,228 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/rag"
+	"github.com/a-h/ragmark/templates"
+)
+
+// maxRequestBytes is the maximum size of a JSON chat request body.
+const maxRequestBytes = 1024 * 1024
+
+func NewAPIHandler(h ResponseHandler) APIHandler {
+	return APIHandler{ResponseHandler: h}
+}
+
+// APIHandler answers chat messages posted as JSON to /api/chat. The conversation is sent
+// with each request, so nothing is stored.
+//
+// If stream is true, the response is a stream of server-sent events: a delta event with
+// each part of the answer, then a response event with the complete APIResponse.
+type APIHandler struct {
+	ResponseHandler
+}
+
+type APIMessage struct {
+	// Role is system, user or assistant.
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type APIRetrieval struct {
+	// NoContext answers the message without retrieving context.
+	NoContext bool `json:"no_context,omitempty"`
+	// Mode is vector, fts, hybrid or graph, defaults to the server's retrieval mode.
+	Mode string `json:"mode,omitempty"`
+	// Limit is the number of chunks to select, before surrounding context is added.
+	Limit int `json:"limit,omitempty"`
+	// MMRLambda overrides the server's diversification of the context, from 0 to 1, see
+	// rag.Options.MMRLambda.
+	MMRLambda *float64 `json:"mmr_lambda,omitempty"`
+	// Filter restricts the documents that context is retrieved from.
+	Filter APIFilter `json:"filter"`
+}
+
+// APIFilter restricts the documents that context is retrieved from, see rag.FilterArgs.
+type APIFilter struct {
+	Path            string `json:"path,omitempty"`
+	IncludeChildren bool   `json:"include_children,omitempty"`
+	PathPrefix      string `json:"path_prefix,omitempty"`
+	Type            string `json:"type,omitempty"`
+	// LastModFrom and LastModTo are dates, e.g. 2024-10-01, or RFC 3339 times.
+	LastModFrom string   `json:"last_mod_from,omitempty"`
+	LastModTo   string   `json:"last_mod_to,omitempty"`
+	RDFTypes    []string `json:"rdf_types,omitempty"`
+}
+
+type APIRequest struct {
+	// Messages of the conversation, oldest first. The last message is the question to answer.
+	Messages  []APIMessage `json:"messages"`
+	Retrieval APIRetrieval `json:"retrieval"`
+	Stream    bool         `json:"stream,omitempty"`
+}
+
+type APIResponse struct {
+	Answer  string                 `json:"answer"`
+	Sources []templates.ChatSource `json:"sources"`
+}
+
+type APIDelta struct {
+	Content string `json:"content"`
+}
+
+func (h APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req APIRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	history, msg, err := splitMessages(apiMessages(req.Messages))
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := h.retrievalOptions(req.Retrieval)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chatReq, c, err := h.prompt(r.Context(), history, msg, req.Retrieval.NoContext, opts)
+	if err != nil {
+		h.Log.Error("failed to get context", slog.Any("error", err))
+		http.Error(w, "failed to get context", http.StatusInternalServerError)
+		return
+	}
+	resp := APIResponse{Sources: nonNil(NewSources(h.Site, c.Sources))}
+
+	if !req.Stream {
+		if resp.Answer, err = h.chat.Chat(r.Context(), chatReq); err != nil {
+			h.Log.Error("failed to chat", slog.Any("error", err))
+			http.Error(w, "failed to chat", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	var answer strings.Builder
+	fn := func(content string) (err error) {
+		answer.WriteString(content)
+		return writeJSONEvent(w, "delta", APIDelta{Content: content})
+	}
+	if err = h.chat.ChatStream(r.Context(), chatReq, fn); err != nil {
+		// The status has already been sent, so the error is sent as an event.
+		h.Log.Error("failed to chat", slog.Any("error", err))
+		writeEvent(w, "error", "failed to chat")
+		return
+	}
+	resp.Answer = answer.String()
+	writeJSONEvent(w, "response", resp)
+	writeEvent(w, "end", "")
+}
+
+func (h APIHandler) retrievalOptions(r APIRetrieval) (opts rag.Options, err error) {
+	opts = h.Options
+	if r.Mode != "" {
+		if opts.Mode, err = rag.ParseMode(r.Mode); err != nil {
+			return opts, err
+		}
+	}
+	if r.Limit < 0 {
+		return opts, fmt.Errorf("the limit must not be negative")
+	}
+	if r.Limit > 0 {
+		opts.Limit = r.Limit
+	}
+	if r.MMRLambda != nil {
+		if *r.MMRLambda < 0 || *r.MMRLambda > 1 {
+			return opts, fmt.Errorf("mmr_lambda must be from 0 to 1")
+		}
+		opts.MMRLambda = *r.MMRLambda
+	}
+	opts.Filter, err = rag.ParseFilter(rag.FilterArgs{
+		Path:            r.Filter.Path,
+		IncludeChildren: r.Filter.IncludeChildren,
+		PathPrefix:      r.Filter.PathPrefix,
+		Type:            r.Filter.Type,
+		LastModFrom:     r.Filter.LastModFrom,
+		LastModTo:       r.Filter.LastModTo,
+		RDFTypes:        r.Filter.RDFTypes,
+	})
+	if err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+func apiMessages(messages []APIMessage) (result []llm.Message) {
+	result = make([]llm.Message, len(messages))
+	for i, m := range messages {
+		result[i] = llm.Message{Role: m.Role, Content: m.Content}
+	}
+	return result
+}
+
+// splitMessages returns the earlier messages of a conversation, and the latest message, which
+// must be from the user.
+func splitMessages(messages []llm.Message) (history []llm.Message, msg string, err error) {
+	if len(messages) == 0 {
+		return nil, "", errors.New("at least one message is required")
+	}
+	for i, m := range messages {
+		switch m.Role {
+		case llm.RoleSystem, llm.RoleUser, llm.RoleAssistant:
+		default:
+			return nil, "", fmt.Errorf("message %d: unknown role %q, expected system, user or assistant", i+1, m.Role)
+		}
+	}
+	last := messages[len(messages)-1]
+	if last.Role != llm.RoleUser {
+		return nil, "", errors.New("the last message must be from the user")
+	}
+	if strings.TrimSpace(last.Content) == "" {
+		return nil, "", errors.New("the last message must not be empty")
+	}
+	return messages[:len(messages)-1], last.Content, nil
+}
+
+// nonNil returns an empty slice instead of nil, so that it's encoded as an empty JSON array.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeJSONEvent(w http.ResponseWriter, eventName string, v any) (err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeEvent(w, eventName, string(data))
+}
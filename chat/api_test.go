@@ -0,0 +1,228 @@
+package chat_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/chat"
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/a-h/ragmark/templates"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestResponseHandler(t *testing.T, respond func(req llm.ChatRequest) (string, error)) chat.ResponseHandler {
+	t.Helper()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	q := querier{
+		nearest: []db.ChunkSelectNearestResult{
+			{Chunk: db.Chunk{Path: "/combat-vehicles/warrior", Heading: "Warrior", Text: "The Warrior is a tracked armoured vehicle."}, Distance: 0.25},
+		},
+	}
+	model := fake.New()
+	model.Respond = respond
+	r := rag.New(log, q, model, "embed")
+	return chat.NewResponseHandler(log, nil, q, r, rag.DefaultOptions(), model, "test-model")
+}
+
+func post(h http.Handler, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	return w
+}
+
+// events returns the data of each server-sent event, by event name.
+func events(t *testing.T, body string) (names []string, data []string) {
+	t.Helper()
+	var name string
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		case line == "":
+			names = append(names, name)
+			data = append(data, strings.Join(lines, "\n"))
+			name, lines = "", nil
+		}
+	}
+	return names, data
+}
+
+var warriorSource = templates.ChatSource{
+	Number:   1,
+	Title:    "/combat-vehicles/warrior",
+	URL:      "/combat-vehicles/warrior",
+	Heading:  "Warrior",
+	Distance: 0.25,
+}
+
+func TestAPIHandler(t *testing.T) {
+	var requests []llm.ChatRequest
+	h := chat.NewAPIHandler(newTestResponseHandler(t, func(req llm.ChatRequest) (string, error) {
+		requests = append(requests, req)
+		return "BAE Systems makes it [1].", nil
+	}))
+
+	t.Run("the answer and sources are returned", func(t *testing.T) {
+		w := post(h, "/api/chat", `{"messages": [
+			{"role": "user", "content": "What is the Warrior?"},
+			{"role": "assistant", "content": "An armoured vehicle."},
+			{"role": "user", "content": "Who makes it?"}
+		]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var actual chat.APIResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := chat.APIResponse{Answer: "BAE Systems makes it [1].", Sources: []templates.ChatSource{warriorSource}}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("unexpected response (-want +got):\n%s", diff)
+		}
+		if messages := requests[len(requests)-1].Messages; len(messages) != 3 {
+			t.Errorf("expected the history to be sent, got %d messages", len(messages))
+		}
+	})
+	t.Run("no context is retrieved if no_context is set", func(t *testing.T) {
+		w := post(h, "/api/chat", `{"messages": [{"role": "user", "content": "Hello"}], "retrieval": {"no_context": true}}`)
+		var actual chat.APIResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(actual.Sources) != 0 {
+			t.Errorf("expected no sources, got %v", actual.Sources)
+		}
+	})
+	t.Run("streamed answers are sent as deltas", func(t *testing.T) {
+		w := post(h, "/api/chat", `{"messages": [{"role": "user", "content": "Who makes the Warrior?"}], "stream": true}`)
+		names, data := events(t, w.Body.String())
+		if diff := cmp.Diff([]string{"delta", "delta", "delta", "delta", "delta", "response", "end"}, names); diff != "" {
+			t.Fatalf("unexpected events (-want +got):\n%s", diff)
+		}
+		var answer string
+		for _, d := range data[:5] {
+			var delta chat.APIDelta
+			if err := json.Unmarshal([]byte(d), &delta); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			answer += delta.Content
+		}
+		var resp chat.APIResponse
+		if err := json.Unmarshal([]byte(data[5]), &resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if answer != resp.Answer || resp.Answer != "BAE Systems makes it [1]." {
+			t.Errorf("expected the deltas to make up the answer, got %q and %q", answer, resp.Answer)
+		}
+	})
+	t.Run("invalid requests are rejected", func(t *testing.T) {
+		for _, body := range []string{
+			`{`,
+			`{"messages": []}`,
+			`{"messages": [{"role": "assistant", "content": "Hello"}]}`,
+			`{"messages": [{"role": "robot", "content": "Hello"}, {"role": "user", "content": "Hello"}]}`,
+			`{"messages": [{"role": "user", "content": "Hello"}], "retrieval": {"mode": "psychic"}}`,
+			`{"messages": [{"role": "user", "content": "Hello"}], "retrieval": {"mmr_lambda": 2}}`,
+			`{"messages": [{"role": "user", "content": "Hello"}], "retrieval": {"filter": {"last_mod_from": "last tuesday"}}}`,
+		} {
+			if w := post(h, "/api/chat", body); w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", body, w.Code)
+			}
+		}
+	})
+}
+
+func TestCompletionsHandler(t *testing.T) {
+	h := chat.NewCompletionsHandler(newTestResponseHandler(t, func(req llm.ChatRequest) (string, error) {
+		if req.Messages[0].Role != llm.RoleSystem {
+			t.Errorf("expected the system message to be kept, got %v", req.Messages[0])
+		}
+		return "BAE Systems.", nil
+	}))
+	body := `{"model": "ragmark", "messages": [
+		{"role": "system", "content": "Be brief."},
+		{"role": "user", "content": [{"type": "text", "text": "Who makes the Warrior?"}]}
+	]}`
+
+	t.Run("completions are returned in the OpenAI format", func(t *testing.T) {
+		w := post(h, "/v1/chat/completions", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var actual struct {
+			Object  string `json:"object"`
+			Model   string `json:"model"`
+			Choices []struct {
+				Message struct {
+					Role    string `json:"role"`
+					Content string `json:"content"`
+				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Sources []templates.ChatSource `json:"sources"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if actual.Object != "chat.completion" || actual.Model != "test-model" {
+			t.Errorf("unexpected object %q or model %q", actual.Object, actual.Model)
+		}
+		if len(actual.Choices) != 1 || actual.Choices[0].Message.Content != "BAE Systems." || actual.Choices[0].FinishReason != "stop" {
+			t.Errorf("unexpected choices: %+v", actual.Choices)
+		}
+		if diff := cmp.Diff([]templates.ChatSource{warriorSource}, actual.Sources); diff != "" {
+			t.Errorf("unexpected sources (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("streamed completions end with DONE", func(t *testing.T) {
+		w := post(h, "/v1/chat/completions", strings.Replace(body, `"model"`, `"stream": true, "model"`, 1))
+		_, data := events(t, w.Body.String())
+		if len(data) < 2 || data[len(data)-1] != "[DONE]" {
+			t.Fatalf("expected the stream to end with [DONE], got %v", data)
+		}
+		var answer string
+		for _, d := range data[:len(data)-1] {
+			var chunk struct {
+				Object  string `json:"object"`
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			if err := json.Unmarshal([]byte(d), &chunk); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if chunk.Object != "chat.completion.chunk" {
+				t.Errorf("unexpected object %q", chunk.Object)
+			}
+			answer += chunk.Choices[0].Delta.Content
+		}
+		if answer != "BAE Systems." {
+			t.Errorf("expected the deltas to make up the answer, got %q", answer)
+		}
+	})
+	t.Run("errors are returned in the OpenAI format", func(t *testing.T) {
+		w := post(h, "/v1/chat/completions", `{"messages": []}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `"invalid_request_error"`) {
+			t.Errorf("expected an OpenAI error, got %s", w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package chat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+)
+
+// NewConversationID returns a random conversation ID.
+func NewConversationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var conversationIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// validConversationID returns true if the id is empty, or was created by NewConversationID.
+func validConversationID(id string) bool {
+	return id == "" || conversationIDPattern.MatchString(id)
+}
+
+// getHistory returns the messages of the conversation, or no messages if the id is empty.
+func getHistory(ctx context.Context, queries db.Querier, id string) (history []llm.Message, err error) {
+	if id == "" {
+		return nil, nil
+	}
+	messages, err := queries.ConversationMessageSelect(ctx, db.ConversationMessageSelectArgs{ConversationID: id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation history: %w", err)
+	}
+	history = make([]llm.Message, len(messages))
+	for i, msg := range messages {
+		history[i] = llm.Message{Role: msg.Role, Content: msg.Content}
+	}
+	return history, nil
+}
@@ -1,33 +1,91 @@
 package chat
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"log/slog"
 	"net/http"
 
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/rag"
 	"github.com/a-h/ragmark/site"
 	"github.com/a-h/ragmark/templates"
 	"github.com/a-h/templ"
 )
 
-func NewFormHandler(s *site.Site) FormHandler {
+func NewFormHandler(log *slog.Logger, s *site.Site, queries db.Querier, defaultMode rag.Mode) FormHandler {
 	return FormHandler{
-		Site: s,
+		Log:         log,
+		Site:        s,
+		DefaultMode: defaultMode,
+		queries:     queries,
 	}
 }
 
+// FormHandler renders the chat form, and the messages of the conversation, if any.
 type FormHandler struct {
+	Log  *slog.Logger
 	Site *site.Site
+	// DefaultMode is the retrieval mode selected when the form is first displayed.
+	DefaultMode rag.Mode
+	// DefaultMMRLambda is the diversification of the context when the form is first displayed,
+	// see rag.Options.MMRLambda.
+	DefaultMMRLambda float64
+	queries          db.Querier
 }
 
 func (h FormHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	left := templates.Left(h.Site)
-	noContext := r.FormValue("no-context") == "true"
-	prompt := r.FormValue("prompt")
-	middle := templates.ChatForm(prompt, noContext)
+	args := templates.ChatFormArgs{
+		Prompt:         r.FormValue("prompt"),
+		NoContext:      r.FormValue("no-context") == "true",
+		Mode:           h.DefaultMode,
+		MMRLambda:      h.DefaultMMRLambda,
+		ConversationID: r.FormValue("conversation"),
+	}
+	if m, err := rag.ParseMode(r.FormValue("mode")); err == nil {
+		args.Mode = m
+	}
+	if lambda, err := parseMMRLambda(r.FormValue("mmr-lambda")); err == nil {
+		args.MMRLambda = lambda
+	}
+	args.Filter = filterArgs(r.Form)
+	if !validConversationID(args.ConversationID) {
+		http.Error(w, "invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+	history, err := getHistory(r.Context(), h.queries, args.ConversationID)
+	if err != nil {
+		h.Log.Error("failed to get history", slog.String("conversation", args.ConversationID), slog.Any("error", err))
+		http.Error(w, "failed to get conversation", http.StatusInternalServerError)
+		return
+	}
+	if args.ConversationID == "" && args.Prompt != "" {
+		args.ConversationID = NewConversationID()
+	}
+	for _, msg := range history {
+		args.History = append(args.History, chatMessage(msg))
+	}
+	middle := templates.ChatForm(args)
 	right := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
 		return nil
 	})
 	templ.Handler(templates.Page(left, middle, right)).ServeHTTP(w, r)
 }
+
+// chatMessage converts the Markdown of an assistant's message to HTML.
+func chatMessage(msg llm.Message) (m templates.ChatMessage) {
+	m.Role = msg.Role
+	m.Content = msg.Content
+	if msg.Role != llm.RoleAssistant {
+		return m
+	}
+	var buf bytes.Buffer
+	if err := gm.Convert([]byte(msg.Content), &buf); err == nil {
+		m.HTML = buf.String()
+	}
+	return m
+}
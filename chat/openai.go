@@ -0,0 +1,236 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/templates"
+	"github.com/a-h/ragmark/tokens"
+)
+
+func NewCompletionsHandler(h ResponseHandler) CompletionsHandler {
+	return CompletionsHandler{
+		ResponseHandler: h,
+		now:             time.Now,
+	}
+}
+
+// CompletionsHandler implements the OpenAI chat completions API at /v1/chat/completions, so
+// that OpenAI clients can use ragmark as a model. Context is retrieved for the last message
+// using the server's retrieval options, and the sources are added to the response in a
+// sources field, which OpenAI clients ignore.
+type CompletionsHandler struct {
+	ResponseHandler
+	now func() time.Time
+}
+
+type openAIMessage struct {
+	Role    string        `json:"role"`
+	Content openAIContent `json:"content"`
+}
+
+// openAIContent is either a string, or an array of content parts, of which only the text
+// parts are used.
+type openAIContent string
+
+func (c *openAIContent) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(data, &s); err == nil {
+		*c = openAIContent(s)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err = json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of content parts")
+	}
+	for _, p := range parts {
+		if p.Type == "text" {
+			s += p.Text
+		}
+	}
+	*c = openAIContent(s)
+	return nil
+}
+
+type openAIRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type openAIResponseMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int                    `json:"index"`
+	Message      *openAIResponseMessage `json:"message,omitempty"`
+	Delta        *openAIResponseMessage `json:"delta,omitempty"`
+	FinishReason *string                `json:"finish_reason"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAIResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []openAIChoice         `json:"choices"`
+	Usage   *openAIUsage           `json:"usage,omitempty"`
+	Sources []templates.ChatSource `json:"sources,omitempty"`
+}
+
+type openAIError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func writeOpenAIError(w http.ResponseWriter, statusCode int, errorType, msg string) {
+	var e openAIError
+	e.Error.Message = msg
+	e.Error.Type = errorType
+	writeJSON(w, statusCode, e)
+}
+
+func (h CompletionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	var req openAIRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid request: "+err.Error())
+		return
+	}
+	messages := make([]llm.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = llm.Message{Role: m.Role, Content: string(m.Content)}
+	}
+	history, msg, err := splitMessages(messages)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	chatReq, c, err := h.prompt(r.Context(), history, msg, false, h.Options)
+	if err != nil {
+		h.Log.Error("failed to get context", slog.Any("error", err))
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "failed to get context")
+		return
+	}
+	resp := openAIResponse{
+		ID:      "chatcmpl-" + NewConversationID(),
+		Created: h.now().Unix(),
+		Model:   h.ChatModel,
+		Sources: NewSources(h.Site, c.Sources),
+	}
+	stop := "stop"
+
+	if !req.Stream {
+		answer, err := h.chat.Chat(r.Context(), chatReq)
+		if err != nil {
+			h.Log.Error("failed to chat", slog.Any("error", err))
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "failed to chat")
+			return
+		}
+		resp.Object = "chat.completion"
+		resp.Choices = []openAIChoice{{
+			Message:      &openAIResponseMessage{Role: llm.RoleAssistant, Content: answer},
+			FinishReason: &stop,
+		}}
+		var promptTokens int
+		for _, m := range chatReq.Messages {
+			promptTokens += tokens.Estimate(m.Content)
+		}
+		completionTokens := tokens.Estimate(answer)
+		resp.Usage = &openAIUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	resp.Object = "chat.completion.chunk"
+	sources := resp.Sources
+	resp.Sources = nil
+	role := llm.RoleAssistant
+	fn := func(content string) (err error) {
+		resp.Choices = []openAIChoice{{Delta: &openAIResponseMessage{Role: role, Content: content}}}
+		// The role is only sent with the first chunk.
+		role = ""
+		return writeData(w, resp)
+	}
+	if err = h.chat.ChatStream(r.Context(), chatReq, fn); err != nil {
+		// The status has already been sent, so the client sees an incomplete stream.
+		h.Log.Error("failed to chat", slog.Any("error", err))
+		return
+	}
+	resp.Choices = []openAIChoice{{Delta: &openAIResponseMessage{}, FinishReason: &stop}}
+	resp.Sources = sources
+	writeData(w, resp)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// writeData writes v as a server-sent event without an event name, as used by the OpenAI API.
+func writeData(w http.ResponseWriter, v any) (err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	if flusher, canFlush := w.(http.Flusher); canFlush {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func NewModelsHandler(chatModel string) ModelsHandler {
+	return ModelsHandler{ChatModel: chatModel}
+}
+
+// ModelsHandler lists the chat model at /v1/models, for OpenAI clients that require a model
+// to be selected.
+type ModelsHandler struct {
+	ChatModel string
+}
+
+type openAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type openAIModels struct {
+	Object string        `json:"object"`
+	Data   []openAIModel `json:"data"`
+}
+
+func (h ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAIModels{
+		Object: "list",
+		Data:   []openAIModel{{ID: h.ChatModel, Object: "model", OwnedBy: "ragmark"}},
+	})
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"net/http"
+
+	"github.com/a-h/ragmark/rag"
+	"github.com/a-h/ragmark/templates"
+	"github.com/a-h/templ"
+)
+
+func NewPageHandler(defaultMode rag.Mode) PageHandler {
+	return PageHandler{
+		DefaultMode: defaultMode,
+	}
+}
+
+// PageHandler renders a question asked in the chat panel of a page, and streams the response
+// from the ResponseHandler, with retrieval scoped to the page, and optionally its children.
+type PageHandler struct {
+	// DefaultMode is the retrieval mode used to answer questions.
+	DefaultMode rag.Mode
+	// DefaultMMRLambda is the diversification of the context, see rag.Options.MMRLambda.
+	DefaultMMRLambda float64
+}
+
+func (h PageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	args := templates.ChatFormArgs{
+		Prompt:         r.FormValue("prompt"),
+		Mode:           h.DefaultMode,
+		MMRLambda:      h.DefaultMMRLambda,
+		ConversationID: r.FormValue("conversation"),
+		Filter: rag.FilterArgs{
+			Path:            r.FormValue("path"),
+			IncludeChildren: r.FormValue("include-children") == "true",
+		},
+	}
+	if args.Prompt == "" || args.Filter.Path == "" {
+		http.Error(w, "prompt and path are required", http.StatusBadRequest)
+		return
+	}
+	if !validConversationID(args.ConversationID) {
+		http.Error(w, "invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+	if args.ConversationID == "" {
+		args.ConversationID = NewConversationID()
+	}
+	templ.Handler(templates.PageChatResponse(args)).ServeHTTP(w, r)
+}
@@ -0,0 +1,89 @@
+package chat_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/chat"
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/google/go-cmp/cmp"
+)
+
+var sseConnectPattern = regexp.MustCompile(`sse-connect="([^"]+)"`)
+
+func TestPageHandler(t *testing.T) {
+	h := chat.NewPageHandler(rag.ModeVector)
+
+	t.Run("a prompt and path are required", func(t *testing.T) {
+		for _, target := range []string{"/chat/page?path=/aircraft", "/chat/page?prompt=hello"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d", target, http.StatusBadRequest, w.Code)
+			}
+		}
+	})
+	t.Run("invalid conversation IDs are rejected", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/chat/page?prompt=hello&path=/aircraft&conversation=../x", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+	t.Run("the response is scoped to the page", func(t *testing.T) {
+		var filters []db.ChunkFilter
+		log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+		q := querier{
+			conversations: map[string][]db.ConversationMessage{},
+			nearest: []db.ChunkSelectNearestResult{
+				{Chunk: db.Chunk{Path: "/aircraft/apache", Heading: "Apache", Text: "The Apache is an attack helicopter."}, Distance: 0.25},
+			},
+			filters: &filters,
+		}
+		model := fake.New()
+		r := rag.New(log, q, model, "embed")
+		rh := chat.NewResponseHandler(log, nil, q, r, rag.DefaultOptions(), model, "test-model")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/chat/page?prompt=What+is+it%3F&path=/aircraft&include-children=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, `id="page-chat-conversation"`) || !strings.Contains(body, `hx-swap-oob="true"`) {
+			t.Errorf("expected the conversation ID of the panel to be updated, got %s", body)
+		}
+		m := sseConnectPattern.FindStringSubmatch(body)
+		if m == nil {
+			t.Fatalf("expected an SSE connection, got %s", body)
+		}
+		u, err := url.Parse(strings.ReplaceAll(m[1], "&amp;", "&"))
+		if err != nil {
+			t.Fatalf("failed to parse SSE URL: %v", err)
+		}
+		if u.Path != "/chat/response" {
+			t.Errorf("expected the response to be streamed from /chat/response, got %q", u.Path)
+		}
+		if u.Query().Get("conversation") == "" {
+			t.Error("expected a new conversation")
+		}
+
+		rw := httptest.NewRecorder()
+		rh.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, u.String(), nil))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rw.Code, rw.Body.String())
+		}
+		expected := []db.ChunkFilter{{Path: "/aircraft", IncludeChildren: true}}
+		if diff := cmp.Diff(expected, filters); diff != "" {
+			t.Errorf("unexpected filters (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -2,47 +2,95 @@ package chat
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
 	"github.com/a-h/ragmark/prompts"
 	"github.com/a-h/ragmark/rag"
-	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/a-h/ragmark/site"
+	"github.com/a-h/ragmark/templates"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 )
 
-func NewResponseHandler(log *slog.Logger, r *rag.RAG, oc *ollamaapi.Client, chatModel string) ResponseHandler {
+func NewResponseHandler(log *slog.Logger, s *site.Site, queries db.Querier, r *rag.RAG, opts rag.Options, chat llm.ChatCompleter, chatModel string) ResponseHandler {
 	return ResponseHandler{
-		Log:       log,
-		RAG:       r,
-		ChatModel: chatModel,
-		oc:        oc,
+		Log:           log,
+		Site:          s,
+		RAG:           r,
+		Options:       opts,
+		ChatModel:     chatModel,
+		HistoryTokens: 2000,
+		queries:       queries,
+		chat:          chat,
 	}
 }
 
 type ResponseHandlerRequest struct {
 	// The message to process.
 	Msg string
-	// The state of the conversation, in JSON format.
-	State string
+	// ConversationID is the conversation that the message continues. If empty, the message
+	// is answered without history, and isn't stored.
+	ConversationID string
 }
 
 var gm = goldmark.New(goldmark.WithExtensions(extension.Table))
 
 type ResponseHandler struct {
-	Log       *slog.Logger
-	RAG       *rag.RAG
+	Log *slog.Logger
+	// Site is used to find the title and URL of the sources of each answer.
+	Site *site.Site
+	RAG  *rag.RAG
+	// Options are the default retrieval options, the mode can be overridden by the request.
+	Options   rag.Options
 	ChatModel string
-	oc        *ollamaapi.Client
+	// HistoryTokens is the maximum number of tokens of earlier messages in the conversation
+	// to send with each message.
+	HistoryTokens int
+	// Rewriter rewrites follow-up messages as standalone search queries. If nil, the
+	// message is used to find context.
+	Rewriter *rag.QueryRewriter
+	queries  db.Querier
+	chat     llm.ChatCompleter
 }
 
 func (h ResponseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	prompt := r.URL.Query().Get("prompt")
+	req := ResponseHandlerRequest{
+		Msg:            r.URL.Query().Get("prompt"),
+		ConversationID: r.URL.Query().Get("conversation"),
+	}
+	if !validConversationID(req.ConversationID) {
+		http.Error(w, "invalid conversation ID", http.StatusBadRequest)
+		return
+	}
 	noContext := r.URL.Query().Get("no-context") == "true"
+	opts := h.Options
+	if mode := r.URL.Query().Get("mode"); mode != "" {
+		var err error
+		if opts.Mode, err = rag.ParseMode(mode); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if lambda := r.URL.Query().Get("mmr-lambda"); lambda != "" {
+		var err error
+		if opts.MMRLambda, err = parseMMRLambda(lambda); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var err error
+	if opts.Filter, err = rag.ParseFilter(filterArgs(r.URL.Query())); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	//TODO: Tighten up the CORS policy to not allow all origins.
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -51,34 +99,27 @@ func (h ResponseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	var chunks []db.Chunk
-	if !noContext {
-		var err error
-		chunks, err = h.RAG.GetContext(r.Context(), prompt)
-		if err != nil {
-			h.Log.Error("failed to get chunks", slog.Any("error", err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	history, err := getHistory(r.Context(), h.queries, req.ConversationID)
+	if err != nil {
+		h.Log.Error("failed to get history", slog.String("conversation", req.ConversationID), slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	req := &ollamaapi.ChatRequest{
-		Model: h.ChatModel,
-		Messages: []ollamaapi.Message{
-			{
-				Role:    "user",
-				Content: prompts.Chat(chunks, prompt),
-			},
-		},
+	chatReq, c, err := h.prompt(r.Context(), history, req.Msg, noContext, opts)
+	if err != nil {
+		h.Log.Error("failed to get chunks", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	response := new(strings.Builder)
 
 	buf := new(bytes.Buffer)
-	fn := func(resp ollamaapi.ChatResponse) (err error) {
+	fn := func(content string) (err error) {
 		buf.Reset()
 
-		response.WriteString(resp.Message.Content)
+		response.WriteString(content)
 
 		if gm.Convert([]byte(response.String()), buf); err != nil {
 			h.Log.Error("failed to convert markdown to HTML", slog.Any("error", err))
@@ -86,14 +127,95 @@ func (h ResponseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return writeEvent(w, "message", string(buf.Bytes()))
 	}
-	if err := h.oc.Chat(r.Context(), req, fn); err != nil {
+	if err := h.chat.ChatStream(r.Context(), chatReq, fn); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	buf.Reset()
+	if err = templates.ChatSources(NewSources(h.Site, c.Sources)).Render(r.Context(), buf); err != nil {
+		h.Log.Error("failed to render sources", slog.Any("error", err))
+	}
+	writeEvent(w, "sources", buf.String())
+	if req.ConversationID != "" {
+		// The message is stored without the retrieved context, which is found again for
+		// each message.
+		err = h.queries.ConversationMessageInsert(r.Context(), db.ConversationMessageInsertArgs{
+			ConversationID: req.ConversationID,
+			Messages: []db.ConversationMessage{
+				{Role: llm.RoleUser, Content: req.Msg},
+				{Role: llm.RoleAssistant, Content: response.String()},
+			},
+		})
+		if err != nil {
+			h.Log.Error("failed to store conversation", slog.String("conversation", req.ConversationID), slog.Any("error", err))
+		}
+	}
 	// Close the response.
 	writeEvent(w, "end", "")
 }
 
+// prompt retrieves context for the message, and returns the request to send to the model.
+// System messages in the history are kept, and the rest are limited to HistoryTokens.
+func (h ResponseHandler) prompt(ctx context.Context, history []llm.Message, msg string, noContext bool, opts rag.Options) (req llm.ChatRequest, c rag.Context, err error) {
+	var system, conversation []llm.Message
+	for _, m := range history {
+		if m.Role == llm.RoleSystem {
+			system = append(system, m)
+			continue
+		}
+		conversation = append(conversation, m)
+	}
+	conversation = prompts.History(conversation, h.HistoryTokens)
+
+	if !noContext {
+		query := msg
+		if h.Rewriter != nil {
+			if query, err = h.Rewriter.Rewrite(ctx, conversation, msg); err != nil {
+				h.Log.Warn("failed to rewrite query, using the message", slog.Any("error", err))
+			}
+		}
+		h.Log.Info("getting context", slog.String("message", msg), slog.String("query", query))
+		if c, err = h.RAG.GetContext(ctx, query, opts); err != nil {
+			return req, c, err
+		}
+	}
+
+	req.Model = h.ChatModel
+	req.Messages = append(system, conversation...)
+	req.Messages = append(req.Messages, llm.Message{
+		Role:    llm.RoleUser,
+		Content: prompts.Chat(prompts.ChatArgs{Chunks: c.Chunks, Facts: c.Facts, Message: msg}),
+	})
+	return req, c, nil
+}
+
+// filterArgs returns the filter fields of the chat form. RDF types are separated by commas.
+func filterArgs(values url.Values) (args rag.FilterArgs) {
+	args.Path = values.Get("path")
+	args.IncludeChildren = values.Get("include-children") == "true"
+	args.PathPrefix = values.Get("path-prefix")
+	args.Type = values.Get("type")
+	args.LastModFrom = values.Get("last-mod-from")
+	args.LastModTo = values.Get("last-mod-to")
+	for _, v := range values["rdf-type"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				args.RDFTypes = append(args.RDFTypes, t)
+			}
+		}
+	}
+	return args
+}
+
+// parseMMRLambda parses the diversification of the context, see rag.Options.MMRLambda.
+func parseMMRLambda(s string) (lambda float64, err error) {
+	lambda, err = strconv.ParseFloat(s, 64)
+	if err != nil || lambda < 0 || lambda > 1 {
+		return 0, fmt.Errorf("invalid MMR lambda %q, expected a number from 0 to 1", s)
+	}
+	return lambda, nil
+}
+
 func writeEvent(w http.ResponseWriter, eventName, data string) (err error) {
 	if strings.Contains(eventName, "\n") {
 		return fmt.Errorf("event name must not contain a newline")
@@ -0,0 +1,115 @@
+package chat_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/a-h/ragmark/chat"
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/a-h/ragmark/urlbuilder"
+	"github.com/google/go-cmp/cmp"
+)
+
+type querier struct {
+	db.Querier
+	conversations map[string][]db.ConversationMessage
+	nearest       []db.ChunkSelectNearestResult
+	// filters records the filter of each search, if set.
+	filters *[]db.ChunkFilter
+}
+
+func (q querier) ConversationMessageInsert(ctx context.Context, args db.ConversationMessageInsertArgs) error {
+	q.conversations[args.ConversationID] = append(q.conversations[args.ConversationID], args.Messages...)
+	return nil
+}
+
+func (q querier) ChunkSelectNearest(ctx context.Context, args db.ChunkSelectNearestArgs) ([]db.ChunkSelectNearestResult, error) {
+	if q.filters != nil {
+		*q.filters = append(*q.filters, args.Filter)
+	}
+	return q.nearest, nil
+}
+
+func (q querier) ChunkSelectRange(ctx context.Context, args db.ChunkSelectRangeArgs) (chunks []db.Chunk, err error) {
+	for _, n := range q.nearest {
+		if n.Path == args.Path && n.Index >= args.StartIndex && n.Index <= args.EndIndex {
+			chunks = append(chunks, n.Chunk)
+		}
+	}
+	return chunks, nil
+}
+
+func (q querier) ConversationMessageSelect(ctx context.Context, args db.ConversationMessageSelectArgs) ([]db.ConversationMessage, error) {
+	return q.conversations[args.ConversationID], nil
+}
+
+func TestResponseHandlerConversation(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	q := querier{conversations: map[string][]db.ConversationMessage{}}
+	var requests []llm.ChatRequest
+	model := fake.New()
+	model.Respond = func(req llm.ChatRequest) (string, error) {
+		requests = append(requests, req)
+		return "The Warrior is an armoured vehicle.", nil
+	}
+	h := chat.NewResponseHandler(log, nil, q, nil, rag.DefaultOptions(), model, "test")
+	id := chat.NewConversationID()
+
+	send := func(prompt, conversationID string) int {
+		w := httptest.NewRecorder()
+		target := urlbuilder.Path("/chat/response").Query("prompt", prompt).Query("no-context", "true").Query("conversation", conversationID).String()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+
+	t.Run("messages are stored in the conversation", func(t *testing.T) {
+		if code := send("What is the Warrior?", id); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		expected := []db.ConversationMessage{
+			{Role: llm.RoleUser, Content: "What is the Warrior?"},
+			{Role: llm.RoleAssistant, Content: "The Warrior is an armoured vehicle."},
+		}
+		if diff := cmp.Diff(expected, q.conversations[id]); diff != "" {
+			t.Errorf("unexpected messages (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("follow-up messages are sent with the history", func(t *testing.T) {
+		if code := send("Who makes it?", id); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		messages := requests[len(requests)-1].Messages
+		if len(messages) != 3 {
+			t.Fatalf("expected 3 messages, got %d", len(messages))
+		}
+		if diff := cmp.Diff(q.conversations[id][0].Content, messages[0].Content); diff != "" {
+			t.Errorf("unexpected first message (-want +got):\n%s", diff)
+		}
+		if len(q.conversations[id]) != 4 {
+			t.Errorf("expected 4 stored messages, got %d", len(q.conversations[id]))
+		}
+	})
+	t.Run("messages without a conversation are not stored", func(t *testing.T) {
+		if code := send("What is the Warrior?", ""); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		if len(requests[len(requests)-1].Messages) != 1 {
+			t.Errorf("expected no history to be sent")
+		}
+		if len(q.conversations[""]) != 0 {
+			t.Errorf("expected no messages to be stored")
+		}
+	})
+	t.Run("invalid conversation IDs are rejected", func(t *testing.T) {
+		if code := send("What is the Warrior?", "../other"); code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", code)
+		}
+	})
+}
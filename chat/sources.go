@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"strings"
+
+	"github.com/a-h/ragmark/rag"
+	"github.com/a-h/ragmark/site"
+	"github.com/a-h/ragmark/splitter"
+	"github.com/a-h/ragmark/templates"
+)
+
+// NewSources adds the title and URL of each source's page, and the anchor of its section.
+// If the site is nil, or doesn't contain the page, the path is used as the title.
+func NewSources(s *site.Site, sources []rag.Source) (result []templates.ChatSource) {
+	result = make([]templates.ChatSource, len(sources))
+	for i, src := range sources {
+		cs := templates.ChatSource{
+			Number:   src.Number,
+			Title:    src.Path,
+			URL:      src.Path,
+			Heading:  src.Heading,
+			Distance: src.Distance,
+		}
+		if s != nil {
+			if content, ok := s.GetContent(src.Path); ok {
+				cs.Title = content.Metadata().Title
+				if anchor := findAnchor(content.TOC(), src.Heading); anchor != "" {
+					cs.URL += anchor
+				}
+			}
+		}
+		result[i] = cs
+	}
+	return result
+}
+
+// findAnchor returns the URL of the heading in the table of contents, e.g. #linux. The heading
+// is a breadcrumb, e.g. "Install > Linux". If the breadcrumb doesn't match the table of
+// contents, the first heading with the same title as the last part of the breadcrumb is used.
+func findAnchor(toc []site.MenuItem, heading string) (anchor string) {
+	if heading == "" {
+		return ""
+	}
+	parts := strings.Split(heading, splitter.HeadingSeparator)
+	if anchor = findPath(toc, parts); anchor != "" {
+		return anchor
+	}
+	return findTitle(toc, parts[len(parts)-1])
+}
+
+func findPath(items []site.MenuItem, parts []string) string {
+	for _, item := range items {
+		if item.Title != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			return item.URL
+		}
+		if url := findPath(item.Children, parts[1:]); url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+func findTitle(items []site.MenuItem, title string) string {
+	for _, item := range items {
+		if item.Title == title {
+			return item.URL
+		}
+		if url := findTitle(item.Children, title); url != "" {
+			return url
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package chat_test
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/a-h/ragmark/chat"
+	"github.com/a-h/ragmark/rag"
+	"github.com/a-h/ragmark/site"
+	"github.com/a-h/ragmark/templates"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewSources(t *testing.T) {
+	dirFS := fstest.MapFS{
+		"apache.md": &fstest.MapFile{
+			Data: []byte("---\ntitle: Apache\n---\n# Apache\n\n## Armament\n\n### Missiles\n\n## Sensors\n\n### Missiles\n"),
+		},
+	}
+	s, err := site.New(site.SiteArgs{
+		Dir: dirFS,
+		ContentHandlers: []site.DirEntryHandler{
+			site.NewMarkdownDirEntryHandler(func(site *site.Site, page site.Metadata, toc []site.MenuItem, outputHTML string, err error) http.Handler {
+				return nil
+			}),
+			site.NewDirectoryDirEntryHandler(func(s *site.Site, dir site.Metadata, children []site.Metadata) http.Handler {
+				return nil
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sources := []rag.Source{
+		{Number: 1, Path: "/apache", Heading: "Apache > Sensors > Missiles", Distance: 0.1},
+		{Number: 2, Path: "/apache", Heading: "Apache > Armament"},
+		{Number: 3, Path: "/apache", Heading: "Missiles"},
+		{Number: 4, Path: "/apache"},
+		{Number: 5, Path: "/unknown", Heading: "Unknown"},
+	}
+	expected := []templates.ChatSource{
+		{Number: 1, Title: "Apache", URL: "/apache#missiles-1", Heading: "Apache > Sensors > Missiles", Distance: 0.1},
+		{Number: 2, Title: "Apache", URL: "/apache#armament", Heading: "Apache > Armament"},
+		{Number: 3, Title: "Apache", URL: "/apache#missiles", Heading: "Missiles"},
+		{Number: 4, Title: "Apache", URL: "/apache"},
+		{Number: 5, Title: "/unknown", URL: "/unknown", Heading: "Unknown"},
+	}
+	if diff := cmp.Diff(expected, chat.NewSources(s, sources)); diff != "" {
+		t.Errorf("unexpected sources (-want +got):\n%s", diff)
+	}
+}
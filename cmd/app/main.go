@@ -9,16 +9,28 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	ollamaapi "github.com/ollama/ollama/api"
 
 	"github.com/a-h/ragmark/chat"
+	"github.com/a-h/ragmark/config"
 	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/graph"
 	"github.com/a-h/ragmark/indexer"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/ollama"
+	"github.com/a-h/ragmark/llm/openai"
 	"github.com/a-h/ragmark/prompts"
 	"github.com/a-h/ragmark/rag"
+	"github.com/a-h/ragmark/rdf"
+	"github.com/a-h/ragmark/search"
 	"github.com/a-h/ragmark/site"
+	"github.com/a-h/ragmark/splitter"
 	"github.com/a-h/ragmark/templates"
+	"github.com/a-h/ragmark/tokens"
 	"github.com/a-h/templ"
 	"github.com/rqlite/gorqlite"
 )
@@ -37,9 +49,15 @@ Usage:
   strategy [command]
 
 Commands:
-  chat    Chat with the LLM server.
-  index   Populate the search database.
-	serve   Serve the website.
+  chat          Chat with the LLM server.
+  index         Populate the search database.
+  serve         Serve the website.
+  export-graph  Write the knowledge graph as N-Triples, Turtle or JSON-LD.
+  import-graph  Read N-Triples, Turtle or JSON-LD into the knowledge graph.
+
+Configuration is read from ragmark.toml (or the file set by -config or RAGMARK_CONFIG),
+then RAGMARK_* environment variables, then command line flags. Run a command with -help
+to see the available flags and environment variables.
 `
 
 func getLogger(level string) *slog.Logger {
@@ -72,151 +90,417 @@ func run(ctx context.Context) error {
 		return indexCmd(ctx)
 	case "serve":
 		return serve(ctx)
+	case "export-graph":
+		return exportGraphCmd(ctx)
+	case "import-graph":
+		return importGraphCmd(ctx)
 
 	default:
 		return fmt.Errorf("unknown command: %s", os.Args[1])
 	}
 }
 
-func chatCmd(ctx context.Context) (err error) {
-	chatFlags := flag.NewFlagSet("chat", flag.ExitOnError)
-	embeddingModel := chatFlags.String("embedding-model", "nomic-embed-text", "The model to chat with.")
-	model := chatFlags.String("chat-model", "mistral-nemo", "The model to chat with.")
-	msg := chatFlags.String("msg", "", "The message to send.")
-	nc := chatFlags.Bool("no-context", false, "Set to skip context retrieval and use the base model")
-	level := chatFlags.String("level", "warn", "The log level to use, set to info for additional logs")
-	if err = chatFlags.Parse(os.Args[2:]); err != nil {
-		return fmt.Errorf("failed to parse flags: %w", err)
+// loadConfig parses the command line flags, and loads the configuration.
+func loadConfig(flags *flag.FlagSet, defaultLevel string) (cfg config.Config, log *slog.Logger, err error) {
+	if err = flags.Parse(os.Args[2:]); err != nil {
+		return cfg, nil, fmt.Errorf("failed to parse flags: %w", err)
 	}
-	if *msg == "" {
-		return fmt.Errorf("no message specified")
+	cfg, err = config.Load(config.LoadArgs{
+		Flags: flags,
+	})
+	if err != nil {
+		return cfg, nil, err
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = defaultLevel
+	}
+	return cfg, getLogger(cfg.LogLevel), nil
+}
+
+func openDatabase(log *slog.Logger, cfg config.Database) (queries db.Querier, closer func(), err error) {
+	if cfg.Type == "sqlite" {
+		log.Info("opening database", slog.String("path", cfg.Path))
+		sqlDB, err := db.OpenSQLite(cfg.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Info("migrating database schema")
+		if err = db.MigrateSQLite(sqlDB); err != nil {
+			sqlDB.Close()
+			return nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+		return db.NewSQLite(sqlDB), func() { sqlDB.Close() }, nil
 	}
-	log := getLogger(*level)
 
 	databaseURL := db.URL{
-		User:     "admin",
-		Password: "secret",
-		Host:     "localhost",
-		Port:     4001,
-		Secure:   false,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Secure:   cfg.Secure,
 	}
 
-	log.Info("connecting to database")
+	log.Info("connecting to database", slog.String("host", cfg.Host), slog.Int("port", cfg.Port))
 	conn, err := gorqlite.Open(databaseURL.DataSourceName())
 	if err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+		return nil, nil, fmt.Errorf("failed to open connection: %w", err)
 	}
-	defer conn.Close()
-	queries := db.New(conn)
 
 	log.Info("migrating database schema")
 	if err = db.Migrate(databaseURL); err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return db.New(conn), conn.Close, nil
+}
+
+func chatCmd(ctx context.Context) (err error) {
+	chatFlags := flag.NewFlagSet("chat", flag.ExitOnError)
+	config.RegisterFlags(chatFlags)
+	msg := chatFlags.String("msg", "", "The message to send.")
+	nc := chatFlags.Bool("no-context", false, "Set to skip context retrieval and use the base model")
+	var filterArgs rag.FilterArgs
+	chatFlags.StringVar(&filterArgs.Path, "path", "", "Only retrieve context from the document with the path, e.g. /aircraft/apache.")
+	chatFlags.BoolVar(&filterArgs.IncludeChildren, "include-children", false, "Also retrieve context from the documents below -path.")
+	chatFlags.StringVar(&filterArgs.PathPrefix, "path-prefix", "", "Only retrieve context from documents whose path starts with the prefix, e.g. /aircraft/.")
+	chatFlags.StringVar(&filterArgs.Type, "type", "", "Only retrieve context from documents with the type in their metadata.")
+	chatFlags.StringVar(&filterArgs.LastModFrom, "last-mod-from", "", "Only retrieve context from documents last modified on or after the date, e.g. 2024-10-01.")
+	chatFlags.StringVar(&filterArgs.LastModTo, "last-mod-to", "", "Only retrieve context from documents last modified on or before the date.")
+	rdfTypes := chatFlags.String("rdf-type", "", "Only retrieve context from documents classified as one of the comma separated types, or their subclasses, e.g. ies:Aircraft.")
+	cfg, log, err := loadConfig(chatFlags, "warn")
+	if err != nil {
+		return err
+	}
+	if *msg == "" {
+		return fmt.Errorf("no message specified")
 	}
 
-	log.Info("creating LLM client")
-	ollamaURL, err := url.Parse("http://127.0.0.1:11434/")
+	queries, closeDB, err := openDatabase(log, cfg.Database)
 	if err != nil {
-		return fmt.Errorf("failed to parse LLM URL: %w", err)
+		return err
+	}
+	defer closeDB()
+
+	log.Info("creating LLM client", slog.String("provider", cfg.LLM.Provider))
+	oc, err := newLLMClient(cfg.LLM)
+	if err != nil {
+		return err
 	}
-	httpClient := &http.Client{}
-	oc := ollamaapi.NewClient(ollamaURL, httpClient)
 
 	log.Info("getting context")
-	r := rag.New(log, queries, oc, *embeddingModel)
-	var chunks []db.Chunk
+	opts, err := ragOptions(cfg)
+	if err != nil {
+		return err
+	}
+	if *rdfTypes != "" {
+		filterArgs.RDFTypes = strings.Split(*rdfTypes, ",")
+	}
+	if opts.Filter, err = rag.ParseFilter(filterArgs); err != nil {
+		return err
+	}
+	r := rag.New(log, queries, oc, cfg.LLM.EmbeddingModel)
+	r.ContextWindow = cfg.RAG.ContextWindow
+	if r.Reranker, err = rag.NewReranker(log, cfg.RAG.Reranker, oc, cfg.LLM.ChatModel); err != nil {
+		return err
+	}
+	var c rag.Context
 	if !*nc {
-		chunks, err = r.GetContext(ctx, *msg)
+		c, err = r.GetContext(ctx, *msg, opts)
 		if err != nil {
 			return err
 		}
 	}
 
-	prompt := prompts.Chat(chunks, *msg)
-	log.Info("starting chat", slog.String("prompt", prompt), slog.Int("kb", len(prompt)/1024))
+	prompt := prompts.Chat(prompts.ChatArgs{Chunks: c.Chunks, Facts: c.Facts, Message: *msg})
+	log.Info("starting chat", slog.String("prompt", prompt), slog.Int("kb", len(prompt)/1024), slog.Int("tokens", tokens.Estimate(prompt)))
 
-	req := &ollamaapi.ChatRequest{
-		Model: *model,
-		Messages: []ollamaapi.Message{
+	req := llm.ChatRequest{
+		Model: cfg.LLM.ChatModel,
+		Messages: []llm.Message{
 			{
-				Role:    "user",
+				Role:    llm.RoleUser,
 				Content: prompt,
 			},
 		},
 	}
-	fn := func(resp ollamaapi.ChatResponse) (err error) {
-		os.Stdout.WriteString(resp.Message.Content)
+	fn := func(content string) (err error) {
+		os.Stdout.WriteString(content)
+		return nil
+	}
+	if err = oc.ChatStream(ctx, req, fn); err != nil {
+		return err
+	}
+	if len(c.Sources) == 0 {
+		fmt.Println()
 		return nil
 	}
-	return oc.Chat(ctx, req, fn)
+	// The site is only used for the titles and URLs of the sources.
+	s, err := newSite(log, cfg.Site)
+	if err != nil {
+		log.Warn("failed to load site, sources will use document paths", slog.Any("error", err))
+		s = nil
+	}
+	fmt.Print("\n\nSources:\n")
+	for _, src := range chat.NewSources(s, c.Sources) {
+		fmt.Printf("[%d] %s", src.Number, src.Title)
+		if src.Heading != "" {
+			fmt.Printf(", %s", src.Heading)
+		}
+		fmt.Printf(": %s", src.URL)
+		if src.Distance != 0 {
+			fmt.Printf(" (distance %.3f)", src.Distance)
+		}
+		fmt.Println()
+	}
+	return nil
 }
 
 func indexCmd(ctx context.Context) (err error) {
 	flags := flag.NewFlagSet("index", flag.ExitOnError)
-	embeddingModel := flags.String("embedding-model", "nomic-embed-text", "The model to use for embeddings.")
-	chatModel := flags.String("chat-model", "mistral-nemo", "The model to chat with.")
-	level := flags.String("level", "info", "The log level to use, set to info for additional logs")
-	baseURL := flags.String("base-url", "/", "The base URL of the site")
-	title := flags.String("title", "ragmark site", "Title of site")
-	if err = flags.Parse(os.Args[2:]); err != nil {
-		return fmt.Errorf("failed to parse flags: %w", err)
+	config.RegisterFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "Print the documents that would be removed from the index, without changing it.")
+	force := flags.Bool("force", false, "Index all documents, including documents that haven't changed since they were last indexed.")
+	cfg, log, err := loadConfig(flags, "info")
+	if err != nil {
+		return err
 	}
-	log := getLogger(*level)
 
-	databaseURL := db.URL{
-		User:     "admin",
-		Password: "secret",
-		Host:     "localhost",
-		Port:     4001,
-		Secure:   false,
+	queries, closeDB, err := openDatabase(log, cfg.Database)
+	if err != nil {
+		return err
 	}
+	defer closeDB()
 
-	log.Info("connecting to database")
-	conn, err := gorqlite.Open(databaseURL.DataSourceName())
+	log.Info("creating LLM client", slog.String("provider", cfg.LLM.Provider))
+	oc, err := newLLMClient(cfg.LLM)
 	if err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+		return err
 	}
-	defer conn.Close()
-	queries := db.New(conn)
 
-	log.Info("migrating database schema")
-	if err = db.Migrate(databaseURL); err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+	log.Info("creating site walker")
+	site, err := newSite(log, cfg.Site)
+	if err != nil {
+		return fmt.Errorf("failed to create content walker: %w", err)
+	}
+
+	idx := indexer.New(log, queries, oc, oc, cfg.LLM.EmbeddingModel, cfg.LLM.ChatModel)
+	idx.Splitter = splitterOptions(cfg.Index)
+	idx.Force = *force
+	idx.Concurrency = cfg.Index.Concurrency
+	idx.EmbedBatchSize = cfg.Index.EmbedBatchSize
+	idx.MaxRetries = cfg.Index.MaxRetries
+	idx.ExtractRelationships = cfg.Index.ExtractRelationships
+
+	orphans, err := idx.Reconcile(ctx, site, *dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to remove deleted content from the index: %w", err)
+	}
+	if *dryRun {
+		for _, path := range orphans {
+			fmt.Printf("would remove %s\n", path)
+		}
+		return nil
+	}
+	stats, err := idx.Index(ctx, site)
+	if err != nil {
+		return err
 	}
+	fmt.Printf("indexed %d of %d documents (%d skipped), embedded %d chunks in %v\n",
+		stats.Indexed, stats.Documents, stats.Skipped, stats.Chunks, stats.Duration.Round(time.Millisecond))
+	return nil
+}
 
-	log.Info("creating LLM client")
-	ollamaURL, err := url.Parse("http://127.0.0.1:11434/")
+// graphFlags registers the flags shared by export-graph and import-graph.
+func graphFlags(flags *flag.FlagSet, fileUsage string) (format, file, baseIRI *string) {
+	format = flags.String("format", "", "The RDF format: ntriples, turtle or jsonld. Defaults to the format of the file extension, or turtle.")
+	file = flags.String("file", "", fileUsage)
+	baseIRI = flags.String("base-iri", "", "The IRI that document paths and entity names are relative to. Defaults to the server address, e.g. http://localhost:1414/.")
+	return format, file, baseIRI
+}
+
+// graphMapping returns the format and mapping used to convert the triple store to and from RDF.
+func graphMapping(cfg config.Config, format, file, baseIRI string) (f rdf.Format, m rdf.Mapping, err error) {
+	f = rdf.FormatTurtle
+	if format == "" && filepath.Ext(file) != "" {
+		format = filepath.Ext(file)
+	}
+	if format != "" {
+		if f, err = rdf.ParseFormat(format); err != nil {
+			return f, m, err
+		}
+	}
+	if baseIRI == "" {
+		addr := cfg.Server.Addr
+		if strings.HasPrefix(addr, ":") {
+			addr = "localhost" + addr
+		}
+		baseIRI = "http://" + addr + "/"
+	}
+	m, err = rdf.NewMapping(baseIRI)
+	return f, m, err
+}
+
+func exportGraphCmd(ctx context.Context) (err error) {
+	flags := flag.NewFlagSet("export-graph", flag.ExitOnError)
+	config.RegisterFlags(flags)
+	format, file, baseIRI := graphFlags(flags, "The file to write to. Defaults to stdout.")
+	cfg, log, err := loadConfig(flags, "warn")
+	if err != nil {
+		return err
+	}
+	f, m, err := graphMapping(cfg, *format, *file, *baseIRI)
 	if err != nil {
-		return fmt.Errorf("failed to parse LLM URL: %w", err)
+		return err
 	}
+
+	queries, closeDB, err := openDatabase(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	triples, err := queries.TripleSelectAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get triples: %w", err)
+	}
+	log.Info("exporting graph", slog.Int("triples", len(triples)), slog.String("format", string(f)))
+
+	var w io.Writer = os.Stdout
+	if *file != "" {
+		out, err := os.Create(*file)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		defer out.Close()
+		w = out
+	}
+	if err = rdf.Write(w, f, m.Encode(triples)); err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+	return nil
+}
+
+func importGraphCmd(ctx context.Context) (err error) {
+	flags := flag.NewFlagSet("import-graph", flag.ExitOnError)
+	config.RegisterFlags(flags)
+	format, file, baseIRI := graphFlags(flags, "The file to read from. Defaults to stdin.")
+	cfg, log, err := loadConfig(flags, "info")
+	if err != nil {
+		return err
+	}
+	f, m, err := graphMapping(cfg, *format, *file, *baseIRI)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "" {
+		in, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		defer in.Close()
+		r = in
+	}
+	statements, err := rdf.Read(r, f)
+	if err != nil {
+		return fmt.Errorf("failed to read graph: %w", err)
+	}
+	triples, err := m.Decode(statements)
+	if err != nil {
+		return fmt.Errorf("failed to read graph: %w", err)
+	}
+
+	queries, closeDB, err := openDatabase(log, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	for _, triple := range triples {
+		if err = queries.TripleUpsert(ctx, triple); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("imported %d triples from %d statements\n", len(triples), len(statements))
+	return nil
+}
+
+func ragOptions(cfg config.Config) (opts rag.Options, err error) {
+	opts = rag.DefaultOptions()
+	if opts.Mode, err = rag.ParseMode(cfg.RAG.Mode); err != nil {
+		return opts, err
+	}
+	opts.VectorWeight = cfg.RAG.VectorWeight
+	opts.FTSWeight = cfg.RAG.FTSWeight
+	opts.GraphHops = cfg.RAG.GraphHops
+	opts.Limit = cfg.RAG.TopK
+	opts.Candidates = cfg.RAG.Candidates
+	opts.MMRLambda = cfg.RAG.MMRLambda
+	opts.MaxPerDocument = cfg.RAG.MaxPerDocument
+	opts.ContextTokens = cfg.Chat.ContextTokensFor(cfg.LLM.ChatModel)
+	return opts, nil
+}
+
+func splitterOptions(cfg config.Index) (opts splitter.Options) {
+	opts = splitter.DefaultOptions()
+	opts.MaxSize = cfg.MaxChunkSize
+	opts.Overlap = cfg.ChunkOverlap
+	if cfg.ChunkSizeUnit == "tokens" {
+		opts.Size = tokens.Estimate
+		opts.SizeUnit = "tokens"
+	}
+	return opts
+}
+
+type llmClient interface {
+	llm.Embedder
+	llm.ChatCompleter
+}
+
+func newLLMClient(cfg config.LLM) (c llmClient, err error) {
 	httpClient := &http.Client{}
-	oc := ollamaapi.NewClient(ollamaURL, httpClient)
+	baseURL := cfg.URL
+	switch cfg.Provider {
+	case "ollama":
+		if baseURL == "" {
+			baseURL = "http://127.0.0.1:11434/"
+		}
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse LLM URL: %w", err)
+		}
+		return ollama.New(ollamaapi.NewClient(u, httpClient)), nil
+	case "openai":
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		return openai.New(baseURL, cfg.APIKey, httpClient), nil
+	}
+	return nil, fmt.Errorf("unknown LLM provider %q, expected ollama or openai", cfg.Provider)
+}
 
-	log.Info("creating site walker")
-	site, err := site.New(site.SiteArgs{
+func newSite(log *slog.Logger, cfg config.Site) (s *site.Site, err error) {
+	return site.New(site.SiteArgs{
 		Log:     log,
-		Dir:     os.DirFS("./content"),
-		BaseURL: *baseURL,
-		Title:   *title,
+		Dir:     os.DirFS(cfg.ContentDir),
+		BaseURL: cfg.BaseURL,
+		Title:   cfg.Title,
 		ContentHandlers: []site.DirEntryHandler{
 			dirHandler,
 			mdHandler,
 		},
 	})
-	if err != nil {
-		return fmt.Errorf("failed to create content walker: %w", err)
-	}
-
-	idx := indexer.New(log, queries, oc, *embeddingModel, *chatModel)
-	return idx.Index(ctx, site)
 }
 
 // Handle empty directories.
 var dirHandler = site.NewDirectoryDirEntryHandler(func(s *site.Site, dir site.Metadata, children []site.Metadata) http.Handler {
 	left := templates.Left(s)
 	middle := templates.Directory(dir, children)
-	right := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
-		return nil
+	right := templates.PageChat(templates.PageChatArgs{
+		Path:            dir.URL,
+		HasChildren:     len(children) > 0,
+		IncludeChildren: true,
 	})
 	return templ.Handler(templates.Page(left, middle, right))
 })
@@ -231,61 +515,34 @@ var mdHandler = site.NewMarkdownDirEntryHandler(func(s *site.Site, page site.Met
 	}
 	left := templates.Left(s)
 	middle := templ.Raw(outputHTML)
-	right := templates.Right(toc)
+	right := templates.Right(toc, templates.PageChatArgs{
+		Path:        page.URL,
+		HasChildren: s.HasChildren(page.URL),
+	})
 	return templ.Handler(templates.Page(left, middle, right))
 })
 
 func serve(ctx context.Context) (err error) {
 	flags := flag.NewFlagSet("serve", flag.ExitOnError)
-	embeddingModel := flags.String("embedding-model", "nomic-embed-text", "The model to chat with.")
-	chatModel := flags.String("chat-model", "mistral-nemo", "The model to chat with.")
-	level := flags.String("level", "info", "The log level to use, set to debug for additional logs")
-	baseURL := flags.String("base-url", "/", "The base URL of the site")
-	title := flags.String("title", "ragmark site", "Title of site")
-	if err = flags.Parse(os.Args[2:]); err != nil {
-		return fmt.Errorf("failed to parse flags: %w", err)
-	}
-	log := getLogger(*level)
-
-	databaseURL := db.URL{
-		User:     "admin",
-		Password: "secret",
-		Host:     "localhost",
-		Port:     4001,
-		Secure:   false,
-	}
-
-	log.Info("connecting to database")
-	conn, err := gorqlite.Open(databaseURL.DataSourceName())
+	config.RegisterFlags(flags)
+	cfg, log, err := loadConfig(flags, "info")
 	if err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+		return err
 	}
-	defer conn.Close()
-	queries := db.New(conn)
 
-	log.Info("migrating database schema")
-	if err = db.Migrate(databaseURL); err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+	queries, closeDB, err := openDatabase(log, cfg.Database)
+	if err != nil {
+		return err
 	}
+	defer closeDB()
 
-	log.Info("creating LLM client")
-	ollamaURL, err := url.Parse("http://127.0.0.1:11434/")
+	log.Info("creating LLM client", slog.String("provider", cfg.LLM.Provider))
+	oc, err := newLLMClient(cfg.LLM)
 	if err != nil {
-		return fmt.Errorf("failed to parse LLM URL: %w", err)
+		return err
 	}
-	httpClient := &http.Client{}
-	oc := ollamaapi.NewClient(ollamaURL, httpClient)
 
-	s, err := site.New(site.SiteArgs{
-		Log:     log,
-		Dir:     os.DirFS("./content"),
-		BaseURL: *baseURL,
-		Title:   *title,
-		ContentHandlers: []site.DirEntryHandler{
-			dirHandler,
-			mdHandler,
-		},
-	})
+	s, err := newSite(log, cfg.Site)
 	if err != nil {
 		return fmt.Errorf("failed to load site: %w", err)
 	}
@@ -299,16 +556,40 @@ func serve(ctx context.Context) (err error) {
 		log.Warn("no content to serve")
 	}
 
-	log.Info("starting server", slog.String("addr", ":1414"))
+	log.Info("starting server", slog.String("addr", cfg.Server.Addr))
 
 	mux := http.NewServeMux()
 	mux.Handle("/", s)
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(cfg.Site.StaticDir))))
 
-	mux.Handle("/chat", chat.NewFormHandler(s))
-	r := rag.New(log, queries, oc, *embeddingModel)
-	ch := chat.NewResponseHandler(log, r, oc, *chatModel)
+	mux.Handle("/search", search.NewHandler(log, s, queries))
+	mux.Handle("/graph", graph.NewIndexHandler(log, s, queries))
+	mux.Handle("/graph/entity", graph.NewEntityHandler(log, s, queries))
+	mux.Handle("/graph/query", graph.NewQueryHandler(log, queries))
+	opts, err := ragOptions(cfg)
+	if err != nil {
+		return err
+	}
+	fh := chat.NewFormHandler(log, s, queries, opts.Mode)
+	fh.DefaultMMRLambda = opts.MMRLambda
+	mux.Handle("/chat", fh)
+	ph := chat.NewPageHandler(opts.Mode)
+	ph.DefaultMMRLambda = opts.MMRLambda
+	mux.Handle("/chat/page", ph)
+	r := rag.New(log, queries, oc, cfg.LLM.EmbeddingModel)
+	r.ContextWindow = cfg.RAG.ContextWindow
+	if r.Reranker, err = rag.NewReranker(log, cfg.RAG.Reranker, oc, cfg.LLM.ChatModel); err != nil {
+		return err
+	}
+	ch := chat.NewResponseHandler(log, s, queries, r, opts, oc, cfg.LLM.ChatModel)
+	ch.HistoryTokens = cfg.Chat.HistoryTokens
+	if cfg.Chat.RewriteQuery {
+		ch.Rewriter = rag.NewQueryRewriter(log, oc, cfg.LLM.ChatModel)
+	}
 	mux.Handle("/chat/response", ch)
+	mux.Handle("/api/chat", chat.NewAPIHandler(ch))
+	mux.Handle("/v1/chat/completions", chat.NewCompletionsHandler(ch))
+	mux.Handle("/v1/models", chat.NewModelsHandler(cfg.LLM.ChatModel))
 
-	return http.ListenAndServe("localhost:1414", mux)
+	return http.ListenAndServe(cfg.Server.Addr, mux)
 }
@@ -0,0 +1,605 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the configuration shared by all of the app's commands.
+//
+// Values are loaded from (in increasing order of precedence) the defaults, a TOML file,
+// RAGMARK_* environment variables, and command line flags.
+type Config struct {
+	// LogLevel is one of debug, info, warn or error. If empty, the command's default is used.
+	LogLevel string   `toml:"log_level"`
+	Database Database `toml:"database"`
+	LLM      LLM      `toml:"llm"`
+	RAG      RAG      `toml:"rag"`
+	Chat     Chat     `toml:"chat"`
+	Index    Index    `toml:"index"`
+	Site     Site     `toml:"site"`
+	Server   Server   `toml:"server"`
+}
+
+type Database struct {
+	// Type is rqlite or sqlite.
+	Type string `toml:"type"`
+	// Path to the SQLite database file, used when Type is sqlite.
+	Path     string `toml:"path"`
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	User     string `toml:"user"`
+	Password string `toml:"password"`
+	Secure   bool   `toml:"secure"`
+}
+
+type LLM struct {
+	// Provider is ollama or openai.
+	Provider string `toml:"provider"`
+	// URL of the provider. If empty, the provider's default is used.
+	URL            string `toml:"url"`
+	APIKey         string `toml:"api_key"`
+	EmbeddingModel string `toml:"embedding_model"`
+	ChatModel      string `toml:"chat_model"`
+}
+
+type RAG struct {
+	// Mode is the default retrieval mode: vector, fts, hybrid or graph.
+	Mode string `toml:"mode"`
+	// VectorWeight and FTSWeight scale the vector and full-text search rankings in hybrid mode.
+	VectorWeight float64 `toml:"vector_weight"`
+	FTSWeight    float64 `toml:"fts_weight"`
+	// GraphHops is the number of relationships to follow from the entities in a message in graph mode.
+	GraphHops int `toml:"graph_hops"`
+	// ContextWindow is the maximum number of surrounding chunks to add either side of each
+	// chunk found by search, if they fit in chat.context_tokens.
+	ContextWindow int `toml:"context_window"`
+	// Reranker reorders the chunks found by search: none, lexical or model.
+	Reranker string `toml:"reranker"`
+	// Candidates is the number of chunks to find for the reranker to choose from.
+	Candidates int `toml:"candidates"`
+	// TopK is the number of chunks to keep after reranking, before surrounding chunks are added.
+	TopK int `toml:"top_k"`
+	// MMRLambda enables maximal marginal relevance selection of chunks, weighting relevance to
+	// the message against similarity to the chunks already selected, from 0 to 1. If zero,
+	// the most relevant chunks are selected.
+	MMRLambda float64 `toml:"mmr_lambda"`
+	// MaxPerDocument is the maximum number of chunks to select from each document, or zero
+	// for no limit.
+	MaxPerDocument int `toml:"max_per_document"`
+}
+
+type Chat struct {
+	// HistoryTokens is the maximum number of tokens of earlier messages in a conversation
+	// to send to the model with each message.
+	HistoryTokens int `toml:"history_tokens"`
+	// RewriteQuery enables rewriting follow-up messages as standalone search queries, using
+	// the chat model, before context is retrieved.
+	RewriteQuery bool `toml:"rewrite_query"`
+	// ContextTokens is the maximum number of tokens of retrieved context to add to each
+	// message, or zero for no limit.
+	ContextTokens int `toml:"context_tokens"`
+	// ModelContextTokens overrides ContextTokens for chat models with a different context
+	// length, by model name.
+	ModelContextTokens map[string]int `toml:"model_context_tokens"`
+}
+
+// ContextTokensFor returns the maximum number of tokens of retrieved context for the chat model.
+func (c Chat) ContextTokensFor(model string) int {
+	if n, ok := c.ModelContextTokens[model]; ok {
+		return n
+	}
+	return c.ContextTokens
+}
+
+type Index struct {
+	// MaxChunkSize is the maximum size of a chunk of a document, in ChunkSizeUnit.
+	MaxChunkSize int `toml:"max_chunk_size"`
+	// ChunkOverlap is the amount of text repeated from the end of the previous chunk, in ChunkSizeUnit.
+	ChunkOverlap int `toml:"chunk_overlap"`
+	// ChunkSizeUnit is characters or tokens.
+	ChunkSizeUnit string `toml:"chunk_size_unit"`
+	// Concurrency is the number of documents to index at the same time.
+	Concurrency int `toml:"concurrency"`
+	// EmbedBatchSize is the maximum number of chunks to send in each embedding request.
+	EmbedBatchSize int `toml:"embed_batch_size"`
+	// MaxRetries is the number of times to retry model requests that fail with a transient error.
+	MaxRetries int `toml:"max_retries"`
+	// ExtractRelationships enables extraction of relationships between the subjects of documents.
+	ExtractRelationships bool `toml:"extract_relationships"`
+}
+
+type Site struct {
+	ContentDir string `toml:"content_dir"`
+	StaticDir  string `toml:"static_dir"`
+	BaseURL    string `toml:"base_url"`
+	Title      string `toml:"title"`
+}
+
+type Server struct {
+	Addr string `toml:"addr"`
+}
+
+// Default returns the default configuration.
+func Default() Config {
+	return Config{
+		Database: Database{
+			Type:     "rqlite",
+			Host:     "localhost",
+			Port:     4001,
+			User:     "admin",
+			Password: "secret",
+		},
+		LLM: LLM{
+			Provider:       "ollama",
+			EmbeddingModel: "nomic-embed-text",
+			ChatModel:      "mistral-nemo",
+		},
+		RAG: RAG{
+			Mode:          "vector",
+			VectorWeight:  1,
+			FTSWeight:     1,
+			GraphHops:     2,
+			ContextWindow: 10,
+			Reranker:      "none",
+			Candidates:    20,
+			TopK:          10,
+		},
+		Chat: Chat{
+			HistoryTokens: 2000,
+			RewriteQuery:  true,
+			ContextTokens: 4000,
+		},
+		Index: Index{
+			MaxChunkSize:   1000,
+			ChunkOverlap:   100,
+			ChunkSizeUnit:  "characters",
+			Concurrency:    4,
+			EmbedBatchSize: 32,
+			MaxRetries:     3,
+		},
+		Site: Site{
+			ContentDir: "./content",
+			StaticDir:  "static",
+			BaseURL:    "/",
+			Title:      "ragmark site",
+		},
+		Server: Server{
+			Addr: "localhost:1414",
+		},
+	}
+}
+
+// field maps a configuration value to its environment variable and command line flag.
+type field struct {
+	// key is the TOML path of the field, e.g. database.host.
+	key    string
+	flag   string
+	usage  string
+	isBool bool
+	get    func(c *Config) string
+	set    func(c *Config, v string) error
+}
+
+// env returns the name of the environment variable for the field, e.g. RAGMARK_DATABASE_HOST.
+func (f field) env() string {
+	return "RAGMARK_" + strings.ToUpper(strings.ReplaceAll(f.key, ".", "_"))
+}
+
+func setString(p func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*p(c) = v
+		return nil
+	}
+}
+
+func setInt(p func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) (err error) {
+		*p(c), err = strconv.Atoi(v)
+		return err
+	}
+}
+
+func setFloat(p func(c *Config) *float64) func(c *Config, v string) error {
+	return func(c *Config, v string) (err error) {
+		*p(c), err = strconv.ParseFloat(v, 64)
+		return err
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// setIntMap parses a comma separated list of key=value pairs.
+func setIntMap(p func(c *Config) *map[string]int) func(c *Config, v string) error {
+	return func(c *Config, v string) (err error) {
+		m := map[string]int{}
+		for _, pair := range strings.Split(v, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			if m[strings.TrimSpace(key)], err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return err
+			}
+		}
+		*p(c) = m
+		return nil
+	}
+}
+
+func formatIntMap(m map[string]int) string {
+	pairs := make([]string, 0, len(m))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", k, m[k]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func setBool(p func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) (err error) {
+		*p(c), err = strconv.ParseBool(v)
+		return err
+	}
+}
+
+var fields = []field{
+	{key: "log_level", flag: "level", usage: "The log level to use: debug, info, warn or error.",
+		get: func(c *Config) string { return c.LogLevel },
+		set: setString(func(c *Config) *string { return &c.LogLevel })},
+	{key: "database.type", flag: "db-type", usage: "The database to use, rqlite or sqlite.",
+		get: func(c *Config) string { return c.Database.Type },
+		set: setString(func(c *Config) *string { return &c.Database.Type })},
+	{key: "database.path", flag: "db-path", usage: "The path to the SQLite database file.",
+		get: func(c *Config) string { return c.Database.Path },
+		set: setString(func(c *Config) *string { return &c.Database.Path })},
+	{key: "database.host", flag: "db-host", usage: "The rqlite host.",
+		get: func(c *Config) string { return c.Database.Host },
+		set: setString(func(c *Config) *string { return &c.Database.Host })},
+	{key: "database.port", flag: "db-port", usage: "The rqlite port.",
+		get: func(c *Config) string { return strconv.Itoa(c.Database.Port) },
+		set: setInt(func(c *Config) *int { return &c.Database.Port })},
+	{key: "database.user", flag: "db-user", usage: "The rqlite user.",
+		get: func(c *Config) string { return c.Database.User },
+		set: setString(func(c *Config) *string { return &c.Database.User })},
+	{key: "database.password", flag: "db-password", usage: "The rqlite password.",
+		get: func(c *Config) string { return c.Database.Password },
+		set: setString(func(c *Config) *string { return &c.Database.Password })},
+	{key: "database.secure", flag: "db-secure", usage: "Set to connect to rqlite using HTTPS.", isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(c.Database.Secure) },
+		set: setBool(func(c *Config) *bool { return &c.Database.Secure })},
+	{key: "llm.provider", flag: "llm-provider", usage: "The LLM provider to use, ollama or openai.",
+		get: func(c *Config) string { return c.LLM.Provider },
+		set: setString(func(c *Config) *string { return &c.LLM.Provider })},
+	{key: "llm.url", flag: "llm-url", usage: "The base URL of the LLM provider, defaults to the provider's standard address.",
+		get: func(c *Config) string { return c.LLM.URL },
+		set: setString(func(c *Config) *string { return &c.LLM.URL })},
+	{key: "llm.api_key", flag: "llm-api-key", usage: "The API key to use with the openai provider.",
+		get: func(c *Config) string { return "" },
+		set: setString(func(c *Config) *string { return &c.LLM.APIKey })},
+	{key: "llm.embedding_model", flag: "embedding-model", usage: "The model to use for embeddings.",
+		get: func(c *Config) string { return c.LLM.EmbeddingModel },
+		set: setString(func(c *Config) *string { return &c.LLM.EmbeddingModel })},
+	{key: "llm.chat_model", flag: "chat-model", usage: "The model to chat with.",
+		get: func(c *Config) string { return c.LLM.ChatModel },
+		set: setString(func(c *Config) *string { return &c.LLM.ChatModel })},
+	{key: "rag.mode", flag: "retrieval-mode", usage: "How to find context for chat messages: vector, fts, hybrid or graph.",
+		get: func(c *Config) string { return c.RAG.Mode },
+		set: setString(func(c *Config) *string { return &c.RAG.Mode })},
+	{key: "rag.vector_weight", flag: "vector-weight", usage: "The weight of vector search results in hybrid retrieval.",
+		get: func(c *Config) string { return formatFloat(c.RAG.VectorWeight) },
+		set: setFloat(func(c *Config) *float64 { return &c.RAG.VectorWeight })},
+	{key: "rag.fts_weight", flag: "fts-weight", usage: "The weight of full-text search results in hybrid retrieval.",
+		get: func(c *Config) string { return formatFloat(c.RAG.FTSWeight) },
+		set: setFloat(func(c *Config) *float64 { return &c.RAG.FTSWeight })},
+	{key: "rag.graph_hops", flag: "graph-hops", usage: "The number of relationships to follow from the entities in a message in graph retrieval: 1 or 2.",
+		get: func(c *Config) string { return strconv.Itoa(c.RAG.GraphHops) },
+		set: setInt(func(c *Config) *int { return &c.RAG.GraphHops })},
+	{key: "rag.context_window", flag: "context-window", usage: "The maximum number of surrounding chunks to add either side of each chunk found by search.",
+		get: func(c *Config) string { return strconv.Itoa(c.RAG.ContextWindow) },
+		set: setInt(func(c *Config) *int { return &c.RAG.ContextWindow })},
+	{key: "rag.reranker", flag: "reranker", usage: "How to rerank the chunks found by search: none, lexical or model.",
+		get: func(c *Config) string { return c.RAG.Reranker },
+		set: setString(func(c *Config) *string { return &c.RAG.Reranker })},
+	{key: "rag.candidates", flag: "rerank-candidates", usage: "The number of chunks to find for the reranker to choose from.",
+		get: func(c *Config) string { return strconv.Itoa(c.RAG.Candidates) },
+		set: setInt(func(c *Config) *int { return &c.RAG.Candidates })},
+	{key: "rag.top_k", flag: "top-k", usage: "The number of chunks to keep after reranking, before surrounding chunks are added.",
+		get: func(c *Config) string { return strconv.Itoa(c.RAG.TopK) },
+		set: setInt(func(c *Config) *int { return &c.RAG.TopK })},
+	{key: "rag.mmr_lambda", flag: "mmr-lambda", usage: "Set from 0 to 1 to select diverse chunks, weighting relevance against similarity to the chunks already selected. Zero disables diversification.",
+		get: func(c *Config) string { return formatFloat(c.RAG.MMRLambda) },
+		set: setFloat(func(c *Config) *float64 { return &c.RAG.MMRLambda })},
+	{key: "rag.max_per_document", flag: "max-per-document", usage: "The maximum number of chunks to select from each document, or zero for no limit.",
+		get: func(c *Config) string { return strconv.Itoa(c.RAG.MaxPerDocument) },
+		set: setInt(func(c *Config) *int { return &c.RAG.MaxPerDocument })},
+	{key: "chat.history_tokens", flag: "history-tokens", usage: "The maximum number of tokens of earlier messages in a conversation to send with each message.",
+		get: func(c *Config) string { return strconv.Itoa(c.Chat.HistoryTokens) },
+		set: setInt(func(c *Config) *int { return &c.Chat.HistoryTokens })},
+	{key: "chat.rewrite_query", flag: "rewrite-query", usage: "Set to rewrite follow-up messages as standalone search queries before retrieving context.", isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(c.Chat.RewriteQuery) },
+		set: setBool(func(c *Config) *bool { return &c.Chat.RewriteQuery })},
+	{key: "chat.context_tokens", flag: "context-tokens", usage: "The maximum number of tokens of retrieved context to add to each message, or zero for no limit.",
+		get: func(c *Config) string { return strconv.Itoa(c.Chat.ContextTokens) },
+		set: setInt(func(c *Config) *int { return &c.Chat.ContextTokens })},
+	{key: "chat.model_context_tokens", flag: "model-context-tokens", usage: "The maximum number of tokens of retrieved context for each chat model, e.g. mistral-nemo=8000,llama3.2=2000.",
+		get: func(c *Config) string { return formatIntMap(c.Chat.ModelContextTokens) },
+		set: setIntMap(func(c *Config) *map[string]int { return &c.Chat.ModelContextTokens })},
+	{key: "index.max_chunk_size", flag: "max-chunk-size", usage: "The maximum size of each chunk of a document.",
+		get: func(c *Config) string { return strconv.Itoa(c.Index.MaxChunkSize) },
+		set: setInt(func(c *Config) *int { return &c.Index.MaxChunkSize })},
+	{key: "index.chunk_overlap", flag: "chunk-overlap", usage: "The amount of text to repeat from the end of the previous chunk.",
+		get: func(c *Config) string { return strconv.Itoa(c.Index.ChunkOverlap) },
+		set: setInt(func(c *Config) *int { return &c.Index.ChunkOverlap })},
+	{key: "index.chunk_size_unit", flag: "chunk-size-unit", usage: "The unit of the chunk size and overlap: characters or tokens.",
+		get: func(c *Config) string { return c.Index.ChunkSizeUnit },
+		set: setString(func(c *Config) *string { return &c.Index.ChunkSizeUnit })},
+	{key: "index.concurrency", flag: "concurrency", usage: "The number of documents to index at the same time.",
+		get: func(c *Config) string { return strconv.Itoa(c.Index.Concurrency) },
+		set: setInt(func(c *Config) *int { return &c.Index.Concurrency })},
+	{key: "index.embed_batch_size", flag: "embed-batch-size", usage: "The maximum number of chunks to send in each embedding request.",
+		get: func(c *Config) string { return strconv.Itoa(c.Index.EmbedBatchSize) },
+		set: setInt(func(c *Config) *int { return &c.Index.EmbedBatchSize })},
+	{key: "index.max_retries", flag: "max-retries", usage: "The number of times to retry model requests that fail with a transient error.",
+		get: func(c *Config) string { return strconv.Itoa(c.Index.MaxRetries) },
+		set: setInt(func(c *Config) *int { return &c.Index.MaxRetries })},
+	{key: "index.extract_relationships", flag: "extract-relationships", usage: "Set to extract relationships from each document into the triple store.", isBool: true,
+		get: func(c *Config) string { return strconv.FormatBool(c.Index.ExtractRelationships) },
+		set: setBool(func(c *Config) *bool { return &c.Index.ExtractRelationships })},
+	{key: "site.content_dir", flag: "content-dir", usage: "The directory containing the site's markdown content.",
+		get: func(c *Config) string { return c.Site.ContentDir },
+		set: setString(func(c *Config) *string { return &c.Site.ContentDir })},
+	{key: "site.static_dir", flag: "static-dir", usage: "The directory containing static files to serve.",
+		get: func(c *Config) string { return c.Site.StaticDir },
+		set: setString(func(c *Config) *string { return &c.Site.StaticDir })},
+	{key: "site.base_url", flag: "base-url", usage: "The base URL of the site.",
+		get: func(c *Config) string { return c.Site.BaseURL },
+		set: setString(func(c *Config) *string { return &c.Site.BaseURL })},
+	{key: "site.title", flag: "title", usage: "Title of site.",
+		get: func(c *Config) string { return c.Site.Title },
+		set: setString(func(c *Config) *string { return &c.Site.Title })},
+	{key: "server.addr", flag: "addr", usage: "The address to listen on.",
+		get: func(c *Config) string { return c.Server.Addr },
+		set: setString(func(c *Config) *string { return &c.Server.Addr })},
+}
+
+// flagValue records the value of a command line flag, so that it can be applied
+// after the file and environment variables have been loaded.
+type flagValue struct {
+	field field
+	value string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.field.isBool
+}
+
+// RegisterFlags adds the configuration flags, and the -config flag, to the flag set.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.String("config", "", "Path to a TOML configuration file, defaults to ragmark.toml if it exists.")
+	defaults := Default()
+	for _, f := range fields {
+		fs.Var(&flagValue{field: f, value: f.get(&defaults)}, f.flag, fmt.Sprintf("%s (env %s)", f.usage, f.env()))
+	}
+}
+
+// DefaultPath is the configuration file that is loaded if no path is specified.
+const DefaultPath = "ragmark.toml"
+
+type LoadArgs struct {
+	// Path to the configuration file. If empty, the -config flag, RAGMARK_CONFIG environment
+	// variable, and DefaultPath are tried in turn.
+	Path string
+	// LookupEnv returns the value of an environment variable, defaults to os.LookupEnv.
+	LookupEnv func(key string) (value string, ok bool)
+	// Flags are the parsed command line flags. Only flags that were set are applied.
+	Flags *flag.FlagSet
+}
+
+// Load the configuration, and validate it.
+func Load(args LoadArgs) (c Config, err error) {
+	if args.LookupEnv == nil {
+		args.LookupEnv = os.LookupEnv
+	}
+	c = Default()
+
+	path, required := args.Path, args.Path != ""
+	if path == "" && args.Flags != nil {
+		if f := args.Flags.Lookup("config"); f != nil && f.Value.String() != "" {
+			path, required = f.Value.String(), true
+		}
+	}
+	if path == "" {
+		if v, ok := args.LookupEnv("RAGMARK_CONFIG"); ok && v != "" {
+			path, required = v, true
+		}
+	}
+	if path == "" {
+		path = DefaultPath
+	}
+	if err = loadFile(&c, path, required); err != nil {
+		return c, err
+	}
+
+	for _, f := range fields {
+		v, ok := args.LookupEnv(f.env())
+		if !ok {
+			continue
+		}
+		if err = f.set(&c, v); err != nil {
+			return c, fmt.Errorf("config: %s: invalid value %q in environment variable %s: %w", f.key, v, f.env(), err)
+		}
+	}
+
+	if args.Flags != nil {
+		args.Flags.Visit(func(ff *flag.Flag) {
+			fv, ok := ff.Value.(*flagValue)
+			if !ok || err != nil {
+				return
+			}
+			if setErr := fv.field.set(&c, fv.value); setErr != nil {
+				err = fmt.Errorf("config: %s: invalid value %q in flag -%s: %w", fv.field.key, fv.value, ff.Name, setErr)
+			}
+		})
+		if err != nil {
+			return c, err
+		}
+	}
+
+	return c, c.Validate()
+}
+
+func loadFile(c *Config, path string, required bool) (err error) {
+	if _, err = os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("config: failed to read file: %w", err)
+	}
+	md, err := toml.DecodeFile(path, c)
+	if err != nil {
+		return fmt.Errorf("config: failed to parse %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return fmt.Errorf("config: unknown fields in %s: %s", path, strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// Validate returns an error for each invalid field.
+func (c Config) Validate() (err error) {
+	var errs []error
+	invalid := func(key, format string, a ...any) {
+		errs = append(errs, fmt.Errorf("config: %s: %s", key, fmt.Sprintf(format, a...)))
+	}
+	if c.LogLevel != "" && !slices.Contains([]string{"debug", "info", "warn", "error"}, c.LogLevel) {
+		invalid("log_level", "must be one of debug, info, warn or error, got %q", c.LogLevel)
+	}
+	switch c.Database.Type {
+	case "rqlite":
+		if c.Database.Host == "" {
+			invalid("database.host", "must not be empty")
+		}
+		if c.Database.Port <= 0 || c.Database.Port > 65535 {
+			invalid("database.port", "must be between 1 and 65535, got %d", c.Database.Port)
+		}
+	case "sqlite":
+		if c.Database.Path == "" {
+			invalid("database.path", "must not be empty when database.type is sqlite")
+		}
+	default:
+		invalid("database.type", "must be rqlite or sqlite, got %q", c.Database.Type)
+	}
+	if !slices.Contains([]string{"ollama", "openai"}, c.LLM.Provider) {
+		invalid("llm.provider", "must be ollama or openai, got %q", c.LLM.Provider)
+	}
+	if c.LLM.URL != "" {
+		if u, err := url.Parse(c.LLM.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("llm.url", "must be an absolute URL, got %q", c.LLM.URL)
+		}
+	}
+	if c.LLM.EmbeddingModel == "" {
+		invalid("llm.embedding_model", "must not be empty")
+	}
+	if c.LLM.ChatModel == "" {
+		invalid("llm.chat_model", "must not be empty")
+	}
+	if !slices.Contains([]string{"vector", "fts", "hybrid", "graph"}, c.RAG.Mode) {
+		invalid("rag.mode", "must be vector, fts, hybrid or graph, got %q", c.RAG.Mode)
+	}
+	if c.RAG.VectorWeight < 0 {
+		invalid("rag.vector_weight", "must not be negative, got %v", c.RAG.VectorWeight)
+	}
+	if c.RAG.FTSWeight < 0 {
+		invalid("rag.fts_weight", "must not be negative, got %v", c.RAG.FTSWeight)
+	}
+	if c.RAG.ContextWindow < 0 {
+		invalid("rag.context_window", "must not be negative, got %d", c.RAG.ContextWindow)
+	}
+	if c.RAG.GraphHops < 1 || c.RAG.GraphHops > 2 {
+		invalid("rag.graph_hops", "must be 1 or 2, got %d", c.RAG.GraphHops)
+	}
+	if !slices.Contains([]string{"none", "lexical", "model"}, c.RAG.Reranker) {
+		invalid("rag.reranker", "must be none, lexical or model, got %q", c.RAG.Reranker)
+	}
+	if c.RAG.TopK <= 0 {
+		invalid("rag.top_k", "must be greater than zero, got %d", c.RAG.TopK)
+	}
+	if c.RAG.Candidates < c.RAG.TopK {
+		invalid("rag.candidates", "must be at least rag.top_k, got %d", c.RAG.Candidates)
+	}
+	if c.RAG.MMRLambda < 0 || c.RAG.MMRLambda > 1 {
+		invalid("rag.mmr_lambda", "must be between 0 and 1, got %v", c.RAG.MMRLambda)
+	}
+	if c.RAG.MaxPerDocument < 0 {
+		invalid("rag.max_per_document", "must not be negative, got %d", c.RAG.MaxPerDocument)
+	}
+	if c.Chat.HistoryTokens < 0 {
+		invalid("chat.history_tokens", "must not be negative, got %d", c.Chat.HistoryTokens)
+	}
+	if c.Chat.ContextTokens < 0 {
+		invalid("chat.context_tokens", "must not be negative, got %d", c.Chat.ContextTokens)
+	}
+	for _, model := range slices.Sorted(maps.Keys(c.Chat.ModelContextTokens)) {
+		if n := c.Chat.ModelContextTokens[model]; n < 0 {
+			invalid("chat.model_context_tokens", "must not be negative, got %d for %q", n, model)
+		}
+	}
+	if c.Index.MaxChunkSize <= 0 {
+		invalid("index.max_chunk_size", "must be greater than zero, got %d", c.Index.MaxChunkSize)
+	}
+	if c.Index.ChunkOverlap < 0 || c.Index.ChunkOverlap >= c.Index.MaxChunkSize {
+		invalid("index.chunk_overlap", "must be between zero and index.max_chunk_size, got %d", c.Index.ChunkOverlap)
+	}
+	if !slices.Contains([]string{"characters", "tokens"}, c.Index.ChunkSizeUnit) {
+		invalid("index.chunk_size_unit", "must be characters or tokens, got %q", c.Index.ChunkSizeUnit)
+	}
+	if c.Index.Concurrency <= 0 {
+		invalid("index.concurrency", "must be greater than zero, got %d", c.Index.Concurrency)
+	}
+	if c.Index.EmbedBatchSize <= 0 {
+		invalid("index.embed_batch_size", "must be greater than zero, got %d", c.Index.EmbedBatchSize)
+	}
+	if c.Index.MaxRetries < 0 {
+		invalid("index.max_retries", "must not be negative, got %d", c.Index.MaxRetries)
+	}
+	if c.Site.ContentDir == "" {
+		invalid("site.content_dir", "must not be empty")
+	}
+	if c.Site.StaticDir == "" {
+		invalid("site.static_dir", "must not be empty")
+	}
+	if c.Server.Addr == "" {
+		invalid("server.addr", "must not be empty")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,200 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ragmark.toml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func parseFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	return fs
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("a config file that was specified must exist", func(t *testing.T) {
+		_, err := config.Load(config.LoadArgs{
+			Path:      filepath.Join(t.TempDir(), "missing.toml"),
+			LookupEnv: env(nil),
+		})
+		if err == nil {
+			t.Fatal("expected error for missing config file")
+		}
+	})
+	t.Run("defaults are used if there is no config", func(t *testing.T) {
+		c, err := config.Load(config.LoadArgs{
+			LookupEnv: env(nil),
+			Flags:     parseFlags(t),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(config.Default(), c); diff != "" {
+			t.Errorf("unexpected config (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("file, environment and flags are applied in order of precedence", func(t *testing.T) {
+		path := writeFile(t, `
+log_level = "debug"
+
+[database]
+host = "file-host"
+port = 4002
+secure = true
+
+[llm]
+provider = "openai"
+url = "http://file:8000/v1"
+chat_model = "file-model"
+
+[rag]
+mode = "hybrid"
+fts_weight = 0.5
+
+[server]
+addr = ":8080"
+`)
+		c, err := config.Load(config.LoadArgs{
+			LookupEnv: env(map[string]string{
+				"RAGMARK_CONFIG":         path,
+				"RAGMARK_DATABASE_HOST":  "env-host",
+				"RAGMARK_LLM_CHAT_MODEL": "env-model",
+				"RAGMARK_LLM_API_KEY":    "secret-key",
+			}),
+			Flags: parseFlags(t, "-chat-model", "flag-model", "-db-port", "4003", "-vector-weight", "2"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := config.Default()
+		expected.LogLevel = "debug"
+		expected.Database.Host = "env-host"
+		expected.Database.Port = 4003
+		expected.Database.Secure = true
+		expected.LLM.Provider = "openai"
+		expected.LLM.URL = "http://file:8000/v1"
+		expected.LLM.APIKey = "secret-key"
+		expected.LLM.ChatModel = "flag-model"
+		expected.RAG.Mode = "hybrid"
+		expected.RAG.VectorWeight = 2
+		expected.RAG.FTSWeight = 0.5
+		expected.Server.Addr = ":8080"
+		if diff := cmp.Diff(expected, c); diff != "" {
+			t.Errorf("unexpected config (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("the config flag takes precedence over the environment", func(t *testing.T) {
+		path := writeFile(t, `[site]
+title = "From flag"`)
+		c, err := config.Load(config.LoadArgs{
+			LookupEnv: env(map[string]string{"RAGMARK_CONFIG": filepath.Join(t.TempDir(), "missing.toml")}),
+			Flags:     parseFlags(t, "-config", path),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.Site.Title != "From flag" {
+			t.Errorf("expected title from flag config file, got %q", c.Site.Title)
+		}
+	})
+	t.Run("boolean flags can be set without a value", func(t *testing.T) {
+		c, err := config.Load(config.LoadArgs{
+			LookupEnv: env(nil),
+			Flags:     parseFlags(t, "-db-secure"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !c.Database.Secure {
+			t.Error("expected database.secure to be true")
+		}
+	})
+	t.Run("unknown fields in the file are an error", func(t *testing.T) {
+		path := writeFile(t, `[database]
+hots = "typo"`)
+		_, err := config.Load(config.LoadArgs{Path: path, LookupEnv: env(nil)})
+		if err == nil || !strings.Contains(err.Error(), "database.hots") {
+			t.Errorf("expected error naming database.hots, got %v", err)
+		}
+	})
+	t.Run("invalid environment variables name the field", func(t *testing.T) {
+		_, err := config.Load(config.LoadArgs{
+			LookupEnv: env(map[string]string{"RAGMARK_DATABASE_PORT": "abc"}),
+		})
+		if err == nil || !strings.Contains(err.Error(), "database.port") || !strings.Contains(err.Error(), "RAGMARK_DATABASE_PORT") {
+			t.Errorf("expected error naming database.port, got %v", err)
+		}
+	})
+	t.Run("the sqlite database type requires a path", func(t *testing.T) {
+		_, err := config.Load(config.LoadArgs{
+			LookupEnv: env(map[string]string{"RAGMARK_DATABASE_TYPE": "sqlite"}),
+		})
+		if err == nil || !strings.Contains(err.Error(), "config: database.path:") {
+			t.Errorf("expected error naming database.path, got %v", err)
+		}
+		c, err := config.Load(config.LoadArgs{
+			LookupEnv: env(map[string]string{"RAGMARK_DATABASE_TYPE": "sqlite"}),
+			Flags:     parseFlags(t, "-db-path", "ragmark.db", "-db-port", "0"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if c.Database.Path != "ragmark.db" {
+			t.Errorf("expected database.path to be set from flag, got %q", c.Database.Path)
+		}
+	})
+	t.Run("the context tokens can be set for each chat model", func(t *testing.T) {
+		c, err := config.Load(config.LoadArgs{
+			LookupEnv: env(nil),
+			Flags:     parseFlags(t, "-context-tokens", "3000", "-model-context-tokens", "mistral-nemo=8000, llama3.2=2000"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for model, expected := range map[string]int{"mistral-nemo": 8000, "llama3.2": 2000, "gemma2": 3000} {
+			if actual := c.Chat.ContextTokensFor(model); actual != expected {
+				t.Errorf("%s: expected %d context tokens, got %d", model, expected, actual)
+			}
+		}
+	})
+	t.Run("validation errors name each invalid field", func(t *testing.T) {
+		_, err := config.Load(config.LoadArgs{
+			LookupEnv: env(nil),
+			Flags:     parseFlags(t, "-llm-provider", "anthropomorphic", "-db-port", "0", "-llm-url", "not a url", "-retrieval-mode", "psychic", "-fts-weight", "-1", "-chunk-overlap", "1000", "-reranker", "psychic", "-mmr-lambda", "2"),
+		})
+		if err == nil {
+			t.Fatal("expected validation error")
+		}
+		for _, field := range []string{"llm.provider", "database.port", "llm.url", "rag.mode", "rag.fts_weight", "rag.reranker", "rag.mmr_lambda", "index.chunk_overlap"} {
+			if !strings.Contains(err.Error(), "config: "+field+":") {
+				t.Errorf("expected error to name %s, got %v", field, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type ConversationMessage struct {
+	// Role of the message author, user or assistant.
+	Role    string
+	Content string
+	Created time.Time
+}
+
+type ConversationMessageInsertArgs struct {
+	ConversationID string
+	Messages       []ConversationMessage
+}
+
+// ConversationMessageInsert appends the messages to the conversation in a single transaction,
+// creating the conversation if it doesn't exist. Messages with a zero Created time are given
+// the current time.
+func (q *Queries) ConversationMessageInsert(ctx context.Context, args ConversationMessageInsertArgs) (err error) {
+	now := q.now()
+	stmts := []statement{
+		{
+			Query:     `insert or ignore into conversation (id, created, updated) values (?, ?, ?)`,
+			Arguments: []any{args.ConversationID, now, now},
+		},
+		{
+			Query:     `update conversation set updated = ? where id = ?`,
+			Arguments: []any{now, args.ConversationID},
+		},
+	}
+	for _, msg := range args.Messages {
+		if msg.Created.IsZero() {
+			msg.Created = now
+		}
+		stmts = append(stmts, statement{
+			Query: `insert into conversation_message (conversation_id, idx, role, content, created)
+							values (?, (select coalesce(max(idx), -1) + 1 from conversation_message where conversation_id = ?), ?, ?, ?)`,
+			Arguments: []any{args.ConversationID, args.ConversationID, msg.Role, msg.Content, msg.Created},
+		})
+	}
+	if err = q.db.write(ctx, stmts...); err != nil {
+		return fmt.Errorf("failed to insert conversation messages: %w", err)
+	}
+	return nil
+}
+
+type ConversationMessageSelectArgs struct {
+	ConversationID string
+}
+
+// ConversationMessageSelect returns the messages of the conversation, oldest first. If the
+// conversation doesn't exist, no messages are returned.
+func (q *Queries) ConversationMessageSelect(ctx context.Context, args ConversationMessageSelectArgs) (messages []ConversationMessage, err error) {
+	result, err := q.db.query(ctx, statement{
+		Query:     `select role, content, created from conversation_message where conversation_id = ? order by idx`,
+		Arguments: []any{args.ConversationID},
+	})
+	if err != nil {
+		return messages, fmt.Errorf("failed to select conversation messages: %w", err)
+	}
+	defer result.Close()
+	for result.Next() {
+		var msg ConversationMessage
+		if err = result.Scan(&msg.Role, &msg.Content, &msg.Created); err != nil {
+			return messages, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = result.Err(); err != nil {
+		return messages, err
+	}
+	return messages, nil
+}
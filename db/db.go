@@ -2,23 +2,65 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/rqlite/gorqlite"
 )
 
+var _ Querier = &Queries{}
+
+// Querier is the set of queries that can be executed against the database.
+type Querier interface {
+	DocumentUpsert(ctx context.Context, args DocumentUpsertArgs) (doc DocumentUpsertResult, err error)
+	DocumentUpdateLastUpdated(ctx context.Context, args DocumentUpdateLastUpdatedArgs) (err error)
+	DocumentUpdateIndexed(ctx context.Context, args DocumentUpdateIndexedArgs) (err error)
+	DocumentUpdateMetadata(ctx context.Context, args DocumentUpdateMetadataArgs) (err error)
+	DocumentSelectPaths(ctx context.Context) (paths []string, err error)
+	DocumentDelete(ctx context.Context, args DocumentDeleteArgs) (err error)
+	DocumentFTSUpsert(ctx context.Context, args DocumentFTSUpsertArgs) (err error)
+	DocumentFTSSearch(ctx context.Context, args DocumentFTSSearchArgs) (results []DocumentFTSSearchResult, err error)
+	ChunkDelete(ctx context.Context, args ChunkDeleteArgs) (err error)
+	ChunkInsert(ctx context.Context, args ChunkInsertArgs) (err error)
+	ChunkSelect(ctx context.Context, args ChunkSelectArgs) (chunks []Chunk, err error)
+	ChunkSelectRange(ctx context.Context, args ChunkSelectRangeArgs) (chunks []Chunk, err error)
+	ChunkSelectNearest(ctx context.Context, args ChunkSelectNearestArgs) (chunks []ChunkSelectNearestResult, err error)
+	ChunkFTSSearch(ctx context.Context, args ChunkFTSSearchArgs) (chunks []ChunkFTSSearchResult, err error)
+	TripleUpsert(ctx context.Context, triple Triple) (err error)
+	TripleDelete(ctx context.Context, triple Triple) (err error)
+	TripleReplaceSource(ctx context.Context, args TripleReplaceSourceArgs) (err error)
+	TripleSelectSubject(ctx context.Context, subject string) (triples []Triple, err error)
+	TripleSelectObject(ctx context.Context, object string) (triples []Triple, err error)
+	TripleSelectPredicate(ctx context.Context, predicate string) (triples []Triple, err error)
+	TripleSelectAll(ctx context.Context) (triples []Triple, err error)
+	TripleSelectMentioned(ctx context.Context, args TripleSelectMentionedArgs) (terms []string, err error)
+	TripleQuery(ctx context.Context, args TripleQueryArgs) (result TripleQueryResult, err error)
+	ConversationMessageInsert(ctx context.Context, args ConversationMessageInsertArgs) (err error)
+	ConversationMessageSelect(ctx context.Context, args ConversationMessageSelectArgs) (messages []ConversationMessage, err error)
+}
+
+// New creates queries that use an rqlite connection.
 func New(conn *gorqlite.Connection) *Queries {
 	return &Queries{
-		conn: conn,
-		now:  time.Now,
+		db:  rqliteExecutor{conn: conn},
+		now: time.Now,
+	}
+}
+
+// NewSQLite creates queries that use an embedded SQLite database, see OpenSQLite.
+func NewSQLite(db *sql.DB) *Queries {
+	return &Queries{
+		db:  sqlExecutor{db: db},
+		now: time.Now,
 	}
 }
 
 type Queries struct {
-	conn *gorqlite.Connection
-	now  func() time.Time
+	db  executor
+	now func() time.Time
 }
 
 type DocumentUpsertArgs struct {
@@ -28,31 +70,46 @@ type DocumentUpsertArgs struct {
 type DocumentUpsertResult struct {
 	Path        string
 	LastUpdated time.Time
+	// ContentHash, EmbeddingModel, SplitterVersion and ExtractionVersion are the state of
+	// the document when it was last indexed, or empty if it hasn't been indexed.
+	ContentHash       string
+	EmbeddingModel    string
+	SplitterVersion   string
+	ExtractionVersion string
+	// Type and LastMod are the document's metadata when it was last indexed.
+	Type    string
+	LastMod time.Time
 }
 
 // DocumentUpsert upserts a document. If the document already exists the record will be
 // returned.
 // If the document does not exist, it will be inserted, and the updated flag will be set to true.
 func (q *Queries) DocumentUpsert(ctx context.Context, args DocumentUpsertArgs) (doc DocumentUpsertResult, err error) {
-	results, err := q.conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
-		Query:     `select path, last_updated from document where path = ?`,
+	results, err := q.db.query(ctx, statement{
+		Query:     `select path, last_updated, content_hash, embedding_model, splitter_version, extraction_version, type, last_mod from document where path = ?`,
 		Arguments: []any{args.Path},
 	})
 	if err != nil {
 		return doc, fmt.Errorf("failed to select document rowid: %w", err)
 	}
+	defer results.Close()
 	var hasResult bool
 	for results.Next() {
-		err := results.Scan(&doc.Path, &doc.LastUpdated)
+		var lastMod int64
+		err := results.Scan(&doc.Path, &doc.LastUpdated, &doc.ContentHash, &doc.EmbeddingModel, &doc.SplitterVersion, &doc.ExtractionVersion, &doc.Type, &lastMod)
 		if err != nil {
 			return doc, err
 		}
+		doc.LastMod = fromUnixSeconds(lastMod)
 		hasResult = true
 	}
+	if err = results.Err(); err != nil {
+		return doc, err
+	}
 	if hasResult {
 		return doc, nil
 	}
-	_, err = q.conn.WriteOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+	err = q.db.write(ctx, statement{
 		Query:     `insert or ignore into document (path, last_updated) values (?, ?)`,
 		Arguments: []any{args.Path, time.Time{}},
 	})
@@ -70,7 +127,7 @@ type DocumentUpdateLastUpdatedArgs struct {
 }
 
 func (q *Queries) DocumentUpdateLastUpdated(ctx context.Context, args DocumentUpdateLastUpdatedArgs) (err error) {
-	_, err = q.conn.WriteOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+	err = q.db.write(ctx, statement{
 		Query:     `update document set last_updated = ? where path = ?`,
 		Arguments: []any{args.LastUpdated, args.Path},
 	})
@@ -80,6 +137,49 @@ func (q *Queries) DocumentUpdateLastUpdated(ctx context.Context, args DocumentUp
 	return nil
 }
 
+type DocumentUpdateIndexedArgs struct {
+	Path              string
+	LastUpdated       time.Time
+	ContentHash       string
+	EmbeddingModel    string
+	SplitterVersion   string
+	ExtractionVersion string
+	// Type and LastMod are from the document's metadata, and are used to filter search.
+	Type    string
+	LastMod time.Time
+}
+
+// DocumentUpdateIndexed records the state of the document after it has been indexed.
+func (q *Queries) DocumentUpdateIndexed(ctx context.Context, args DocumentUpdateIndexedArgs) (err error) {
+	err = q.db.write(ctx, statement{
+		Query:     `update document set last_updated = ?, content_hash = ?, embedding_model = ?, splitter_version = ?, extraction_version = ?, type = ?, last_mod = ? where path = ?`,
+		Arguments: []any{args.LastUpdated, args.ContentHash, args.EmbeddingModel, args.SplitterVersion, args.ExtractionVersion, args.Type, unixSeconds(args.LastMod), args.Path},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update document index state: %w", err)
+	}
+	return nil
+}
+
+type DocumentUpdateMetadataArgs struct {
+	Path    string
+	Type    string
+	LastMod time.Time
+}
+
+// DocumentUpdateMetadata updates the metadata used to filter search, without changing the
+// index state, e.g. for documents indexed before the metadata was stored.
+func (q *Queries) DocumentUpdateMetadata(ctx context.Context, args DocumentUpdateMetadataArgs) (err error) {
+	err = q.db.write(ctx, statement{
+		Query:     `update document set type = ?, last_mod = ? where path = ?`,
+		Arguments: []any{args.Type, unixSeconds(args.LastMod), args.Path},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update document metadata: %w", err)
+	}
+	return nil
+}
+
 type DocumentFTSUpsertArgs struct {
 	Path    string
 	Title   string
@@ -88,22 +188,176 @@ type DocumentFTSUpsertArgs struct {
 }
 
 func (q *Queries) DocumentFTSUpsert(ctx context.Context, args DocumentFTSUpsertArgs) (err error) {
-	_, err = q.conn.WriteOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
-		Query:     `insert or replace into document_fts (path, title, text, summary) values (?, ?, ?, ?)`,
-		Arguments: []any{args.Path, args.Title, args.Text, args.Summary},
-	})
+	// fts5 tables don't have a primary key, so "insert or replace" would add a
+	// duplicate row each time the document is indexed.
+	err = q.db.write(ctx,
+		statement{
+			Query:     `delete from document_fts where path = ?`,
+			Arguments: []any{args.Path},
+		},
+		statement{
+			Query:     `insert into document_fts (path, title, text, summary) values (?, ?, ?, ?)`,
+			Arguments: []any{args.Path, args.Title, args.Text, args.Summary},
+		},
+	)
 	if err != nil {
 		return fmt.Errorf("failed to upsert document fts: %w", err)
 	}
 	return nil
 }
 
+// DocumentSelectPaths returns the paths of all indexed documents, including paths that
+// only have chunks, full-text search entries or triples, e.g. after an interrupted index.
+func (q *Queries) DocumentSelectPaths(ctx context.Context) (paths []string, err error) {
+	result, err := q.db.query(ctx, statement{
+		Query: `select path from document
+						union
+						select path from document_fts
+						union
+						select path from chunk
+						union
+						select source from triple where source != ''
+						order by path;`,
+	})
+	if err != nil {
+		return paths, fmt.Errorf("failed to select document paths: %w", err)
+	}
+	defer result.Close()
+	for result.Next() {
+		var path string
+		if err = result.Scan(&path); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if err = result.Err(); err != nil {
+		return paths, err
+	}
+	return paths, nil
+}
+
+type DocumentDeleteArgs struct {
+	Path string
+}
+
+// DocumentDelete removes the document, its full-text search entry, chunks, embeddings and
+// extracted triples in a single transaction.
+func (q *Queries) DocumentDelete(ctx context.Context, args DocumentDeleteArgs) (err error) {
+	err = q.db.write(ctx,
+		statement{
+			Query:     `delete from chunk_embedding where rowid in (select rowid from chunk where path = ?)`,
+			Arguments: []any{args.Path},
+		},
+		statement{
+			Query:     `delete from chunk where path = ?`,
+			Arguments: []any{args.Path},
+		},
+		statement{
+			Query:     `delete from document_fts where path = ?`,
+			Arguments: []any{args.Path},
+		},
+		statement{
+			Query:     `delete from triple where source = ?`,
+			Arguments: []any{args.Path},
+		},
+		statement{
+			Query:     `delete from document where path = ?`,
+			Arguments: []any{args.Path},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	return nil
+}
+
+// HighlightStart and HighlightEnd surround matched terms in full-text search results.
+// They're control characters, so they can't appear in the indexed text, and can be
+// replaced after the text has been escaped, e.g. with <mark> and </mark>.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+type DocumentFTSSearchArgs struct {
+	// Query is the user's search text. Each whitespace separated term is matched
+	// as an fts5 phrase, so punctuation such as the hyphen in a part number doesn't
+	// need to be escaped.
+	Query string
+	Limit int
+}
+
+type DocumentFTSSearchResult struct {
+	Path string
+	// Title with matching terms highlighted.
+	Title string
+	// Snippet of the text with matching terms highlighted.
+	Snippet string
+	Summary string
+	// Rank is the bm25 score of the document, lower is a better match.
+	Rank float64
+}
+
+// DocumentFTSSearch returns the documents that contain all of the terms in the query,
+// best match first. Matches in the title are weighted more heavily than matches in the text.
+func (q *Queries) DocumentFTSSearch(ctx context.Context, args DocumentFTSSearchArgs) (results []DocumentFTSSearchResult, err error) {
+	match := ftsMatchQuery(args.Query, "AND")
+	if match == "" {
+		return nil, nil
+	}
+	if args.Limit <= 0 {
+		args.Limit = 20
+	}
+	stmt := statement{
+		Query: `select
+							path,
+							highlight(document_fts, 1, ?, ?),
+							snippet(document_fts, 2, ?, ?, '…', 32),
+							summary,
+							bm25(document_fts, 0.0, 10.0, 1.0, 0.0) as rank
+						from
+							document_fts
+						where
+							document_fts match ?
+						order by rank
+						limit ?;`,
+		Arguments: []any{HighlightStart, HighlightEnd, HighlightStart, HighlightEnd, match, args.Limit},
+	}
+	result, err := q.db.query(ctx, stmt)
+	if err != nil {
+		return results, fmt.Errorf("failed to search documents: %w", err)
+	}
+	defer result.Close()
+	for result.Next() {
+		var r DocumentFTSSearchResult
+		if err = result.Scan(&r.Path, &r.Title, &r.Snippet, &r.Summary, &r.Rank); err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	if err = result.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// ftsMatchQuery converts user input into an fts5 query, quoting each term so that
+// fts5 syntax characters in the input are treated as text. The terms are joined
+// with the operator, AND or OR.
+func ftsMatchQuery(input, operator string) string {
+	terms := strings.Fields(input)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " "+operator+" ")
+}
+
 type ChunkDeleteArgs struct {
 	Path string
 }
 
 func (q *Queries) ChunkDelete(ctx context.Context, args ChunkDeleteArgs) (err error) {
-	statements := []gorqlite.ParameterizedStatement{
+	statements := []statement{
 		{
 			Query:     `delete from chunk_embedding where rowid in (select rowid from chunk where path = ?)`,
 			Arguments: []any{args.Path},
@@ -113,15 +367,17 @@ func (q *Queries) ChunkDelete(ctx context.Context, args ChunkDeleteArgs) (err er
 			Arguments: []any{args.Path},
 		},
 	}
-	if _, err = q.conn.WriteParameterizedContext(ctx, statements); err != nil {
+	if err = q.db.write(ctx, statements...); err != nil {
 		return err
 	}
 	return nil
 }
 
 type Chunk struct {
-	Path      string
-	Index     int
+	Path  string
+	Index int
+	// Heading is the breadcrumb of the headings that the chunk is within, e.g. "Install > Linux".
+	Heading   string
 	Text      string
 	Embedding []float32
 }
@@ -131,25 +387,25 @@ type ChunkInsertArgs struct {
 }
 
 func (q *Queries) ChunkInsert(ctx context.Context, args ChunkInsertArgs) (err error) {
-	statements := make([]gorqlite.ParameterizedStatement, len(args.Chunks)*2)
+	statements := make([]statement, len(args.Chunks)*2)
 	var chunkIndex = 0
 	for _, chunk := range args.Chunks {
 		embeddingJSON, err := json.Marshal(chunk.Embedding)
 		if err != nil {
 			return fmt.Errorf("failed to marshal embedding: %w", err)
 		}
-		statements[chunkIndex] = gorqlite.ParameterizedStatement{
-			Query:     `insert into chunk (path, idx, text) values (?, ?, ?)`,
-			Arguments: []any{chunk.Path, chunk.Index, chunk.Text},
+		statements[chunkIndex] = statement{
+			Query:     `insert into chunk (path, idx, heading, text) values (?, ?, ?, ?)`,
+			Arguments: []any{chunk.Path, chunk.Index, chunk.Heading, chunk.Text},
 		}
 		chunkIndex++
-		statements[chunkIndex] = gorqlite.ParameterizedStatement{
+		statements[chunkIndex] = statement{
 			Query:     `insert into chunk_embedding (rowid, embedding) values (last_insert_rowid(), ?)`,
 			Arguments: []any{string(embeddingJSON)},
 		}
 		chunkIndex++
 	}
-	if _, err = q.conn.WriteParameterizedContext(ctx, statements); err != nil {
+	if err = q.db.write(ctx, statements...); err != nil {
 		return err
 	}
 	return nil
@@ -161,7 +417,7 @@ type ChunkSelectArgs struct {
 
 func (q *Queries) ChunkSelect(ctx context.Context, args ChunkSelectArgs) (chunks []Chunk, err error) {
 	query := `select
-							c.idx, c.text, vec_to_json(ce.embedding)
+							c.idx, c.heading, c.text, vec_to_json(ce.embedding)
 						from
 							chunk c
 						inner join
@@ -170,17 +426,18 @@ func (q *Queries) ChunkSelect(ctx context.Context, args ChunkSelectArgs) (chunks
 							c.path = ?
 						order by
 							c.idx;`
-	result, err := q.conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+	result, err := q.db.query(ctx, statement{
 		Query:     query,
 		Arguments: []any{args.Path},
 	})
 	if err != nil {
 		return chunks, err
 	}
+	defer result.Close()
 	for result.Next() {
 		chunk := Chunk{Path: args.Path}
 		var embeddingJSON string
-		if err = result.Scan(&chunk.Index, &chunk.Text, &embeddingJSON); err != nil {
+		if err = result.Scan(&chunk.Index, &chunk.Heading, &chunk.Text, &embeddingJSON); err != nil {
 			return chunks, err
 		}
 		if err = json.Unmarshal([]byte(embeddingJSON), &chunk.Embedding); err != nil {
@@ -188,6 +445,9 @@ func (q *Queries) ChunkSelect(ctx context.Context, args ChunkSelectArgs) (chunks
 		}
 		chunks = append(chunks, chunk)
 	}
+	if err = result.Err(); err != nil {
+		return chunks, err
+	}
 	return chunks, nil
 }
 
@@ -199,7 +459,7 @@ type ChunkSelectRangeArgs struct {
 
 func (q *Queries) ChunkSelectRange(ctx context.Context, args ChunkSelectRangeArgs) (chunks []Chunk, err error) {
 	query := `select
-							c.idx, c.text, vec_to_json(ce.embedding)
+							c.idx, c.heading, c.text, vec_to_json(ce.embedding)
 						from
 							chunk c
 						inner join
@@ -208,17 +468,18 @@ func (q *Queries) ChunkSelectRange(ctx context.Context, args ChunkSelectRangeArg
 							c.path = ? and c.idx >= ? and c.idx <= ?
 						order by
 							c.idx;`
-	result, err := q.conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+	result, err := q.db.query(ctx, statement{
 		Query:     query,
 		Arguments: []any{args.Path, args.StartIndex, args.EndIndex},
 	})
 	if err != nil {
 		return chunks, err
 	}
+	defer result.Close()
 	for result.Next() {
 		chunk := Chunk{Path: args.Path}
 		var embeddingJSON string
-		if err = result.Scan(&chunk.Index, &chunk.Text, &embeddingJSON); err != nil {
+		if err = result.Scan(&chunk.Index, &chunk.Heading, &chunk.Text, &embeddingJSON); err != nil {
 			return chunks, err
 		}
 		if err = json.Unmarshal([]byte(embeddingJSON), &chunk.Embedding); err != nil {
@@ -226,12 +487,18 @@ func (q *Queries) ChunkSelectRange(ctx context.Context, args ChunkSelectRangeArg
 		}
 		chunks = append(chunks, chunk)
 	}
+	if err = result.Err(); err != nil {
+		return chunks, err
+	}
 	return chunks, nil
 }
 
 type ChunkSelectNearestArgs struct {
 	Embedding []float32
 	Limit     int
+	// Filter restricts the chunks that are searched. The vector index can't be filtered,
+	// so filtered searches compare the embedding with every chunk that matches the filter.
+	Filter ChunkFilter
 }
 
 type ChunkSelectNearestResult struct {
@@ -244,7 +511,7 @@ func (q *Queries) ChunkSelectNearest(ctx context.Context, args ChunkSelectNeares
 	if err != nil {
 		return chunks, fmt.Errorf("failed to marshal embedding: %w", err)
 	}
-	stmt := gorqlite.ParameterizedStatement{
+	stmt := statement{
 		Query: `with vec_results as (
 							select
 								rowid, embedding, distance
@@ -256,7 +523,7 @@ func (q *Queries) ChunkSelectNearest(ctx context.Context, args ChunkSelectNeares
 							limit ?
 						)
 						select
-							c.path, c.idx, c.text, vec_to_json(vr.embedding), vr.distance
+							c.path, c.idx, c.heading, c.text, vec_to_json(vr.embedding), vr.distance
 						from
 							chunk c
 						inner join
@@ -264,14 +531,31 @@ func (q *Queries) ChunkSelectNearest(ctx context.Context, args ChunkSelectNeares
 						order by vr.distance;`,
 		Arguments: []any{string(embeddingInputJSON), args.Limit},
 	}
-	result, err := q.conn.QueryOneParameterizedContext(ctx, stmt)
+	if !args.Filter.IsZero() {
+		where, whereArgs := args.Filter.where("c")
+		stmt = statement{
+			Query: `select
+								c.path, c.idx, c.heading, c.text, vec_to_json(ce.embedding), vec_distance_l2(ce.embedding, ?) as distance
+							from
+								chunk c
+							inner join
+								chunk_embedding ce on c.rowid = ce.rowid
+							where
+								` + where + `
+							order by distance
+							limit ?;`,
+			Arguments: append(append([]any{string(embeddingInputJSON)}, whereArgs...), args.Limit),
+		}
+	}
+	result, err := q.db.query(ctx, stmt)
 	if err != nil {
 		return chunks, err
 	}
+	defer result.Close()
 	for result.Next() {
 		var chunk ChunkSelectNearestResult
 		var embeddingJSON string
-		if err = result.Scan(&chunk.Path, &chunk.Index, &chunk.Text, &embeddingJSON, &chunk.Distance); err != nil {
+		if err = result.Scan(&chunk.Path, &chunk.Index, &chunk.Heading, &chunk.Text, &embeddingJSON, &chunk.Distance); err != nil {
 			return chunks, err
 		}
 		if err = json.Unmarshal([]byte(embeddingJSON), &chunk.Embedding); err != nil {
@@ -279,6 +563,76 @@ func (q *Queries) ChunkSelectNearest(ctx context.Context, args ChunkSelectNeares
 		}
 		chunks = append(chunks, chunk)
 	}
+	if err = result.Err(); err != nil {
+		return chunks, err
+	}
+	return chunks, nil
+}
+
+type ChunkFTSSearchArgs struct {
+	// Query is natural language text, e.g. a question. Chunks that contain any
+	// of its terms are matched, and ranked by bm25.
+	Query string
+	Limit int
+	// Filter restricts the chunks that are searched.
+	Filter ChunkFilter
+}
+
+type ChunkFTSSearchResult struct {
+	Chunk
+	// Rank is the bm25 score of the chunk, lower is a better match.
+	Rank float64
+}
+
+func (q *Queries) ChunkFTSSearch(ctx context.Context, args ChunkFTSSearchArgs) (chunks []ChunkFTSSearchResult, err error) {
+	match := ftsMatchQuery(args.Query, "OR")
+	if match == "" {
+		return nil, nil
+	}
+	where, whereArgs := args.Filter.where("fc")
+	stmt := statement{
+		Query: `with fts_results as (
+							select
+								chunk_fts.rowid, bm25(chunk_fts) as rank
+							from
+								chunk_fts
+							inner join
+								chunk fc on fc.rowid = chunk_fts.rowid
+							where
+								chunk_fts match ? and ` + where + `
+							order by rank
+							limit ?
+						)
+						select
+							c.path, c.idx, c.heading, c.text, vec_to_json(ce.embedding), fr.rank
+						from
+							fts_results fr
+						inner join
+							chunk c on c.rowid = fr.rowid
+						inner join
+							chunk_embedding ce on ce.rowid = fr.rowid
+						order by fr.rank;`,
+		Arguments: append(append([]any{match}, whereArgs...), args.Limit),
+	}
+	result, err := q.db.query(ctx, stmt)
+	if err != nil {
+		return chunks, fmt.Errorf("failed to search chunks: %w", err)
+	}
+	defer result.Close()
+	for result.Next() {
+		var chunk ChunkFTSSearchResult
+		var embeddingJSON string
+		if err = result.Scan(&chunk.Path, &chunk.Index, &chunk.Heading, &chunk.Text, &embeddingJSON, &chunk.Rank); err != nil {
+			return chunks, err
+		}
+		if err = json.Unmarshal([]byte(embeddingJSON), &chunk.Embedding); err != nil {
+			return chunks, fmt.Errorf("failed to unmarshal embedding: %w", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if err = result.Err(); err != nil {
+		return chunks, err
+	}
 	return chunks, nil
 }
 
@@ -286,6 +640,8 @@ type Triple struct {
 	Subject   string `json:"s"`
 	Predicate string `json:"p"`
 	Object    string `json:"o"`
+	// Source is the path of the document that the triple was extracted from, if any.
+	Source string `json:"src,omitempty"`
 }
 
 func (q *Queries) TripleUpsert(ctx context.Context, triple Triple) (err error) {
@@ -293,7 +649,7 @@ func (q *Queries) TripleUpsert(ctx context.Context, triple Triple) (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to marshal triple: %w", err)
 	}
-	_, err = q.conn.WriteOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+	err = q.db.write(ctx, statement{
 		Query:     `insert or replace into triple (triple) values (?)`,
 		Arguments: []any{string(tripleJSON)},
 	})
@@ -304,7 +660,7 @@ func (q *Queries) TripleUpsert(ctx context.Context, triple Triple) (err error) {
 }
 
 func (q *Queries) TripleDelete(ctx context.Context, triple Triple) (err error) {
-	_, err = q.conn.WriteOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+	err = q.db.write(ctx, statement{
 		Query:     `delete from triple where subject = ? and predicate = ? and object = ?`,
 		Arguments: []any{triple.Subject, triple.Predicate, triple.Object},
 	})
@@ -314,14 +670,72 @@ func (q *Queries) TripleDelete(ctx context.Context, triple Triple) (err error) {
 	return nil
 }
 
+type TripleReplaceSourceArgs struct {
+	Source  string
+	Triples []Triple
+}
+
+// TripleReplaceSource replaces the triples extracted from a document in a single transaction.
+// The source of each triple is set to args.Source.
+func (q *Queries) TripleReplaceSource(ctx context.Context, args TripleReplaceSourceArgs) (err error) {
+	stmts := []statement{
+		{
+			Query:     `delete from triple where source = ?`,
+			Arguments: []any{args.Source},
+		},
+	}
+	for _, triple := range args.Triples {
+		triple.Source = args.Source
+		tripleJSON, err := json.Marshal(triple)
+		if err != nil {
+			return fmt.Errorf("failed to marshal triple: %w", err)
+		}
+		stmts = append(stmts, statement{
+			Query:     `insert or replace into triple (triple) values (?)`,
+			Arguments: []any{string(tripleJSON)},
+		})
+	}
+	if err = q.db.write(ctx, stmts...); err != nil {
+		return fmt.Errorf("failed to replace triples: %w", err)
+	}
+	return nil
+}
+
 func (q *Queries) TripleSelectSubject(ctx context.Context, subject string) (triples []Triple, err error) {
-	result, err := q.conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+	return q.tripleSelect(ctx, statement{
 		Query:     `select triple from triple where subject = ?`,
 		Arguments: []any{subject},
 	})
+}
+
+func (q *Queries) TripleSelectObject(ctx context.Context, object string) (triples []Triple, err error) {
+	return q.tripleSelect(ctx, statement{
+		Query:     `select triple from triple where object = ?`,
+		Arguments: []any{object},
+	})
+}
+
+// TripleSelectPredicate returns the triples that use the predicate, e.g. every rdf:type statement.
+func (q *Queries) TripleSelectPredicate(ctx context.Context, predicate string) (triples []Triple, err error) {
+	return q.tripleSelect(ctx, statement{
+		Query:     `select triple from triple where predicate = ? order by object, subject, source`,
+		Arguments: []any{predicate},
+	})
+}
+
+// TripleSelectAll returns every triple, e.g. to export the graph.
+func (q *Queries) TripleSelectAll(ctx context.Context) (triples []Triple, err error) {
+	return q.tripleSelect(ctx, statement{
+		Query: `select triple from triple order by subject, predicate, object, source`,
+	})
+}
+
+func (q *Queries) tripleSelect(ctx context.Context, stmt statement) (triples []Triple, err error) {
+	result, err := q.db.query(ctx, stmt)
 	if err != nil {
 		return triples, err
 	}
+	defer result.Close()
 	for result.Next() {
 		var tripleJSON string
 		if err = result.Scan(&tripleJSON); err != nil {
@@ -333,23 +747,54 @@ func (q *Queries) TripleSelectSubject(ctx context.Context, subject string) (trip
 		}
 		triples = append(triples, triple)
 	}
+	if err = result.Err(); err != nil {
+		return triples, err
+	}
 	return triples, nil
 }
 
-func (q *Queries) TripleSelectObject(ctx context.Context, object string) (triples []Triple, err error) {
-	result, err := q.conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
-		Query:     `select triple from triple where object = ?`,
-		Arguments: []any{object},
+type TripleSelectMentionedArgs struct {
+	// Text to find terms in, e.g. a user's question.
+	Text string
+	// Limit is the maximum number of terms to return, or zero for no limit.
+	Limit int
+}
+
+// TripleSelectMentioned returns the subjects and objects of triples that appear in the text,
+// ignoring case. Prefixed names, e.g. ies:Vehicle, match on their local name. The text is
+// matched as a substring, so callers should check for word boundaries before applying a limit.
+// Longer terms are returned first.
+func (q *Queries) TripleSelectMentioned(ctx context.Context, args TripleSelectMentionedArgs) (terms []string, err error) {
+	limit := args.Limit
+	if limit <= 0 {
+		// SQLite treats a negative limit as no limit.
+		limit = -1
+	}
+	result, err := q.db.query(ctx, statement{
+		Query: `select term from (
+							select subject as term from triple
+							union
+							select object as term from triple
+						)
+						where length(term) >= 2
+						and instr(lower(?), lower(substr(term, instr(term, ':') + 1))) > 0
+						order by length(term) desc, term
+						limit ?;`,
+		Arguments: []any{args.Text, limit},
 	})
 	if err != nil {
-		return triples, err
+		return terms, fmt.Errorf("failed to select mentioned terms: %w", err)
 	}
+	defer result.Close()
 	for result.Next() {
-		var triple Triple
-		if err = result.Scan(&triple); err != nil {
-			return triples, err
+		var term string
+		if err = result.Scan(&term); err != nil {
+			return terms, err
 		}
-		triples = append(triples, triple)
+		terms = append(terms, term)
 	}
-	return triples, nil
+	if err = result.Err(); err != nil {
+		return terms, err
+	}
+	return terms, nil
 }
@@ -3,8 +3,11 @@ package db_test
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/a-h/ragmark/db"
 	"github.com/google/go-cmp/cmp"
@@ -14,7 +17,7 @@ import (
 var initOnce sync.Once
 var conn *gorqlite.Connection
 
-func initConnection() (err error) {
+func initRqliteConnection() (err error) {
 	initOnce.Do(func() {
 		databaseURL := db.URL{
 			User:     "admin",
@@ -34,16 +37,28 @@ func initConnection() (err error) {
 	return err
 }
 
+// forEachBackend runs the test against rqlite, and an embedded SQLite database.
+func forEachBackend(t *testing.T, test func(t *testing.T, q db.Querier)) {
+	t.Run("rqlite", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("skipping test in short mode.")
+		}
+		if err := initRqliteConnection(); err != nil {
+			t.Fatal(err)
+		}
+		test(t, db.New(conn))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newSQLiteQueries(t))
+	})
+}
+
 func TestTriples(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
-	}
-	if err := initConnection(); err != nil {
-		t.Fatal(err)
-	}
-	ctx := context.Background()
+	forEachBackend(t, testTriples)
+}
 
-	q := db.New(conn)
+func testTriples(t *testing.T, q db.Querier) {
+	ctx := context.Background()
 
 	t1 := db.Triple{
 		Subject:   "subject",
@@ -129,4 +144,746 @@ func TestTriples(t *testing.T) {
 			t.Fatalf("unexpected triple: %s", diff)
 		}
 	})
+	t.Run("ReplaceSource replaces the triples from a source", func(t *testing.T) {
+		source, other := "/test/triples", "/test/triples-other"
+		if err := q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: other, Triples: []db.Triple{
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft"},
+		}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: source, Triples: []db.Triple{
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Vehicle"},
+		}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: source, Triples: []db.Triple{
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft"},
+		}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		triples, err := q.TripleSelectSubject(ctx, "Apache")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		slices.SortFunc(triples, func(a, b db.Triple) int { return strings.Compare(a.Source, b.Source) })
+		expected := []db.Triple{
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: source},
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: other},
+		}
+		if diff := cmp.Diff(expected, triples); diff != "" {
+			t.Errorf("unexpected triples (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("SelectPredicate returns the triples that use the predicate", func(t *testing.T) {
+		triples, err := q.TripleSelectPredicate(ctx, "has_used")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]db.Triple{t2}, triples); diff != "" {
+			t.Errorf("unexpected triples (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("SelectAll returns every triple", func(t *testing.T) {
+		triples, err := q.TripleSelectAll(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []db.Triple{
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: "/test/triples"},
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: "/test/triples-other"},
+			t2,
+		}
+		if diff := cmp.Diff(expected, triples); diff != "" {
+			t.Errorf("unexpected triples (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("SelectMentioned returns the terms in the text", func(t *testing.T) {
+		terms, err := q.TripleSelectMentioned(ctx, db.TripleSelectMentionedArgs{Text: "Which aircraft is the apache?", Limit: 10})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]string{"ies:Aircraft", "Apache"}, terms); diff != "" {
+			t.Errorf("unexpected terms (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("SelectMentioned returns every term if there's no limit", func(t *testing.T) {
+		terms, err := q.TripleSelectMentioned(ctx, db.TripleSelectMentionedArgs{Text: "Which aircraft is the apache?"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]string{"ies:Aircraft", "Apache"}, terms); diff != "" {
+			t.Errorf("unexpected terms (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("ReplaceSource with no triples removes the triples from a source", func(t *testing.T) {
+		for _, path := range []string{"/test/triples", "/test/triples-other"} {
+			if err := q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: path}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		triples, err := q.TripleSelectSubject(ctx, "Apache")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(triples) != 0 {
+			t.Errorf("expected no triples, got %v", triples)
+		}
+	})
+}
+
+func TestTripleQuery(t *testing.T) {
+	forEachBackend(t, testTripleQuery)
+}
+
+func testTripleQuery(t *testing.T, q db.Querier) {
+	ctx := context.Background()
+	source := "/test/query"
+	if err := q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: source, Triples: []db.Triple{
+		{Subject: "test:Tank", Predicate: "rdfs:subClassOf", Object: "test:ArmouredVehicle"},
+		{Subject: "test:ArmouredVehicle", Predicate: "rdfs:subClassOf", Object: "test:Vehicle"},
+		{Subject: "test:Aircraft", Predicate: "rdfs:subClassOf", Object: "test:Vehicle"},
+		{Subject: "Challenger 2", Predicate: "rdf:type", Object: "test:Tank"},
+		{Subject: "Warrior", Predicate: "rdf:type", Object: "test:ArmouredVehicle"},
+		{Subject: "Apache", Predicate: "rdf:type", Object: "test:Aircraft"},
+		{Subject: "Land Rover", Predicate: "rdf:type", Object: "test:Vehicle"},
+		{Subject: "Boeing", Predicate: "test:make", Object: "Apache"},
+	}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: source})
+	})
+
+	tests := []struct {
+		name     string
+		args     db.TripleQueryArgs
+		expected db.TripleQueryResult
+	}{
+		{
+			name: "a single pattern binds its variables",
+			args: db.TripleQueryArgs{Patterns: []db.TriplePattern{
+				{Subject: "?maker", Predicate: "test:make", Object: "?made"},
+			}},
+			expected: db.TripleQueryResult{
+				Variables: []string{"maker", "made"},
+				Bindings:  []map[string]string{{"maker": "Boeing", "made": "Apache"}},
+			},
+		},
+		{
+			name: "patterns are joined on shared variables",
+			args: db.TripleQueryArgs{Patterns: []db.TriplePattern{
+				{Subject: "?maker", Predicate: "test:make", Object: "?made"},
+				{Subject: "?made", Predicate: "rdf:type", Object: "?class"},
+			}},
+			expected: db.TripleQueryResult{
+				Variables: []string{"maker", "made", "class"},
+				Bindings:  []map[string]string{{"maker": "Boeing", "made": "Apache", "class": "test:Aircraft"}},
+			},
+		},
+		{
+			name: "one or more paths follow chains of the predicate",
+			args: db.TripleQueryArgs{Patterns: []db.TriplePattern{
+				{Subject: "?class", Predicate: "rdfs:subClassOf", Object: "test:Vehicle", Path: db.PathOneOrMore},
+			}},
+			expected: db.TripleQueryResult{
+				Variables: []string{"class"},
+				Bindings: []map[string]string{
+					{"class": "test:Aircraft"},
+					{"class": "test:ArmouredVehicle"},
+					{"class": "test:Tank"},
+				},
+			},
+		},
+		{
+			name: "zero or more paths include the constant, so instances of every subclass are found",
+			args: db.TripleQueryArgs{Patterns: []db.TriplePattern{
+				{Subject: "?class", Predicate: "rdfs:subClassOf", Object: "test:Vehicle", Path: db.PathZeroOrMore},
+				{Subject: "?vehicle", Predicate: "rdf:type", Object: "?class"},
+			}},
+			expected: db.TripleQueryResult{
+				Variables: []string{"class", "vehicle"},
+				Bindings: []map[string]string{
+					{"class": "test:Aircraft", "vehicle": "Apache"},
+					{"class": "test:ArmouredVehicle", "vehicle": "Warrior"},
+					{"class": "test:Tank", "vehicle": "Challenger 2"},
+					{"class": "test:Vehicle", "vehicle": "Land Rover"},
+				},
+			},
+		},
+		{
+			name: "paths can start from the subject",
+			args: db.TripleQueryArgs{Patterns: []db.TriplePattern{
+				{Subject: "test:Tank", Predicate: "rdfs:subClassOf", Object: "?ancestor", Path: db.PathOneOrMore},
+			}},
+			expected: db.TripleQueryResult{
+				Variables: []string{"ancestor"},
+				Bindings: []map[string]string{
+					{"ancestor": "test:ArmouredVehicle"},
+					{"ancestor": "test:Vehicle"},
+				},
+			},
+		},
+		{
+			name: "filters restrict the values of variables",
+			args: db.TripleQueryArgs{
+				Patterns: []db.TriplePattern{
+					{Subject: "?vehicle", Predicate: "rdf:type", Object: "?class"},
+				},
+				Filters: []db.TripleFilter{
+					{Variable: "?class", Operator: db.FilterPrefix, Values: []string{"test:A"}},
+					{Variable: "?vehicle", Operator: db.FilterNotIn, Values: []string{"Apache"}},
+				},
+			},
+			expected: db.TripleQueryResult{
+				Variables: []string{"vehicle", "class"},
+				Bindings:  []map[string]string{{"vehicle": "Warrior", "class": "test:ArmouredVehicle"}},
+			},
+		},
+		{
+			name: "the limit restricts the number of results",
+			args: db.TripleQueryArgs{
+				Patterns: []db.TriplePattern{
+					{Subject: "?class", Predicate: "rdfs:subClassOf", Object: "test:Vehicle", Path: db.PathOneOrMore},
+				},
+				Limit: 1,
+			},
+			expected: db.TripleQueryResult{
+				Variables: []string{"class"},
+				Bindings:  []map[string]string{{"class": "test:Aircraft"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := q.TripleQuery(ctx, tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+	t.Run("invalid queries return an error", func(t *testing.T) {
+		_, err := q.TripleQuery(ctx, db.TripleQueryArgs{Patterns: []db.TriplePattern{
+			{Subject: "?s", Predicate: "?p", Object: "?o", Path: db.PathOneOrMore},
+		}})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func embedding(values ...float32) []float32 {
+	e := make([]float32, 768)
+	copy(e, values)
+	return e
+}
+
+func TestDocuments(t *testing.T) {
+	forEachBackend(t, testDocuments)
+}
+
+func testDocuments(t *testing.T, q db.Querier) {
+	ctx := context.Background()
+	path := "/test/documents"
+
+	t.Run("Upsert inserts a new document with a zero last updated time", func(t *testing.T) {
+		doc, err := q.DocumentUpsert(ctx, db.DocumentUpsertArgs{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Path != path {
+			t.Errorf("expected path %q, got %q", path, doc.Path)
+		}
+	})
+	t.Run("UpdateLastUpdated updates the time returned by Upsert", func(t *testing.T) {
+		lastUpdated := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+		err := q.DocumentUpdateLastUpdated(ctx, db.DocumentUpdateLastUpdatedArgs{
+			Path:        path,
+			LastUpdated: lastUpdated,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := q.DocumentUpsert(ctx, db.DocumentUpsertArgs{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !doc.LastUpdated.Equal(lastUpdated) {
+			t.Errorf("expected last updated %v, got %v", lastUpdated, doc.LastUpdated)
+		}
+	})
+	t.Run("UpdateIndexed updates the index state returned by Upsert", func(t *testing.T) {
+		expected := db.DocumentUpsertResult{
+			Path:              path,
+			LastUpdated:       time.Date(2024, time.October, 2, 12, 0, 0, 0, time.UTC),
+			ContentHash:       "hash",
+			EmbeddingModel:    "model",
+			SplitterVersion:   "version",
+			ExtractionVersion: "extraction",
+			Type:              "aircraft",
+			LastMod:           time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC),
+		}
+		err := q.DocumentUpdateIndexed(ctx, db.DocumentUpdateIndexedArgs{
+			Path:              path,
+			LastUpdated:       expected.LastUpdated,
+			ContentHash:       expected.ContentHash,
+			EmbeddingModel:    expected.EmbeddingModel,
+			SplitterVersion:   expected.SplitterVersion,
+			ExtractionVersion: expected.ExtractionVersion,
+			Type:              expected.Type,
+			LastMod:           expected.LastMod,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := q.DocumentUpsert(ctx, db.DocumentUpsertArgs{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(expected, doc); diff != "" {
+			t.Errorf("unexpected document (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("UpdateMetadata updates the metadata without changing the index state", func(t *testing.T) {
+		lastMod := time.Date(2024, time.October, 3, 12, 0, 0, 0, time.UTC)
+		err := q.DocumentUpdateMetadata(ctx, db.DocumentUpdateMetadataArgs{
+			Path:    path,
+			Type:    "helicopter",
+			LastMod: lastMod,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := q.DocumentUpsert(ctx, db.DocumentUpsertArgs{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Type != "helicopter" || !doc.LastMod.Equal(lastMod) {
+			t.Errorf("expected the metadata to be updated, got type %q, last modified %v", doc.Type, doc.LastMod)
+		}
+		if doc.ContentHash != "hash" {
+			t.Errorf("expected the index state to be unchanged, got content hash %q", doc.ContentHash)
+		}
+	})
+}
+
+func TestDocumentDelete(t *testing.T) {
+	forEachBackend(t, testDocumentDelete)
+}
+
+func testDocumentDelete(t *testing.T, q db.Querier) {
+	ctx := context.Background()
+	keep, remove := "/delete/keep", "/delete/remove"
+	for _, path := range []string{keep, remove} {
+		if _, err := q.DocumentUpsert(ctx, db.DocumentUpsertArgs{Path: path}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := q.DocumentFTSUpsert(ctx, db.DocumentFTSUpsertArgs{Path: path, Title: "Delete", Text: "orphan"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := q.ChunkInsert(ctx, db.ChunkInsertArgs{Chunks: []db.Chunk{{Path: path, Text: "orphan", Embedding: embedding(1)}}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: path, Triples: []db.Triple{{Subject: "Orphan", Predicate: "rdf:type", Object: "ies:Orphan"}}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	chunkOnly := "/delete/chunk-only"
+	if err := q.ChunkInsert(ctx, db.ChunkInsertArgs{Chunks: []db.Chunk{{Path: chunkOnly, Text: "orphan", Embedding: embedding(1)}}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	selectPaths := func(t *testing.T) (paths []string) {
+		t.Helper()
+		all, err := q.DocumentSelectPaths(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, path := range all {
+			if strings.HasPrefix(path, "/delete/") {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+
+	t.Run("SelectPaths includes paths that only have chunks", func(t *testing.T) {
+		if diff := cmp.Diff([]string{chunkOnly, keep, remove}, selectPaths(t)); diff != "" {
+			t.Errorf("unexpected paths (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Delete removes the document from every table", func(t *testing.T) {
+		for _, path := range []string{remove, chunkOnly} {
+			if err := q.DocumentDelete(ctx, db.DocumentDeleteArgs{Path: path}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if diff := cmp.Diff([]string{keep}, selectPaths(t)); diff != "" {
+			t.Errorf("unexpected paths (-want +got):\n%s", diff)
+		}
+		results, err := q.DocumentFTSSearch(ctx, db.DocumentFTSSearchArgs{Query: "orphan"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(results) != 1 || results[0].Path != keep {
+			t.Errorf("expected only %s to remain in the full-text index, got %v", keep, results)
+		}
+		chunks, err := q.ChunkFTSSearch(ctx, db.ChunkFTSSearchArgs{Query: "orphan", Limit: 10})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(chunks) != 1 || chunks[0].Path != keep {
+			t.Errorf("expected only the chunk of %s to remain, got %d chunks", keep, len(chunks))
+		}
+		triples, err := q.TripleSelectSubject(ctx, "Orphan")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(triples) != 1 || triples[0].Source != keep {
+			t.Errorf("expected only the triples of %s to remain, got %v", keep, triples)
+		}
+	})
+}
+
+func TestChunks(t *testing.T) {
+	forEachBackend(t, testChunks)
+}
+
+func testChunks(t *testing.T, q db.Querier) {
+	ctx := context.Background()
+	path := "/test/chunks"
+	chunks := []db.Chunk{
+		{Path: path, Index: 0, Text: "zero", Embedding: embedding(1, 0, 0)},
+		{Path: path, Index: 1, Heading: "Numbers > Odd", Text: "one", Embedding: embedding(0, 1, 0)},
+		{Path: path, Index: 2, Text: "two", Embedding: embedding(0, 0, 1)},
+	}
+
+	t.Run("Delete removes existing chunks", func(t *testing.T) {
+		if err := q.ChunkDelete(ctx, db.ChunkDeleteArgs{Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Insert can insert chunks", func(t *testing.T) {
+		if err := q.ChunkInsert(ctx, db.ChunkInsertArgs{Chunks: chunks}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Select returns chunks in order", func(t *testing.T) {
+		actual, err := q.ChunkSelect(ctx, db.ChunkSelectArgs{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(chunks, actual); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("SelectRange returns chunks within the range", func(t *testing.T) {
+		actual, err := q.ChunkSelectRange(ctx, db.ChunkSelectRangeArgs{Path: path, StartIndex: 1, EndIndex: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(chunks[1:], actual); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("SelectNearest returns the closest chunks first", func(t *testing.T) {
+		actual, err := q.ChunkSelectNearest(ctx, db.ChunkSelectNearestArgs{
+			Embedding: embedding(0, 0.9, 0.1),
+			Limit:     2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != 2 {
+			t.Fatalf("expected 2 results, got %d", len(actual))
+		}
+		if actual[0].Text != "one" || actual[1].Text != "two" {
+			t.Errorf("expected one, then two, got %q, then %q", actual[0].Text, actual[1].Text)
+		}
+		if actual[0].Distance > actual[1].Distance {
+			t.Errorf("expected results to be ordered by distance, got %v, %v", actual[0].Distance, actual[1].Distance)
+		}
+	})
+	t.Run("FTSSearch returns chunks that contain any of the terms", func(t *testing.T) {
+		actual, err := q.ChunkFTSSearch(ctx, db.ChunkFTSSearchArgs{Query: "what is two?", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(actual))
+		}
+		if diff := cmp.Diff(chunks[2], actual[0].Chunk); diff != "" {
+			t.Errorf("unexpected chunk (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Delete removes chunks and embeddings", func(t *testing.T) {
+		if err := q.ChunkDelete(ctx, db.ChunkDeleteArgs{Path: path}); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := q.ChunkSelect(ctx, db.ChunkSelectArgs{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != 0 {
+			t.Errorf("expected no chunks, got %d", len(actual))
+		}
+	})
+	t.Run("Delete removes chunks from the full-text index", func(t *testing.T) {
+		actual, err := q.ChunkFTSSearch(ctx, db.ChunkFTSSearchArgs{Query: "two", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != 0 {
+			t.Errorf("expected no chunks, got %d", len(actual))
+		}
+	})
+}
+
+func TestDocumentFTSSearch(t *testing.T) {
+	forEachBackend(t, testDocumentFTSSearch)
+}
+
+func testDocumentFTSSearch(t *testing.T, q db.Querier) {
+	ctx := context.Background()
+	docs := []db.DocumentFTSUpsertArgs{
+		{Path: "/fts/pumps", Title: "Pumps", Text: "The XR-200 pump is rated for 40 litres per minute.", Summary: "About pumps."},
+		{Path: "/fts/valves", Title: "Valves", Text: "Valves control the flow from the pumps.", Summary: "About valves."},
+		{Path: "/fts/unrelated", Title: "Unrelated", Text: "Nothing to see here.", Summary: "Nothing."},
+	}
+	for _, doc := range docs {
+		if err := q.DocumentFTSUpsert(ctx, doc); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	search := func(t *testing.T, query string) []db.DocumentFTSSearchResult {
+		t.Helper()
+		results, err := q.DocumentFTSSearch(ctx, db.DocumentFTSSearchArgs{Query: query})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return results
+	}
+	paths := func(results []db.DocumentFTSSearchResult) (paths []string) {
+		for _, r := range results {
+			paths = append(paths, r.Path)
+		}
+		return paths
+	}
+
+	t.Run("Upsert replaces the existing document", func(t *testing.T) {
+		if err := q.DocumentFTSUpsert(ctx, docs[0]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]string{"/fts/pumps"}, paths(search(t, "litres"))); diff != "" {
+			t.Errorf("unexpected paths (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Search ranks title matches first", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"/fts/pumps", "/fts/valves"}, paths(search(t, "pumps"))); diff != "" {
+			t.Errorf("unexpected paths (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Search highlights matching terms", func(t *testing.T) {
+		results := search(t, "valves")
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+		expected := db.DocumentFTSSearchResult{
+			Path:    "/fts/valves",
+			Title:   db.HighlightStart + "Valves" + db.HighlightEnd,
+			Snippet: db.HighlightStart + "Valves" + db.HighlightEnd + " control the flow from the pumps.",
+			Summary: "About valves.",
+			Rank:    results[0].Rank,
+		}
+		if diff := cmp.Diff(expected, results[0]); diff != "" {
+			t.Errorf("unexpected result (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Search terms containing fts5 syntax are matched as text", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"/fts/pumps"}, paths(search(t, `XR-200 "pump`))); diff != "" {
+			t.Errorf("unexpected paths (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Search requires all terms to match", func(t *testing.T) {
+		if results := search(t, "valves litres"); len(results) != 0 {
+			t.Errorf("expected no results, got %v", paths(results))
+		}
+	})
+	t.Run("An empty query returns no results", func(t *testing.T) {
+		if results := search(t, "  "); len(results) != 0 {
+			t.Errorf("expected no results, got %v", paths(results))
+		}
+	})
+}
+
+func TestConversations(t *testing.T) {
+	forEachBackend(t, testConversations)
+}
+
+func testConversations(t *testing.T, q db.Querier) {
+	ctx := context.Background()
+	id := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	created := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Select returns no messages for an unknown conversation", func(t *testing.T) {
+		messages, err := q.ConversationMessageSelect(ctx, db.ConversationMessageSelectArgs{ConversationID: id})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(messages) != 0 {
+			t.Errorf("expected no messages, got %v", messages)
+		}
+	})
+	t.Run("Insert creates the conversation", func(t *testing.T) {
+		err := q.ConversationMessageInsert(ctx, db.ConversationMessageInsertArgs{
+			ConversationID: id,
+			Messages: []db.ConversationMessage{
+				{Role: "user", Content: "What is the Warrior?", Created: created},
+				{Role: "assistant", Content: "An armoured vehicle.", Created: created},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("Insert appends to an existing conversation", func(t *testing.T) {
+		err := q.ConversationMessageInsert(ctx, db.ConversationMessageInsertArgs{
+			ConversationID: id,
+			Messages: []db.ConversationMessage{
+				{Role: "user", Content: "And what about the Challenger?", Created: created.Add(time.Minute)},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("Select returns the messages in order", func(t *testing.T) {
+		messages, err := q.ConversationMessageSelect(ctx, db.ConversationMessageSelectArgs{ConversationID: id})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []db.ConversationMessage{
+			{Role: "user", Content: "What is the Warrior?", Created: created},
+			{Role: "assistant", Content: "An armoured vehicle.", Created: created},
+			{Role: "user", Content: "And what about the Challenger?", Created: created.Add(time.Minute)},
+		}
+		if diff := cmp.Diff(expected, messages, cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })); diff != "" {
+			t.Errorf("unexpected messages (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestChunkFilter(t *testing.T) {
+	forEachBackend(t, testChunkFilter)
+}
+
+func testChunkFilter(t *testing.T, q db.Querier) {
+	ctx := context.Background()
+	docs := []struct {
+		path    string
+		typ     string
+		lastMod time.Time
+		rdfType string
+		text    string
+	}{
+		{path: "/filter/aircraft", text: "aircraft rotor"},
+		{path: "/filter/aircraft/apache", typ: "filter-aircraft", lastMod: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), rdfType: "ies:FilterAircraft", text: "apache rotor"},
+		{path: "/filter/aircraft/wildcat", typ: "filter-aircraft", lastMod: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC), text: "wildcat rotor"},
+		{path: "/filter/vehicles/warrior", typ: "filter-vehicle", rdfType: "ies:FilterVehicle", text: "warrior rotor"},
+	}
+	for i, doc := range docs {
+		if _, err := q.DocumentUpsert(ctx, db.DocumentUpsertArgs{Path: doc.path}); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.DocumentUpdateIndexed(ctx, db.DocumentUpdateIndexedArgs{Path: doc.path, Type: doc.typ, LastMod: doc.lastMod}); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.ChunkDelete(ctx, db.ChunkDeleteArgs{Path: doc.path}); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.ChunkInsert(ctx, db.ChunkInsertArgs{Chunks: []db.Chunk{{Path: doc.path, Text: doc.text, Embedding: embedding(0, 0, 0, 1, float32(i))}}}); err != nil {
+			t.Fatal(err)
+		}
+		var triples []db.Triple
+		if doc.rdfType != "" {
+			triples = append(triples, db.Triple{Subject: doc.path, Predicate: "rdf:type", Object: doc.rdfType, Source: doc.path})
+		}
+		if err := q.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{Source: doc.path, Triples: triples}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   db.ChunkFilter
+		expected []string
+	}{
+		{
+			name:     "path",
+			filter:   db.ChunkFilter{Path: "/filter/aircraft"},
+			expected: []string{"/filter/aircraft"},
+		},
+		{
+			name:     "path and its children",
+			filter:   db.ChunkFilter{Path: "/filter/aircraft", IncludeChildren: true},
+			expected: []string{"/filter/aircraft", "/filter/aircraft/apache", "/filter/aircraft/wildcat"},
+		},
+		{
+			name:     "path prefix",
+			filter:   db.ChunkFilter{PathPrefix: "/filter/aircraft/"},
+			expected: []string{"/filter/aircraft/apache", "/filter/aircraft/wildcat"},
+		},
+		{
+			name:     "type",
+			filter:   db.ChunkFilter{PathPrefix: "/filter/", Type: "filter-vehicle"},
+			expected: []string{"/filter/vehicles/warrior"},
+		},
+		{
+			name:     "last modified range",
+			filter:   db.ChunkFilter{PathPrefix: "/filter/", LastModFrom: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)},
+			expected: []string{"/filter/aircraft/wildcat"},
+		},
+		{
+			name:     "documents without a last modified time don't match a range",
+			filter:   db.ChunkFilter{PathPrefix: "/filter/", LastModTo: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)},
+			expected: []string{"/filter/aircraft/apache"},
+		},
+		{
+			name:     "rdf types",
+			filter:   db.ChunkFilter{RDFTypes: []string{"ies:FilterAircraft", "ies:FilterVehicle"}},
+			expected: []string{"/filter/aircraft/apache", "/filter/vehicles/warrior"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run("SelectNearest filters by "+tt.name, func(t *testing.T) {
+			results, err := q.ChunkSelectNearest(ctx, db.ChunkSelectNearestArgs{Embedding: embedding(0, 0, 0, 1), Limit: 10, Filter: tt.filter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, r := range results {
+				actual = append(actual, r.Path)
+			}
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("unexpected paths (-want +got):\n%s", diff)
+			}
+		})
+		t.Run("FTSSearch filters by "+tt.name, func(t *testing.T) {
+			results, err := q.ChunkFTSSearch(ctx, db.ChunkFTSSearchArgs{Query: "rotor", Limit: 10, Filter: tt.filter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, r := range results {
+				actual = append(actual, r.Path)
+			}
+			slices.Sort(actual)
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("unexpected paths (-want +got):\n%s", diff)
+			}
+		})
+	}
 }
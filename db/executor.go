@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rqlite/gorqlite"
+)
+
+type statement struct {
+	Query     string
+	Arguments []any
+}
+
+type rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	// Err returns the error, if any, that stopped iteration.
+	Err() error
+	Close() error
+}
+
+// executor runs statements against either rqlite or an embedded SQLite database.
+type executor interface {
+	query(ctx context.Context, stmt statement) (rows, error)
+	// write executes the statements in a single transaction.
+	write(ctx context.Context, stmts ...statement) error
+}
+
+type rqliteExecutor struct {
+	conn *gorqlite.Connection
+}
+
+type rqliteRows struct {
+	gorqlite.QueryResult
+}
+
+func (r *rqliteRows) Err() error {
+	return r.QueryResult.Err
+}
+
+func (r *rqliteRows) Close() error {
+	return nil
+}
+
+func (e rqliteExecutor) query(ctx context.Context, stmt statement) (rows, error) {
+	result, err := e.conn.QueryOneParameterizedContext(ctx, gorqlite.ParameterizedStatement{
+		Query:     stmt.Query,
+		Arguments: stmt.Arguments,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rqliteRows{QueryResult: result}, nil
+}
+
+func (e rqliteExecutor) write(ctx context.Context, stmts ...statement) error {
+	statements := make([]gorqlite.ParameterizedStatement, len(stmts))
+	for i, stmt := range stmts {
+		statements[i] = gorqlite.ParameterizedStatement{
+			Query:     stmt.Query,
+			Arguments: stmt.Arguments,
+		}
+	}
+	_, err := e.conn.WriteParameterizedContext(ctx, statements)
+	return err
+}
+
+type sqlExecutor struct {
+	db *sql.DB
+}
+
+// sqlRows closes the underlying rows when iteration is complete, to match
+// the behaviour of gorqlite, where results are read into memory. Errors that
+// stop iteration are returned by Err, even after the rows are closed.
+type sqlRows struct {
+	*sql.Rows
+}
+
+func (r sqlRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.Rows.Close()
+	return false
+}
+
+func (e sqlExecutor) query(ctx context.Context, stmt statement) (rows, error) {
+	r, err := e.db.QueryContext(ctx, stmt.Query, stmt.Arguments...)
+	if err != nil {
+		return nil, err
+	}
+	return sqlRows{Rows: r}, nil
+}
+
+func (e sqlExecutor) write(ctx context.Context, stmts ...statement) (err error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range stmts {
+		if _, err = tx.ExecContext(ctx, stmt.Query, stmt.Arguments...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
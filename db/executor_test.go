@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLRows(t *testing.T) {
+	sqlDB, err := OpenSQLite(filepath.Join(t.TempDir(), "ragmark.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	e := sqlExecutor{db: sqlDB}
+
+	t.Run("errors during iteration are returned by Err", func(t *testing.T) {
+		// The second row isn't valid JSON, so it fails when it's read.
+		r, err := e.query(context.Background(), statement{
+			Query: `select json_extract(v, '$.a') from (select '{"a":"value"}' as v union all select 'invalid')`,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer r.Close()
+		var values []string
+		for r.Next() {
+			var v string
+			if err = r.Scan(&v); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			values = append(values, v)
+		}
+		if len(values) != 1 {
+			t.Errorf("expected 1 value before the error, got %v", values)
+		}
+		if err = r.Err(); err == nil || !strings.Contains(err.Error(), "JSON") {
+			t.Errorf("expected a JSON error, got %v", err)
+		}
+	})
+}
+
+// failingExecutor returns rows that stop with an error.
+type failingExecutor struct {
+	err error
+}
+
+func (e failingExecutor) query(ctx context.Context, stmt statement) (rows, error) {
+	return failingRows{err: e.err}, nil
+}
+
+func (e failingExecutor) write(ctx context.Context, stmts ...statement) error {
+	return nil
+}
+
+type failingRows struct {
+	err error
+}
+
+func (r failingRows) Next() bool             { return false }
+func (r failingRows) Scan(dest ...any) error { return nil }
+func (r failingRows) Err() error             { return r.err }
+func (r failingRows) Close() error           { return nil }
+
+func TestQueriesReturnIterationErrors(t *testing.T) {
+	ctx := context.Background()
+	expected := errors.New("disk I/O error")
+	q := &Queries{db: failingExecutor{err: expected}}
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{
+			name: "DocumentUpsert",
+			run: func() error {
+				_, err := q.DocumentUpsert(ctx, DocumentUpsertArgs{Path: "/a"})
+				return err
+			},
+		},
+		{
+			name: "DocumentFTSSearch",
+			run: func() error {
+				_, err := q.DocumentFTSSearch(ctx, DocumentFTSSearchArgs{Query: "a"})
+				return err
+			},
+		},
+		{
+			name: "ChunkSelectNearest",
+			run: func() error {
+				_, err := q.ChunkSelectNearest(ctx, ChunkSelectNearestArgs{Embedding: []float32{1}})
+				return err
+			},
+		},
+		{
+			name: "TripleSelectAll",
+			run: func() error {
+				_, err := q.TripleSelectAll(ctx)
+				return err
+			},
+		},
+		{
+			name: "ConversationMessageSelect",
+			run: func() error {
+				_, err := q.ConversationMessageSelect(ctx, ConversationMessageSelectArgs{ConversationID: "a"})
+				return err
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.run(); !errors.Is(err, expected) {
+				t.Errorf("expected %v, got %v", expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// ChunkFilter restricts search to the chunks of documents that match all of its fields.
+// The zero value matches every chunk.
+type ChunkFilter struct {
+	// Path matches the document with the path, e.g. /aircraft/apache.
+	Path string
+	// IncludeChildren also matches the documents below Path, e.g. /aircraft/apache/armament.
+	IncludeChildren bool
+	// PathPrefix matches documents whose path starts with the prefix, e.g. /aircraft/.
+	PathPrefix string
+	// Type matches documents with the type in their metadata, e.g. aircraft.
+	Type string
+	// LastModFrom and LastModTo match documents last modified within the range, inclusive.
+	// If either is zero, the range is open at that end. Documents without a last modified
+	// time don't match a range.
+	LastModFrom time.Time
+	LastModTo   time.Time
+	// RDFTypes matches documents that are the source of an rdf:type triple with any of the
+	// types as its object, e.g. ies:Aircraft.
+	RDFTypes []string
+}
+
+// IsZero returns true if the filter matches every chunk.
+func (f ChunkFilter) IsZero() bool {
+	return f.Path == "" && f.PathPrefix == "" && f.Type == "" && f.LastModFrom.IsZero() && f.LastModTo.IsZero() && len(f.RDFTypes) == 0
+}
+
+// where returns the SQL conditions of the filter, on the chunk table with the given alias,
+// joined with "and", or "1 = 1" if the filter is empty.
+func (f ChunkFilter) where(chunk string) (sql string, args []any) {
+	var conditions []string
+	if f.Path != "" && f.IncludeChildren {
+		conditions = append(conditions, "("+chunk+".path = ? or instr("+chunk+".path, ?) = 1)")
+		args = append(args, f.Path, strings.TrimSuffix(f.Path, "/")+"/")
+	} else if f.Path != "" {
+		conditions = append(conditions, chunk+".path = ?")
+		args = append(args, f.Path)
+	}
+	if f.PathPrefix != "" {
+		conditions = append(conditions, "instr("+chunk+".path, ?) = 1")
+		args = append(args, f.PathPrefix)
+	}
+	var document []string
+	if f.Type != "" {
+		document = append(document, "d.type = ?")
+		args = append(args, f.Type)
+	}
+	if !f.LastModFrom.IsZero() {
+		document = append(document, "d.last_mod >= ?")
+		args = append(args, unixSeconds(f.LastModFrom))
+	}
+	if !f.LastModTo.IsZero() {
+		document = append(document, "d.last_mod <= ?")
+		args = append(args, unixSeconds(f.LastModTo))
+	}
+	if !f.LastModFrom.IsZero() || !f.LastModTo.IsZero() {
+		document = append(document, "d.last_mod != 0")
+	}
+	if len(document) > 0 {
+		conditions = append(conditions, `exists (select 1 from document d where d.path = `+chunk+`.path and `+strings.Join(document, " and ")+`)`)
+	}
+	if len(f.RDFTypes) > 0 {
+		conditions = append(conditions, `exists (select 1 from triple t where t.source = `+chunk+`.path and t.predicate = 'rdf:type' and t.object in (`+strings.TrimSuffix(strings.Repeat("?, ", len(f.RDFTypes)), ", ")+`))`)
+		for _, t := range f.RDFTypes {
+			args = append(args, t)
+		}
+	}
+	if len(conditions) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(conditions, " and "), args
+}
+
+// unixSeconds returns the time in seconds since the Unix epoch, or zero for the zero time.
+func unixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// fromUnixSeconds returns the time of the seconds since the Unix epoch, or the zero time for
+// zero.
+func fromUnixSeconds(s int64) time.Time {
+	if s == 0 {
+		return time.Time{}
+	}
+	return time.Unix(s, 0).UTC()
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"embed"
 	"fmt"
 	"net/url"
@@ -63,3 +64,23 @@ func Migrate(u URL) (err error) {
 	}
 	return nil
 }
+
+// MigrateSQLite runs the migrations against an embedded SQLite database, see OpenSQLite.
+func MigrateSQLite(db *sql.DB) (err error) {
+	srcDriver, err := iofs.New(fs, "migrations")
+	if err != nil {
+		return fmt.Errorf("db: migrate failed to create iofs: %w", err)
+	}
+	dbDriver, err := newSQLiteMigrateDriver(db)
+	if err != nil {
+		return fmt.Errorf("db: migrate failed to create sqlite driver: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", srcDriver, "sqlite3", dbDriver)
+	if err != nil {
+		return fmt.Errorf("db: migrate failed to create source instance: %w", err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("db: migrate up failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// sqliteMigrationsTable is the table that golang-migrate uses to record the schema version.
+const sqliteMigrationsTable = "schema_migrations"
+
+// sqliteMigrateDriver is a golang-migrate database driver for a database opened with
+// OpenSQLite. golang-migrate's sqlite3 driver can't be used, because it registers the cgo
+// SQLite driver with database/sql under the same name.
+type sqliteMigrateDriver struct {
+	db     *sql.DB
+	locked atomic.Bool
+}
+
+var _ database.Driver = &sqliteMigrateDriver{}
+
+func newSQLiteMigrateDriver(db *sql.DB) (d *sqliteMigrateDriver, err error) {
+	d = &sqliteMigrateDriver{db: db}
+	_, err = db.Exec(`create table if not exists ` + sqliteMigrationsTable + ` (version uint64, dirty bool);
+		create unique index if not exists version_unique on ` + sqliteMigrationsTable + ` (version);`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	return d, nil
+}
+
+func (d *sqliteMigrateDriver) Open(url string) (database.Driver, error) {
+	return nil, errors.New("db: the sqlite migration driver can only be used with an open database")
+}
+
+func (d *sqliteMigrateDriver) Close() error {
+	return nil
+}
+
+func (d *sqliteMigrateDriver) Lock() error {
+	if !d.locked.CompareAndSwap(false, true) {
+		return database.ErrLocked
+	}
+	return nil
+}
+
+func (d *sqliteMigrateDriver) Unlock() error {
+	if !d.locked.CompareAndSwap(true, false) {
+		return database.ErrNotLocked
+	}
+	return nil
+}
+
+func (d *sqliteMigrateDriver) Run(migration io.Reader) (err error) {
+	query, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(string(query)); err != nil {
+		return &database.Error{OrigErr: err, Query: query}
+	}
+	if err = tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+func (d *sqliteMigrateDriver) SetVersion(version int, dirty bool) (err error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction start failed"}
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`delete from ` + sqliteMigrationsTable); err != nil {
+		return &database.Error{OrigErr: err, Err: "failed to delete version"}
+	}
+	// Record nil versions if they're dirty, so that a failed first migration isn't lost.
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		if _, err = tx.Exec(`insert into `+sqliteMigrationsTable+` (version, dirty) values (?, ?)`, version, dirty); err != nil {
+			return &database.Error{OrigErr: err, Err: "failed to insert version"}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return &database.Error{OrigErr: err, Err: "transaction commit failed"}
+	}
+	return nil
+}
+
+func (d *sqliteMigrateDriver) Version() (version int, dirty bool, err error) {
+	err = d.db.QueryRow(`select version, dirty from `+sqliteMigrationsTable+` limit 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.NilVersion, false, nil
+	}
+	if err != nil {
+		return database.NilVersion, false, &database.Error{OrigErr: err, Err: "failed to get version"}
+	}
+	return version, dirty, nil
+}
+
+func (d *sqliteMigrateDriver) Drop() (err error) {
+	rows, err := d.db.Query(`select name from sqlite_master where type = 'table' and name not like 'sqlite_%'`)
+	if err != nil {
+		return &database.Error{OrigErr: err, Err: "failed to list tables"}
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if _, err = d.db.Exec(`drop table if exists "` + t + `"`); err != nil {
+			return &database.Error{OrigErr: err, Err: "failed to drop table " + t}
+		}
+	}
+	return nil
+}
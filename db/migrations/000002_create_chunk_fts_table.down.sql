@@ -0,0 +1,4 @@
+drop trigger chunk_fts_update;
+drop trigger chunk_fts_delete;
+drop trigger chunk_fts_insert;
+drop table chunk_fts;
@@ -0,0 +1,25 @@
+-- Create full-text search index over chunk text, to find exact terms, e.g. part
+-- numbers and acronyms, that are poorly represented by embeddings.
+-- The index uses the chunk table as its external content, so the text isn't stored twice.
+create virtual table chunk_fts using fts5(
+    text,
+    content='chunk',
+    content_rowid='rowid'
+);
+
+-- Keep the index up-to-date as chunks are inserted, updated and deleted.
+create trigger chunk_fts_insert after insert on chunk begin
+    insert into chunk_fts (rowid, text) values (new.rowid, new.text);
+end;
+
+create trigger chunk_fts_delete after delete on chunk begin
+    insert into chunk_fts (chunk_fts, rowid, text) values ('delete', old.rowid, old.text);
+end;
+
+create trigger chunk_fts_update after update on chunk begin
+    insert into chunk_fts (chunk_fts, rowid, text) values ('delete', old.rowid, old.text);
+    insert into chunk_fts (rowid, text) values (new.rowid, new.text);
+end;
+
+-- Index the existing chunks.
+insert into chunk_fts (chunk_fts) values ('rebuild');
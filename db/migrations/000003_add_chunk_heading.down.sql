@@ -0,0 +1 @@
+alter table chunk drop column heading;
@@ -0,0 +1,2 @@
+-- The heading is the breadcrumb of headings that the chunk is within, e.g. "Install > Linux".
+alter table chunk add column heading text not null default '';
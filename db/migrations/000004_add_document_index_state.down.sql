@@ -0,0 +1,3 @@
+alter table document drop column splitter_version;
+alter table document drop column embedding_model;
+alter table document drop column content_hash;
@@ -0,0 +1,8 @@
+-- The index state of the document, used to skip documents that haven't changed since
+-- they were last indexed.
+-- content_hash is a hash of the document's content.
+-- embedding_model is the name of the model used to create the chunk embeddings.
+-- splitter_version identifies the splitter and options used to create the chunks.
+alter table document add column content_hash text not null default '';
+alter table document add column embedding_model text not null default '';
+alter table document add column splitter_version text not null default '';
@@ -0,0 +1,5 @@
+delete from triple where source != '';
+drop index triple_unique;
+create unique index triple_unique on triple(subject, predicate, object);
+drop index triple_source;
+alter table triple drop column source;
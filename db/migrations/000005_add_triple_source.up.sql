@@ -0,0 +1,11 @@
+-- The source of a triple is the path of the document that it was extracted from, so
+-- that a document's triples can be replaced when it's indexed again, and removed when
+-- the document is deleted. Triples that weren't extracted from a document have an
+-- empty source.
+alter table triple add column source text generated always as (coalesce(json_extract(triple, '$.src'), '')) virtual not null;
+
+create index triple_source on triple(source);
+
+-- The same statement can be extracted from more than one document.
+drop index triple_unique;
+create unique index triple_unique on triple(subject, predicate, object, source);
@@ -0,0 +1 @@
+alter table document drop column extraction_version;
@@ -0,0 +1,3 @@
+-- extraction_version identifies the chat model, prompts and options used to extract the
+-- document's triples, so that they're extracted again when any of them change.
+alter table document add column extraction_version text not null default '';
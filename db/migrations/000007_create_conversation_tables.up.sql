@@ -0,0 +1,17 @@
+-- A conversation is a series of chat messages, so that follow-up questions can be
+-- answered using the earlier messages.
+create table conversation(
+    id text not null primary key,
+    created timestamp not null,
+    updated timestamp not null
+);
+
+-- The idx column orders the messages in the conversation. The role is user or assistant.
+create table conversation_message(
+    conversation_id text not null,
+    idx integer not null,
+    role text not null,
+    content text not null,
+    created timestamp not null,
+    primary key (conversation_id, idx)
+);
@@ -0,0 +1,3 @@
+drop index document_type;
+alter table document drop column last_mod;
+alter table document drop column type;
@@ -0,0 +1,8 @@
+-- The frontmatter of the document, used to filter the chunks that are searched.
+-- type is the type of the document's metadata, e.g. "aircraft".
+-- last_mod is the last modified time of the document's metadata, in seconds since the
+-- Unix epoch, or zero if it isn't set, so that it can be compared as a number.
+alter table document add column type text not null default '';
+alter table document add column last_mod integer not null default 0;
+
+create index document_type on document(type);
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TriplePattern matches triples. Terms that start with ? are variables, e.g. ?vehicle, which
+// are bound to the matching subject, predicate or object. Other terms must match exactly.
+type TriplePattern struct {
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Object    string `json:"object"`
+	// Path matches chains of triples with the predicate, e.g. rdfs:subClassOf, instead of a
+	// single triple. The predicate can't be a variable.
+	Path TriplePath `json:"path,omitempty"`
+}
+
+type TriplePath string
+
+const (
+	// PathOne matches a single triple.
+	PathOne TriplePath = ""
+	// PathOneOrMore matches chains of one or more triples, like + in SPARQL.
+	PathOneOrMore TriplePath = "+"
+	// PathZeroOrMore also matches the subject or object to itself, like * in SPARQL, so that
+	// ?class rdfs:subClassOf* ies:Vehicle includes ies:Vehicle. The subject or object must not
+	// be a variable.
+	PathZeroOrMore TriplePath = "*"
+)
+
+type TripleFilterOperator string
+
+const (
+	FilterEqual    TripleFilterOperator = "="
+	FilterNotEqual TripleFilterOperator = "!="
+	FilterIn       TripleFilterOperator = "in"
+	FilterNotIn    TripleFilterOperator = "not in"
+	FilterPrefix   TripleFilterOperator = "prefix"
+)
+
+// TripleFilter restricts the values of a variable, e.g. {?p in [ies:isPartOf ies:nearTo]}.
+type TripleFilter struct {
+	Variable string               `json:"variable"`
+	Operator TripleFilterOperator `json:"operator"`
+	Values   []string             `json:"values"`
+}
+
+const (
+	DefaultTripleQueryLimit = 100
+	maxTripleQueryLimit     = 1000
+	maxTriplePatterns       = 10
+)
+
+type TripleQueryArgs struct {
+	// Patterns must all match. Patterns that share a variable are joined on its value.
+	Patterns []TriplePattern `json:"patterns"`
+	Filters  []TripleFilter  `json:"filters,omitempty"`
+	// Limit is the maximum number of results, defaults to DefaultTripleQueryLimit.
+	Limit int `json:"limit,omitempty"`
+}
+
+var variablePattern = regexp.MustCompile(`^\?[A-Za-z_][A-Za-z0-9_]*$`)
+
+func isVariable(term string) bool {
+	return strings.HasPrefix(term, "?")
+}
+
+// Validate returns an error if the query can't be run.
+func (args TripleQueryArgs) Validate() (err error) {
+	if len(args.Patterns) == 0 {
+		return fmt.Errorf("a query must have at least one pattern")
+	}
+	if len(args.Patterns) > maxTriplePatterns {
+		return fmt.Errorf("a query can't have more than %d patterns", maxTriplePatterns)
+	}
+	if args.Limit < 0 || args.Limit > maxTripleQueryLimit {
+		return fmt.Errorf("the limit must be between 0 and %d", maxTripleQueryLimit)
+	}
+	variables := map[string]bool{}
+	for i, p := range args.Patterns {
+		for _, term := range []string{p.Subject, p.Predicate, p.Object} {
+			if term == "" {
+				return fmt.Errorf("pattern %d: the subject, predicate and object must not be empty", i+1)
+			}
+			if !isVariable(term) {
+				continue
+			}
+			if !variablePattern.MatchString(term) {
+				return fmt.Errorf("pattern %d: invalid variable name %q", i+1, term)
+			}
+			variables[term] = true
+		}
+		switch p.Path {
+		case PathOne:
+		case PathOneOrMore, PathZeroOrMore:
+			if isVariable(p.Predicate) {
+				return fmt.Errorf("pattern %d: the predicate of a path must not be a variable", i+1)
+			}
+			if p.Path == PathZeroOrMore && isVariable(p.Subject) && isVariable(p.Object) {
+				return fmt.Errorf("pattern %d: the subject or object of a zero or more path must not be a variable", i+1)
+			}
+		default:
+			return fmt.Errorf("pattern %d: unknown path %q, expected +, * or empty", i+1, p.Path)
+		}
+	}
+	if len(variables) == 0 {
+		return fmt.Errorf("a query must have at least one variable")
+	}
+	for _, f := range args.Filters {
+		if !variables[f.Variable] {
+			return fmt.Errorf("filter on %q: the variable isn't used in a pattern", f.Variable)
+		}
+		switch f.Operator {
+		case FilterEqual, FilterNotEqual, FilterPrefix:
+			if len(f.Values) != 1 {
+				return fmt.Errorf("filter on %q: the %s operator needs one value", f.Variable, f.Operator)
+			}
+		case FilterIn, FilterNotIn:
+			if len(f.Values) == 0 {
+				return fmt.Errorf("filter on %q: the %s operator needs at least one value", f.Variable, f.Operator)
+			}
+		default:
+			return fmt.Errorf("filter on %q: unknown operator %q", f.Variable, f.Operator)
+		}
+	}
+	return nil
+}
+
+type TripleQueryResult struct {
+	// Variables are the names of the variables without the ? prefix, in the order that they
+	// first appear in the patterns.
+	Variables []string `json:"variables"`
+	// Bindings are the distinct values of the variables that match the patterns.
+	Bindings []map[string]string `json:"bindings"`
+}
+
+// TripleQuery finds the values of the variables in the patterns, e.g. the subclasses of
+// ies:Vehicle and their instances:
+//
+//	?class rdfs:subClassOf* ies:Vehicle
+//	?vehicle rdf:type ?class
+func (q *Queries) TripleQuery(ctx context.Context, args TripleQueryArgs) (result TripleQueryResult, err error) {
+	if err = args.Validate(); err != nil {
+		return result, fmt.Errorf("invalid query: %w", err)
+	}
+	stmt, variables := compileTripleQuery(args)
+	rows, err := q.db.query(ctx, stmt)
+	if err != nil {
+		return result, fmt.Errorf("failed to query triples: %w", err)
+	}
+	defer rows.Close()
+	for _, v := range variables {
+		result.Variables = append(result.Variables, strings.TrimPrefix(v, "?"))
+	}
+	values := make([]string, len(variables))
+	dest := make([]any, len(variables))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return result, fmt.Errorf("failed to scan triple query result: %w", err)
+		}
+		binding := make(map[string]string, len(variables))
+		for i, name := range result.Variables {
+			binding[name] = values[i]
+		}
+		result.Bindings = append(result.Bindings, binding)
+	}
+	if err = rows.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// compileTripleQuery joins a copy of the triple table for each pattern. Paths are recursive
+// common table expressions that start from the pattern's subject or object, if they're
+// constants, so that the closure of the whole graph isn't computed.
+func compileTripleQuery(args TripleQueryArgs) (stmt statement, variables []string) {
+	var ctes, from, where []string
+	var cteArgs, whereArgs []any
+	columns := map[string]string{}
+	bind := func(term, column string) {
+		if !isVariable(term) {
+			where = append(where, column+" = ?")
+			whereArgs = append(whereArgs, term)
+			return
+		}
+		if existing, ok := columns[term]; ok {
+			where = append(where, column+" = "+existing)
+			return
+		}
+		columns[term] = column
+		variables = append(variables, term)
+	}
+	for i, p := range args.Patterns {
+		alias := fmt.Sprintf("t%d", i)
+		if p.Path == PathOne {
+			from = append(from, "triple "+alias)
+			bind(p.Subject, alias+".subject")
+			bind(p.Predicate, alias+".predicate")
+			bind(p.Object, alias+".object")
+			continue
+		}
+		name := fmt.Sprintf("path%d", i)
+		var seed, step string
+		var seedArgs []any
+		switch {
+		case !isVariable(p.Subject):
+			seed = `select subject, object from triple where predicate = ? and subject = ?`
+			seedArgs = []any{p.Predicate, p.Subject}
+			step = `select c.subject, t.object from ` + name + ` c join triple t on t.subject = c.object and t.predicate = ?`
+			if p.Path == PathZeroOrMore {
+				seed += ` union select ?, ?`
+				seedArgs = append(seedArgs, p.Subject, p.Subject)
+			}
+		case !isVariable(p.Object):
+			seed = `select subject, object from triple where predicate = ? and object = ?`
+			seedArgs = []any{p.Predicate, p.Object}
+			step = `select t.subject, c.object from ` + name + ` c join triple t on t.object = c.subject and t.predicate = ?`
+			if p.Path == PathZeroOrMore {
+				seed += ` union select ?, ?`
+				seedArgs = append(seedArgs, p.Object, p.Object)
+			}
+		default:
+			seed = `select subject, object from triple where predicate = ?`
+			seedArgs = []any{p.Predicate}
+			step = `select c.subject, t.object from ` + name + ` c join triple t on t.subject = c.object and t.predicate = ?`
+		}
+		// union, rather than union all, removes duplicates, so cycles terminate.
+		ctes = append(ctes, name+`(subject, object) as (`+seed+` union `+step+`)`)
+		cteArgs = append(cteArgs, seedArgs...)
+		cteArgs = append(cteArgs, p.Predicate)
+		from = append(from, name+" "+alias)
+		bind(p.Subject, alias+".subject")
+		bind(p.Object, alias+".object")
+	}
+	for _, f := range args.Filters {
+		column := columns[f.Variable]
+		switch f.Operator {
+		case FilterEqual, FilterNotEqual:
+			where = append(where, column+" "+string(f.Operator)+" ?")
+		case FilterPrefix:
+			where = append(where, "instr("+column+", ?) = 1")
+		case FilterIn, FilterNotIn:
+			where = append(where, column+" "+string(f.Operator)+" ("+strings.TrimSuffix(strings.Repeat("?, ", len(f.Values)), ", ")+")")
+		}
+		for _, v := range f.Values {
+			whereArgs = append(whereArgs, v)
+		}
+	}
+
+	var sb strings.Builder
+	if len(ctes) > 0 {
+		sb.WriteString("with recursive " + strings.Join(ctes, ", ") + " ")
+	}
+	selected := make([]string, len(variables))
+	order := make([]string, len(variables))
+	for i, v := range variables {
+		selected[i] = columns[v]
+		order[i] = fmt.Sprintf("%d", i+1)
+	}
+	sb.WriteString("select distinct " + strings.Join(selected, ", "))
+	sb.WriteString(" from " + strings.Join(from, ", "))
+	if len(where) > 0 {
+		sb.WriteString(" where " + strings.Join(where, " and "))
+	}
+	sb.WriteString(" order by " + strings.Join(order, ", ") + " limit ?")
+	limit := args.Limit
+	if limit == 0 {
+		limit = DefaultTripleQueryLimit
+	}
+	stmt.Query = sb.String()
+	stmt.Arguments = append(append(cteArgs, whereArgs...), limit)
+	return stmt, variables
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "github.com/asg017/sqlite-vec-go-bindings/ncruces"
+	_ "github.com/ncruces/go-sqlite3/driver"
+)
+
+// OpenSQLite opens the SQLite database file at path, creating it if it doesn't exist.
+//
+// SQLite is compiled to WebAssembly with the sqlite-vec and FTS5 extensions, so it doesn't
+// require cgo or build tags.
+func OpenSQLite(path string) (db *sql.DB, err error) {
+	q := url.Values{}
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "journal_mode(wal)")
+	// Take the write lock at the start of each transaction, so that concurrent writers
+	// wait for the busy timeout instead of failing when they upgrade a read lock.
+	q.Set("_txlock", "immediate")
+	db, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?%s", path, q.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("db: failed to open sqlite database: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,21 @@
+package db_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+)
+
+func newSQLiteQueries(t *testing.T) db.Querier {
+	t.Helper()
+	sqlDB, err := db.OpenSQLite(filepath.Join(t.TempDir(), "ragmark.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err = db.MigrateSQLite(sqlDB); err != nil {
+		t.Fatalf("failed to migrate sqlite database: %v", err)
+	}
+	return db.NewSQLite(sqlDB)
+}
@@ -0,0 +1,190 @@
+// Package graph serves pages that show the contents of the triple store.
+package graph
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/prompts"
+	"github.com/a-h/ragmark/site"
+	"github.com/a-h/ragmark/templates"
+	"github.com/a-h/templ"
+)
+
+const (
+	typePredicate = "rdf:type"
+	classRoot     = "rdfs:Class"
+)
+
+func NewIndexHandler(log *slog.Logger, s *site.Site, queries db.Querier) IndexHandler {
+	return IndexHandler{
+		Log:     log,
+		Site:    s,
+		queries: queries,
+	}
+}
+
+// IndexHandler renders the entities in the graph, grouped by their rdf:type, e.g. /graph.
+// Add format=json to the query string to return JSON.
+type IndexHandler struct {
+	Log     *slog.Logger
+	Site    *site.Site
+	queries db.Querier
+}
+
+type IndexResponse struct {
+	Classes []templates.GraphClass `json:"classes"`
+}
+
+func (h IndexHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	triples, err := h.queries.TripleSelectPredicate(r.Context(), typePredicate)
+	if err != nil {
+		h.Log.Error("failed to select types", slog.Any("error", err))
+		http.Error(w, "failed to select types", http.StatusInternalServerError)
+		return
+	}
+	hierarchy, err := prompts.TypeHierarchy()
+	if err != nil {
+		h.Log.Error("failed to load type hierarchy", slog.Any("error", err))
+		http.Error(w, "failed to load type hierarchy", http.StatusInternalServerError)
+		return
+	}
+	classes := groupByClass(triples, func(class string) []string {
+		return hierarchy.Path(class, classRoot)
+	})
+	if isJSON(r) {
+		writeJSON(w, IndexResponse{Classes: nonNil(classes)})
+		return
+	}
+	render(w, r, h.Site, templates.GraphIndex(classes))
+}
+
+// groupByClass groups the subjects of the rdf:type triples by their class. Classes are
+// sorted by their path in the type hierarchy, so that related classes are together.
+func groupByClass(triples []db.Triple, path func(class string) []string) (classes []templates.GraphClass) {
+	classIndex := map[string]int{}
+	memberIndex := map[[2]string]int{}
+	for _, t := range triples {
+		ci, ok := classIndex[t.Object]
+		if !ok {
+			ci = len(classes)
+			classIndex[t.Object] = ci
+			classes = append(classes, templates.GraphClass{Class: t.Object, Path: path(t.Object)})
+		}
+		c := &classes[ci]
+		mi, ok := memberIndex[[2]string{t.Object, t.Subject}]
+		if !ok {
+			mi = len(c.Entities)
+			memberIndex[[2]string{t.Object, t.Subject}] = mi
+			c.Entities = append(c.Entities, templates.GraphClassMember{Entity: t.Subject})
+		}
+		m := &c.Entities[mi]
+		if t.Source != "" && !slices.Contains(m.Sources, t.Source) {
+			m.Sources = append(m.Sources, t.Source)
+		}
+	}
+	for _, c := range classes {
+		slices.SortFunc(c.Entities, func(a, b templates.GraphClassMember) int {
+			return strings.Compare(a.Entity, b.Entity)
+		})
+	}
+	slices.SortFunc(classes, func(a, b templates.GraphClass) int {
+		// Classes that aren't in the hierarchy are last.
+		if (len(a.Path) == 0) != (len(b.Path) == 0) {
+			return cmp.Compare(len(b.Path), len(a.Path))
+		}
+		return slices.Compare(a.Path, b.Path)
+	})
+	return classes
+}
+
+func NewEntityHandler(log *slog.Logger, s *site.Site, queries db.Querier) EntityHandler {
+	return EntityHandler{
+		Log:     log,
+		Site:    s,
+		queries: queries,
+	}
+}
+
+// EntityHandler renders the triples of an entity, e.g. /graph/entity?id=Apache.
+// Add format=json to the query string to return JSON.
+type EntityHandler struct {
+	Log     *slog.Logger
+	Site    *site.Site
+	queries db.Querier
+}
+
+type EntityResponse struct {
+	Entity   string      `json:"entity"`
+	Outgoing []db.Triple `json:"outgoing"`
+	Incoming []db.Triple `json:"incoming"`
+}
+
+func (h EntityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	entity := r.URL.Query().Get("id")
+	if entity == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	outgoing, err := h.queries.TripleSelectSubject(r.Context(), entity)
+	if err != nil {
+		h.Log.Error("failed to select outgoing triples", slog.String("entity", entity), slog.Any("error", err))
+		http.Error(w, "failed to select triples", http.StatusInternalServerError)
+		return
+	}
+	incoming, err := h.queries.TripleSelectObject(r.Context(), entity)
+	if err != nil {
+		h.Log.Error("failed to select incoming triples", slog.String("entity", entity), slog.Any("error", err))
+		http.Error(w, "failed to select triples", http.StatusInternalServerError)
+		return
+	}
+	// Classes are valid entities, even if nothing has been classified with them yet.
+	if len(outgoing) == 0 && len(incoming) == 0 && !isClass(entity) {
+		http.Error(w, "entity not found", http.StatusNotFound)
+		return
+	}
+	if isJSON(r) {
+		writeJSON(w, EntityResponse{Entity: entity, Outgoing: nonNil(outgoing), Incoming: nonNil(incoming)})
+		return
+	}
+	render(w, r, h.Site, templates.GraphEntity(entity, outgoing, incoming))
+}
+
+func isClass(entity string) bool {
+	hierarchy, err := prompts.TypeHierarchy()
+	return err == nil && hierarchy.IsA(entity, classRoot)
+}
+
+func isJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json"
+}
+
+// nonNil returns an empty slice instead of nil, so that it's encoded as an empty JSON array.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func render(w http.ResponseWriter, r *http.Request, s *site.Site, middle templ.Component) {
+	left := templates.Left(s)
+	right := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		return nil
+	})
+	templ.Handler(templates.Page(left, middle, right)).ServeHTTP(w, r)
+}
@@ -0,0 +1,198 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/graph"
+	"github.com/a-h/ragmark/templates"
+	"github.com/google/go-cmp/cmp"
+)
+
+type querier struct {
+	db.Querier
+	triples []db.Triple
+}
+
+func (q querier) selectTriples(match func(t db.Triple) bool) (triples []db.Triple) {
+	for _, t := range q.triples {
+		if match(t) {
+			triples = append(triples, t)
+		}
+	}
+	return triples
+}
+
+func (q querier) TripleSelectSubject(ctx context.Context, subject string) ([]db.Triple, error) {
+	return q.selectTriples(func(t db.Triple) bool { return t.Subject == subject }), nil
+}
+
+func (q querier) TripleSelectObject(ctx context.Context, object string) ([]db.Triple, error) {
+	return q.selectTriples(func(t db.Triple) bool { return t.Object == object }), nil
+}
+
+func (q querier) TripleSelectPredicate(ctx context.Context, predicate string) ([]db.Triple, error) {
+	return q.selectTriples(func(t db.Triple) bool { return t.Predicate == predicate }), nil
+}
+
+var (
+	apacheIsAircraft    = db.Triple{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: "/aircraft/apache"}
+	apacheIsAircraft2   = db.Triple{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: "/aircraft"}
+	boeingMakesApache   = db.Triple{Subject: "Boeing", Predicate: "ies:make", Object: "Apache", Source: "/aircraft/apache"}
+	challengerIsVehicle = db.Triple{Subject: "Challenger 2", Predicate: "rdf:type", Object: "ies:Vehicle", Source: "/combat-vehicles/challenger"}
+	challengerIsTank    = db.Triple{Subject: "Challenger 2", Predicate: "rdf:type", Object: "ies:Tank", Source: "/combat-vehicles/challenger"}
+)
+
+func get(t *testing.T, h http.Handler, target string, v any) (statusCode int) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusOK {
+		return w.Code
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return w.Code
+}
+
+func TestIndexHandler(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	q := querier{triples: []db.Triple{apacheIsAircraft, apacheIsAircraft2, boeingMakesApache, challengerIsVehicle, challengerIsTank}}
+	h := graph.NewIndexHandler(log, nil, q)
+
+	var actual graph.IndexResponse
+	if code := get(t, h, "/graph?format=json", &actual); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	var classes []string
+	for _, c := range actual.Classes {
+		classes = append(classes, c.Class)
+	}
+	t.Run("classes that aren't in the hierarchy are last", func(t *testing.T) {
+		if len(classes) != 3 || classes[2] != "ies:Tank" {
+			t.Errorf("expected ies:Tank to be last, got %v", classes)
+		}
+		if last := actual.Classes[2]; len(last.Path) != 0 {
+			t.Errorf("expected no path, got %v", last.Path)
+		}
+	})
+	t.Run("classes include their path in the hierarchy", func(t *testing.T) {
+		for _, c := range actual.Classes[:2] {
+			if len(c.Path) < 2 || c.Path[0] != "rdfs:Class" || c.Path[len(c.Path)-1] != c.Class {
+				t.Errorf("unexpected path for %s: %v", c.Class, c.Path)
+			}
+		}
+	})
+	t.Run("entities are listed once, with each source", func(t *testing.T) {
+		for _, c := range actual.Classes {
+			if c.Class != "ies:Aircraft" {
+				continue
+			}
+			expected := []templates.GraphClassMember{{Entity: "Apache", Sources: []string{"/aircraft/apache", "/aircraft"}}}
+			if diff := cmp.Diff(expected, c.Entities); diff != "" {
+				t.Errorf("unexpected entities (-want +got):\n%s", diff)
+			}
+			return
+		}
+		t.Errorf("expected ies:Aircraft in %v", classes)
+	})
+}
+
+func TestEntityHandler(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	q := querier{triples: []db.Triple{apacheIsAircraft, boeingMakesApache}}
+	h := graph.NewEntityHandler(log, nil, q)
+
+	t.Run("outgoing and incoming triples are returned", func(t *testing.T) {
+		var actual graph.EntityResponse
+		if code := get(t, h, "/graph/entity?id=Apache&format=json", &actual); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		expected := graph.EntityResponse{
+			Entity:   "Apache",
+			Outgoing: []db.Triple{apacheIsAircraft},
+			Incoming: []db.Triple{boeingMakesApache},
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("unexpected response (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("classes are found even if they have no entities", func(t *testing.T) {
+		var actual graph.EntityResponse
+		if code := get(t, h, "/graph/entity?id=ies:Vehicle&format=json", &actual); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		if diff := cmp.Diff(graph.EntityResponse{Entity: "ies:Vehicle", Outgoing: []db.Triple{}, Incoming: []db.Triple{}}, actual); diff != "" {
+			t.Errorf("unexpected response (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("unknown entities are not found", func(t *testing.T) {
+		if code := get(t, h, "/graph/entity?id=Tiger&format=json", nil); code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", code)
+		}
+	})
+	t.Run("the id is required", func(t *testing.T) {
+		if code := get(t, h, "/graph/entity?format=json", nil); code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", code)
+		}
+	})
+}
+
+func (q querier) TripleQuery(ctx context.Context, args db.TripleQueryArgs) (db.TripleQueryResult, error) {
+	return db.TripleQueryResult{
+		Variables: []string{"vehicle"},
+		Bindings:  []map[string]string{{"vehicle": "Apache"}},
+	}, nil
+}
+
+func TestQueryHandler(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	h := graph.NewQueryHandler(log, querier{})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graph/query", strings.NewReader(body)))
+		return w
+	}
+	t.Run("valid queries return the bindings", func(t *testing.T) {
+		w := post(`{"patterns": [{"subject": "?vehicle", "predicate": "rdf:type", "object": "ies:Aircraft"}]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var actual db.TripleQueryResult
+		if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := db.TripleQueryResult{Variables: []string{"vehicle"}, Bindings: []map[string]string{{"vehicle": "Apache"}}}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("unexpected result (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("invalid queries are rejected", func(t *testing.T) {
+		for _, body := range []string{
+			`{`,
+			`{"patterns": []}`,
+			`{"patterns": [{"subject": "Apache", "predicate": "rdf:type", "object": "ies:Aircraft"}]}`,
+			`{"patterns": [{"subject": "?s", "predicate": "rdf:type", "object": "?o"}], "unknown": true}`,
+		} {
+			if w := post(body); w.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", body, w.Code)
+			}
+		}
+	})
+	t.Run("only POST is allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/graph/query", nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405, got %d", w.Code)
+		}
+	})
+}
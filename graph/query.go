@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/a-h/ragmark/db"
+)
+
+// maxQueryBytes is the maximum size of a query request body.
+const maxQueryBytes = 64 * 1024
+
+func NewQueryHandler(log *slog.Logger, queries db.Querier) QueryHandler {
+	return QueryHandler{
+		Log:     log,
+		queries: queries,
+	}
+}
+
+// QueryHandler runs a triple pattern query posted as JSON to /graph/query, e.g.
+//
+//	{
+//	  "patterns": [
+//	    {"subject": "?class", "predicate": "rdfs:subClassOf", "object": "ies:Vehicle", "path": "*"},
+//	    {"subject": "?vehicle", "predicate": "rdf:type", "object": "?class"}
+//	  ]
+//	}
+type QueryHandler struct {
+	Log     *slog.Logger
+	queries db.Querier
+}
+
+func (h QueryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var args db.TripleQueryArgs
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueryBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&args); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := args.Validate(); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.queries.TripleQuery(r.Context(), args)
+	if err != nil {
+		h.Log.Error("failed to query triples", slog.Any("error", err))
+		http.Error(w, "failed to query triples", http.StatusInternalServerError)
+		return
+	}
+	result.Variables = nonNil(result.Variables)
+	result.Bindings = nonNil(result.Bindings)
+	writeJSON(w, result)
+}
@@ -0,0 +1,121 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type embedJob struct {
+	inputs []string
+	result chan embedResult
+}
+
+type embedResult struct {
+	embeddings [][]float32
+	err        error
+}
+
+// embedBatcher combines the embedding requests of documents that are being indexed
+// concurrently, so that the model receives fewer, larger requests.
+type embedBatcher struct {
+	jobs chan embedJob
+	// size is the maximum number of inputs in each request.
+	size int
+	// concurrency is the maximum number of batches that are sent at once.
+	concurrency int
+	// wait is how long to wait for more jobs before sending a batch that isn't full.
+	wait  time.Duration
+	embed func(ctx context.Context, inputs []string) (embeddings [][]float32, err error)
+}
+
+// Embed returns one embedding for each input, once the batch containing them has been sent.
+func (b *embedBatcher) Embed(ctx context.Context, inputs []string) (embeddings [][]float32, err error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	job := embedJob{inputs: inputs, result: make(chan embedResult, 1)}
+	select {
+	case b.jobs <- job:
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+	select {
+	case r := <-job.result:
+		return r.embeddings, r.err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// run collects jobs into batches, and sends up to the configured number of batches at once.
+func (b *embedBatcher) run(ctx context.Context) {
+	sem := make(chan struct{}, max(b.concurrency, 1))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var pending []embedJob
+		select {
+		case job := <-b.jobs:
+			pending = append(pending, job)
+		case <-ctx.Done():
+			return
+		}
+		count := len(pending[0].inputs)
+		timer := time.NewTimer(b.wait)
+	collect:
+		for count < b.size {
+			select {
+			case job := <-b.jobs:
+				pending = append(pending, job)
+				count += len(job.inputs)
+			case <-timer.C:
+				break collect
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+		timer.Stop()
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		wg.Add(1)
+		go func(jobs []embedJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			b.send(ctx, jobs)
+		}(pending)
+	}
+}
+
+// send the inputs of the jobs in requests of up to the batch size, and return the
+// results to each job.
+func (b *embedBatcher) send(ctx context.Context, jobs []embedJob) {
+	var inputs []string
+	for _, job := range jobs {
+		inputs = append(inputs, job.inputs...)
+	}
+	embeddings := make([][]float32, 0, len(inputs))
+	var err error
+	for start := 0; start < len(inputs) && err == nil; start += b.size {
+		var batch [][]float32
+		batch, err = b.embed(ctx, inputs[start:min(start+b.size, len(inputs))])
+		embeddings = append(embeddings, batch...)
+	}
+	if err == nil && len(embeddings) != len(inputs) {
+		err = fmt.Errorf("expected %d embeddings, got %d", len(inputs), len(embeddings))
+	}
+	var offset int
+	for _, job := range jobs {
+		if err != nil {
+			job.result <- embedResult{err: err}
+			continue
+		}
+		job.result <- embedResult{embeddings: embeddings[offset : offset+len(job.inputs)]}
+		offset += len(job.inputs)
+	}
+}
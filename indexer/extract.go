@@ -0,0 +1,110 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/ontology"
+	"github.com/a-h/ragmark/prompts"
+)
+
+const (
+	typePredicate    = "rdf:type"
+	classRoot        = "rdfs:Class"
+	relationshipRoot = "ies:relationship"
+)
+
+// extractTypes asks the chat model to classify the document, and returns the rdf:type
+// statements whose class is in the type hierarchy.
+func (indexer Indexer) extractTypes(ctx context.Context, log *slog.Logger, text string) (triples []db.Triple, err error) {
+	hierarchy, err := prompts.TypeHierarchy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load type hierarchy: %w", err)
+	}
+	typePrompt, err := prompts.ExtractType(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create type prompt: %w", err)
+	}
+	response, err := indexer.complete(ctx, log, "extract type", typePrompt)
+	if err != nil {
+		return nil, err
+	}
+	return validTypes(log, hierarchy, prompts.ParseStatements(response)), nil
+}
+
+// validTypes returns the rdf:type statements that refer to a known class, without duplicates.
+func validTypes(log *slog.Logger, hierarchy *ontology.Hierarchy, statements []db.Triple) (triples []db.Triple) {
+	return valid(statements, func(s db.Triple) bool {
+		if s.Predicate != typePredicate {
+			log.Debug("ignoring statement that isn't a type", slog.String("predicate", s.Predicate))
+			return false
+		}
+		if s.Object == classRoot || !hierarchy.IsA(s.Object, classRoot) {
+			log.Warn("ignoring unknown type", slog.String("subject", s.Subject), slog.String("type", s.Object))
+			return false
+		}
+		return true
+	})
+}
+
+// extractRelationships asks the chat model for the relationships between the document's
+// subject and other entities, and returns the statements whose predicate is in the
+// relationship hierarchy.
+func (indexer Indexer) extractRelationships(ctx context.Context, log *slog.Logger, subject, text string) (triples []db.Triple, err error) {
+	hierarchy, err := prompts.RelationshipHierarchy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load relationship hierarchy: %w", err)
+	}
+	relationshipPrompt, err := prompts.ExtractRelationships(subject, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create relationship prompt: %w", err)
+	}
+	response, err := indexer.complete(ctx, log, "extract relationships", relationshipPrompt)
+	if err != nil {
+		return nil, err
+	}
+	return validRelationships(log, hierarchy, prompts.ParseStatements(response)), nil
+}
+
+// validRelationships returns the statements that use a known predicate, without duplicates.
+func validRelationships(log *slog.Logger, hierarchy *ontology.Hierarchy, statements []db.Triple) (triples []db.Triple) {
+	return valid(statements, func(s db.Triple) bool {
+		if s.Predicate == relationshipRoot || !hierarchy.IsA(s.Predicate, relationshipRoot) {
+			log.Warn("ignoring unknown relationship", slog.String("subject", s.Subject), slog.String("predicate", s.Predicate))
+			return false
+		}
+		return true
+	})
+}
+
+func valid(statements []db.Triple, isValid func(s db.Triple) bool) (triples []db.Triple) {
+	seen := map[db.Triple]bool{}
+	for _, s := range statements {
+		if seen[s] || !isValid(s) {
+			continue
+		}
+		seen[s] = true
+		triples = append(triples, s)
+	}
+	return triples
+}
+
+// complete sends the prompt to the chat model, retrying transient errors.
+func (indexer Indexer) complete(ctx context.Context, log *slog.Logger, operation, prompt string) (response string, err error) {
+	err = indexer.retry(ctx, log, operation, func() (err error) {
+		response, err = indexer.chat.Chat(ctx, llm.ChatRequest{
+			Model: indexer.ChatModel,
+			Messages: []llm.Message{
+				{
+					Role:    llm.RoleUser,
+					Content: prompt,
+				},
+			},
+		})
+		return err
+	})
+	return response, err
+}
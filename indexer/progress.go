@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// progress of an index run, which is updated by each worker.
+type progress struct {
+	mu      sync.Mutex
+	start   time.Time
+	total   int
+	indexed int
+	skipped int
+	chunks  int
+}
+
+func newProgress(total int) *progress {
+	return &progress{
+		start: time.Now(),
+		total: total,
+	}
+}
+
+// done records that a document has been processed.
+func (p *progress) done(indexed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if indexed {
+		p.indexed++
+		return
+	}
+	p.skipped++
+}
+
+// embedded records the number of chunks that were embedded.
+func (p *progress) embedded(chunks int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.chunks += chunks
+}
+
+func (p *progress) stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		Documents: p.total,
+		Indexed:   p.indexed,
+		Skipped:   p.skipped,
+		Chunks:    p.chunks,
+		Duration:  time.Since(p.start),
+	}
+}
+
+// eta estimates the time remaining, based on the average time taken per document so far.
+func (s Stats) eta() time.Duration {
+	done := s.Indexed + s.Skipped
+	if done == 0 {
+		return 0
+	}
+	perDocument := s.Duration / time.Duration(done)
+	return (perDocument * time.Duration(s.Documents-done)).Round(time.Second)
+}
+
+func (p *progress) log(log *slog.Logger) {
+	s := p.stats()
+	log.Info("indexing progress",
+		slog.Int("done", s.Indexed+s.Skipped),
+		slog.Int("total", s.Documents),
+		slog.Int("indexed", s.Indexed),
+		slog.Int("skipped", s.Skipped),
+		slog.Int("chunks", s.Chunks),
+		slog.Duration("elapsed", s.Duration.Round(time.Second)),
+		slog.Duration("eta", s.eta()))
+}
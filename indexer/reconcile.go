@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/site"
+)
+
+// Reconcile removes documents from the index that are no longer in the site, e.g.
+// because the Markdown file was deleted or renamed. The orphaned paths are returned.
+// If dryRun is true, nothing is removed.
+func (indexer Indexer) Reconcile(ctx context.Context, site *site.Site, dryRun bool) (orphans []string, err error) {
+	indexer.Log.Info("listing indexed documents")
+	paths, err := indexer.queries.DocumentSelectPaths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexed documents: %w", err)
+	}
+	for _, path := range paths {
+		if _, ok := site.GetContent(path); ok {
+			continue
+		}
+		orphans = append(orphans, path)
+	}
+	indexer.Log.Info("found orphaned documents", slog.Int("count", len(orphans)), slog.Bool("dryRun", dryRun))
+	if dryRun {
+		return orphans, nil
+	}
+	for _, path := range orphans {
+		indexer.Log.Info("removing orphaned document", slog.String("url", path))
+		if err = indexer.queries.DocumentDelete(ctx, db.DocumentDeleteArgs{Path: path}); err != nil {
+			return orphans, fmt.Errorf("failed to remove %q: %w", path, err)
+		}
+	}
+	return orphans, nil
+}
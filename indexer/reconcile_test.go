@@ -0,0 +1,88 @@
+package indexer_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/indexer"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/site"
+	"github.com/google/go-cmp/cmp"
+)
+
+type querier struct {
+	db.Querier
+	paths   []string
+	deleted []string
+}
+
+func (q *querier) DocumentSelectPaths(ctx context.Context) ([]string, error) {
+	return q.paths, nil
+}
+
+func (q *querier) DocumentDelete(ctx context.Context, args db.DocumentDeleteArgs) error {
+	q.deleted = append(q.deleted, args.Path)
+	return nil
+}
+
+var markdownHandler = site.NewMarkdownDirEntryHandler(func(site *site.Site, page site.Metadata, toc []site.MenuItem, outputHTML string, err error) http.Handler {
+	return nil
+})
+
+var directoryHandler = site.NewDirectoryDirEntryHandler(func(s *site.Site, dir site.Metadata, children []site.Metadata) http.Handler {
+	return nil
+})
+
+func newSite(t *testing.T, files ...string) *site.Site {
+	t.Helper()
+	dirFS := make(fstest.MapFS)
+	for _, f := range files {
+		dirFS[f] = &fstest.MapFile{Data: []byte("# " + f)}
+	}
+	s, err := site.New(site.SiteArgs{
+		Log:             slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		Dir:             dirFS,
+		ContentHandlers: []site.DirEntryHandler{markdownHandler, directoryHandler},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return s
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	s := newSite(t, "index.md", "a/index.md", "a/b.md")
+	indexed := []string{"/", "/a", "/a/b", "/a/renamed", "/deleted"}
+
+	t.Run("dry run returns orphans without removing them", func(t *testing.T) {
+		q := &querier{paths: indexed}
+		idx := indexer.New(log, q, fake.New(), fake.New(), "embed", "chat")
+		orphans, err := idx.Reconcile(ctx, s, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]string{"/a/renamed", "/deleted"}, orphans); diff != "" {
+			t.Errorf("unexpected orphans (-want +got):\n%s", diff)
+		}
+		if len(q.deleted) != 0 {
+			t.Errorf("expected nothing to be deleted, got %v", q.deleted)
+		}
+	})
+	t.Run("orphans are removed", func(t *testing.T) {
+		q := &querier{paths: indexed}
+		idx := indexer.New(log, q, fake.New(), fake.New(), "embed", "chat")
+		if _, err := idx.Reconcile(ctx, s, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]string{"/a/renamed", "/deleted"}, q.deleted); diff != "" {
+			t.Errorf("unexpected deletions (-want +got):\n%s", diff)
+		}
+	})
+}
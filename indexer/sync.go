@@ -2,25 +2,37 @@ package indexer
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
 	"github.com/a-h/ragmark/prompts"
 	"github.com/a-h/ragmark/site"
 	"github.com/a-h/ragmark/splitter"
-	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/yuin/goldmark/ast"
 )
 
-func New(log *slog.Logger, queries *db.Queries, oc *ollamaapi.Client, embeddingModel, chatModel string) *Indexer {
+func New(log *slog.Logger, queries db.Querier, embedder llm.Embedder, chat llm.ChatCompleter, embeddingModel, chatModel string) *Indexer {
 	return &Indexer{
-		Log:            log,
-		EmbeddingModel: embeddingModel,
-		ChatModel:      chatModel,
-		queries:        queries,
-		oc:             oc,
+		Log:              log,
+		EmbeddingModel:   embeddingModel,
+		ChatModel:        chatModel,
+		Splitter:         splitter.DefaultOptions(),
+		Concurrency:      4,
+		EmbedBatchSize:   32,
+		EmbedBatchWait:   100 * time.Millisecond,
+		MaxRetries:       3,
+		RetryDelay:       time.Second,
+		ProgressInterval: 10 * time.Second,
+		queries:          queries,
+		embedder:         embedder,
+		chat:             chat,
 	}
 }
 
@@ -28,116 +40,395 @@ type Indexer struct {
 	Log            *slog.Logger
 	EmbeddingModel string
 	ChatModel      string
-	queries        *db.Queries
-	oc             *ollamaapi.Client
+	Splitter       splitter.Options
+	Force          bool // Index documents that haven't changed since they were last indexed.
+	// ExtractRelationships asks the chat model for the relationships between each document's
+	// subject and other entities, and stores them in the triple store.
+	ExtractRelationships bool
+	// Concurrency is the number of documents to process, and embedding requests to send, at the same time.
+	Concurrency int
+	// EmbedBatchSize is the maximum number of chunks, from one or more documents, to
+	// send in each embedding request.
+	EmbedBatchSize int
+	// EmbedBatchWait is how long to wait for other documents to fill a batch.
+	EmbedBatchWait time.Duration
+	// MaxRetries is the number of times to retry model requests that fail with a
+	// transient error. RetryDelay is the wait before the first retry, and doubles on
+	// each subsequent retry.
+	MaxRetries int
+	RetryDelay time.Duration
+	// ProgressInterval is how often progress is logged.
+	ProgressInterval time.Duration
+	queries          db.Querier
+	embedder         llm.Embedder
+	chat             llm.ChatCompleter
 }
 
-func (indexer Indexer) Index(ctx context.Context, site *site.Site) (err error) {
+// Stats summarise an index run.
+type Stats struct {
+	// Documents is the number of documents in the site.
+	Documents int
+	// Indexed is the number of documents that were indexed.
+	Indexed int
+	// Skipped is the number of documents that were up to date, or aren't indexed, e.g. directories.
+	Skipped int
+	// Chunks is the number of chunks that were embedded.
+	Chunks   int
+	Duration time.Duration
+}
+
+type document struct {
+	url     string
+	content site.Content
+}
+
+// Index the site's documents, using a pool of workers. Embedding requests are batched
+// across documents.
+func (indexer Indexer) Index(ctx context.Context, site *site.Site) (stats Stats, err error) {
 	indexer.Log.Info("starting process")
+	var documents []document
 	for url, content := range site.Content() {
-		log := indexer.Log.With(slog.String("url", url))
+		documents = append(documents, document{url: url, content: content})
+	}
+	p := newProgress(len(documents))
 
-		log.Info("processing content")
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
-		log.Info("getting document metadata")
-		dbMetadata, err := indexer.queries.DocumentUpsert(ctx, db.DocumentUpsertArgs{
-			Path: url,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to get document metadata from db: %w", err)
-		}
+	batcherCtx, stopBatcher := context.WithCancel(ctx)
+	defer stopBatcher()
+	b := &embedBatcher{
+		jobs:        make(chan embedJob),
+		size:        max(indexer.EmbedBatchSize, 1),
+		concurrency: max(indexer.Concurrency, 1),
+		wait:        indexer.EmbedBatchWait,
+		embed: func(ctx context.Context, inputs []string) (embeddings [][]float32, err error) {
+			err = indexer.retry(ctx, indexer.Log, "embed", func() (err error) {
+				embeddings, err = indexer.embedder.Embed(ctx, llm.EmbedRequest{
+					Model: indexer.EmbeddingModel,
+					Input: inputs,
+				})
+				return err
+			})
+			return embeddings, err
+		},
+	}
+	go b.run(batcherCtx)
 
-		if content.Metadata().LastMod.Before(dbMetadata.LastUpdated) {
-			indexer.Log.Info("document is up to date")
+	reporterDone := make(chan struct{})
+	stopReporter := make(chan struct{})
+	go func() {
+		defer close(reporterDone)
+		if indexer.ProgressInterval <= 0 {
+			return
 		}
-		indexer.Log.Info("document is out of date")
+		ticker := time.NewTicker(indexer.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.log(indexer.Log)
+			case <-stopReporter:
+				return
+			}
+		}
+	}()
 
-		if !strings.HasPrefix(content.Metadata().MimeType, "text/html") {
-			indexer.Log.Info("content is not HTML, skipping")
-			continue
+	queue := make(chan document)
+	var wg sync.WaitGroup
+	for range max(indexer.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for doc := range queue {
+				indexed, err := indexer.indexDocument(ctx, doc, b, p)
+				if err != nil {
+					cancel(fmt.Errorf("failed to index %q: %w", doc.url, err))
+					continue
+				}
+				p.done(indexed)
+			}
+		}()
+	}
+enqueue:
+	for _, doc := range documents {
+		select {
+		case queue <- doc:
+		case <-ctx.Done():
+			break enqueue
 		}
+	}
+	close(queue)
+	wg.Wait()
+	close(stopReporter)
+	<-reporterDone
 
-		indexer.Log.Info("upserting document fts index")
-		text, err := content.Text()
-		if err != nil {
-			return fmt.Errorf("failed to get document text: %w", err)
+	stats = p.stats()
+	if err = context.Cause(ctx); err != nil {
+		return stats, err
+	}
+	indexer.Log.Info("update complete",
+		slog.Int("documents", stats.Documents),
+		slog.Int("indexed", stats.Indexed),
+		slog.Int("skipped", stats.Skipped),
+		slog.Int("chunks", stats.Chunks),
+		slog.Duration("duration", stats.Duration))
+	return stats, nil
+}
+
+// indexDocument indexes a single document, returning false if the document was skipped.
+func (indexer Indexer) indexDocument(ctx context.Context, doc document, b *embedBatcher, p *progress) (indexed bool, err error) {
+	url, content := doc.url, doc.content
+	log := indexer.Log.With(slog.String("url", url))
+
+	log.Info("processing content")
+
+	log.Info("getting document metadata")
+	dbMetadata, err := indexer.queries.DocumentUpsert(ctx, db.DocumentUpsertArgs{
+		Path: url,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get document metadata from db: %w", err)
+	}
+
+	if !strings.HasPrefix(content.Metadata().MimeType, "text/html") {
+		log.Info("content is not HTML, skipping")
+		return false, nil
+	}
+
+	text, err := content.Text()
+	if err != nil {
+		return false, fmt.Errorf("failed to get document text: %w", err)
+	}
+	hash, err := contentHash(content, text)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash document content: %w", err)
+	}
+	splitterVersion := indexer.Splitter.Version()
+	extractionVersion := indexer.extractionVersion()
+	chunksUpToDate := dbMetadata.ContentHash == hash &&
+		dbMetadata.EmbeddingModel == indexer.EmbeddingModel &&
+		dbMetadata.SplitterVersion == splitterVersion
+	upToDate := chunksUpToDate && dbMetadata.ExtractionVersion == extractionVersion
+	state := db.DocumentUpdateIndexedArgs{
+		Path:              url,
+		LastUpdated:       time.Now(),
+		ContentHash:       hash,
+		EmbeddingModel:    indexer.EmbeddingModel,
+		SplitterVersion:   splitterVersion,
+		ExtractionVersion: extractionVersion,
+		Type:              content.Metadata().Type,
+		LastMod:           content.Metadata().LastMod,
+	}
+	if upToDate && !indexer.Force {
+		log.Info("document is up to date")
+		// Documents indexed before the metadata was stored don't have it, and the metadata
+		// may have changed without changing the hash.
+		if m := content.Metadata(); dbMetadata.Type != m.Type || dbMetadata.LastMod.Unix() != m.LastMod.Unix() {
+			log.Info("updating document metadata")
+			if err = indexer.queries.DocumentUpdateMetadata(ctx, db.DocumentUpdateMetadataArgs{
+				Path:    url,
+				Type:    m.Type,
+				LastMod: m.LastMod,
+			}); err != nil {
+				return false, fmt.Errorf("failed to update document metadata: %w", err)
+			}
 		}
-		err = indexer.queries.DocumentFTSUpsert(ctx, db.DocumentFTSUpsertArgs{
-			Path:    url,
-			Title:   content.Metadata().Title,
-			Text:    text,
-			Summary: content.Metadata().Summary,
-		})
+		return false, nil
+	}
+	if chunksUpToDate && !indexer.Force {
+		// The chat model, prompts or options have changed, so only the triples need to
+		// be extracted again.
+		log.Info("document triples are out of date")
+		triples, err := indexer.extract(ctx, log, url, content, text)
 		if err != nil {
-			return fmt.Errorf("failed to upsert document fts index: %w", err)
+			return false, err
 		}
+		if err = indexer.replaceTriples(ctx, log, url, triples, state); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	log.Info("document is out of date")
 
-		// Extract type.
-		typePrompt, err := prompts.ExtractType(text)
-		if err != nil {
-			return fmt.Errorf("failed to create type prompt: %w", err)
+	log.Info("upserting document fts index")
+	err = indexer.queries.DocumentFTSUpsert(ctx, db.DocumentFTSUpsertArgs{
+		Path:    url,
+		Title:   content.Metadata().Title,
+		Text:    text,
+		Summary: content.Metadata().Summary,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to upsert document fts index: %w", err)
+	}
+
+	triples, err := indexer.extract(ctx, log, url, content, text)
+	if err != nil {
+		return false, err
+	}
+
+	chunks, err := indexer.split(content, text)
+	if err != nil {
+		return false, fmt.Errorf("failed to split document: %w", err)
+	}
+	log.Info("processing document chunks", slog.Int("count", len(chunks)))
+
+	var chunkInsertArgs db.ChunkInsertArgs
+	chunkInsertArgs.Chunks = make([]db.Chunk, len(chunks))
+	inputs := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		inputs[i] = embeddingInput(chunk)
+	}
+	log.Info("getting embeddings")
+	embeddings, err := b.Embed(ctx, inputs)
+	if err != nil {
+		return false, fmt.Errorf("failed to get chunk embeddings: %w", err)
+	}
+	for i, chunk := range chunks {
+		chunkInsertArgs.Chunks[i] = db.Chunk{
+			Path:      url,
+			Index:     i,
+			Heading:   chunk.Heading,
+			Text:      chunk.Text,
+			Embedding: embeddings[i],
 		}
-		var typeResponse strings.Builder
-		indexer.oc.Chat(ctx, &ollamaapi.ChatRequest{
-			Model: indexer.ChatModel,
-			Messages: []ollamaapi.Message{
-				{
-					Role:      "user",
-					Content:   typePrompt,
-					Images:    []ollamaapi.ImageData{},
-					ToolCalls: []ollamaapi.ToolCall{},
-				},
-			},
-		},
-			func(resp ollamaapi.ChatResponse) error {
-				typeResponse.WriteString(resp.Message.Content)
-				return nil
-			})
+	}
+	p.embedded(len(chunks))
+
+	log.Info("deleting existing document chunks")
+	err = indexer.queries.ChunkDelete(ctx, db.ChunkDeleteArgs{
+		Path: url,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete document index: %w", err)
+	}
 
-		chunks := splitter.Split(text)
-		indexer.Log.Info("processing document chunks", slog.Int("count", len(chunks)))
+	log.Info("inserting new document chunks")
+	if err = indexer.queries.ChunkInsert(ctx, chunkInsertArgs); err != nil {
+		return false, fmt.Errorf("failed to insert chunks: %w", err)
+	}
 
-		var chunkInsertArgs db.ChunkInsertArgs
-		chunkInsertArgs.Chunks = make([]db.Chunk, len(chunks))
-		indexer.Log.Info("getting embeddings")
-		embeddings, err := indexer.oc.Embed(ctx, &ollamaapi.EmbedRequest{
-			Model: indexer.EmbeddingModel,
-			Input: chunks,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to get chunk embeddings: %w", err)
+	if err = indexer.replaceTriples(ctx, log, url, triples, state); err != nil {
+		return false, err
+	}
+	log.Info("inserted document index")
+	return true, nil
+}
+
+// extractionVersion identifies the chat model, prompts and options used to extract
+// triples. If it changes, the triples of documents need to be extracted again.
+func (indexer Indexer) extractionVersion() string {
+	return fmt.Sprintf("%s;model=%s;relationships=%t", prompts.ExtractionVersion, indexer.ChatModel, indexer.ExtractRelationships)
+}
+
+// extract returns the types of the document, and its relationships if ExtractRelationships
+// is set.
+func (indexer Indexer) extract(ctx context.Context, log *slog.Logger, url string, content site.Content, text string) (triples []db.Triple, err error) {
+	log.Info("extracting document types")
+	triples, err = indexer.extractTypes(ctx, log, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract document types: %w", err)
+	}
+	if !indexer.ExtractRelationships {
+		return triples, nil
+	}
+	subject := content.Metadata().Title
+	if subject == "" {
+		subject = url
+	}
+	log.Info("extracting document relationships")
+	relationships, err := indexer.extractRelationships(ctx, log, subject, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract document relationships: %w", err)
+	}
+	return append(triples, relationships...), nil
+}
+
+// replaceTriples replaces the document's triples, then records its index state.
+func (indexer Indexer) replaceTriples(ctx context.Context, log *slog.Logger, url string, triples []db.Triple, state db.DocumentUpdateIndexedArgs) (err error) {
+	log.Info("replacing document triples", slog.Int("count", len(triples)))
+	if err = indexer.queries.TripleReplaceSource(ctx, db.TripleReplaceSourceArgs{
+		Source:  url,
+		Triples: triples,
+	}); err != nil {
+		return fmt.Errorf("failed to replace document triples: %w", err)
+	}
+	log.Info("updating document index state")
+	if err = indexer.queries.DocumentUpdateIndexed(ctx, state); err != nil {
+		return fmt.Errorf("failed to update document index state: %w", err)
+	}
+	return nil
+}
+
+// retry calls fn until it succeeds, returns an error that isn't transient, or the
+// maximum number of retries is reached. The delay between attempts doubles each time.
+func (indexer Indexer) retry(ctx context.Context, log *slog.Logger, operation string, fn func() error) (err error) {
+	delay := indexer.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !llm.IsTransient(err) || attempt > indexer.MaxRetries {
+			return err
 		}
-		for i, chunk := range chunks {
-			chunkInsertArgs.Chunks[i] = db.Chunk{
-				Path:      url,
-				Index:     i,
-				Text:      chunk,
-				Embedding: embeddings.Embeddings[i],
-			}
+		log.Warn("retrying after transient error",
+			slog.String("operation", operation),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.Any("error", err))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
 		}
+		delay *= 2
+	}
+}
 
-		indexer.Log.Info("deleting existing document chunks")
-		err = indexer.queries.ChunkDelete(ctx, db.ChunkDeleteArgs{
-			Path: url,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to delete document index: %w", err)
-		}
+// markdownReader is implemented by content that can provide its Markdown AST, e.g. site.Markdown.
+type markdownReader interface {
+	Read() (src []byte, node ast.Node, err error)
+}
 
-		indexer.Log.Info("inserting new document chunks")
-		if err = indexer.queries.ChunkInsert(ctx, chunkInsertArgs); err != nil {
-			return fmt.Errorf("failed to insert chunks: %w", err)
+// split Markdown content by its structure, or other content by line.
+func (indexer Indexer) split(content site.Content, text string) (chunks []splitter.Chunk, err error) {
+	md, ok := content.(markdownReader)
+	if !ok {
+		for _, line := range splitter.Split(text) {
+			chunks = append(chunks, splitter.Chunk{Text: line})
 		}
+		return chunks, nil
+	}
+	src, node, err := md.Read()
+	if err != nil {
+		return nil, err
+	}
+	return splitter.Markdown(src, node, indexer.Splitter), nil
+}
 
-		indexer.Log.Info("updating last updated time")
-		if err = indexer.queries.DocumentUpdateLastUpdated(ctx, db.DocumentUpdateLastUpdatedArgs{
-			Path:        url,
-			LastUpdated: time.Now(),
-		}); err != nil {
-			return fmt.Errorf("failed to update last updated time: %w", err)
+// contentHash returns a hash of the content that the index is created from. Markdown
+// source is used if available, since the text doesn't include all of the metadata.
+func contentHash(content site.Content, text string) (hash string, err error) {
+	h := sha256.New()
+	if md, ok := content.(markdownReader); ok {
+		src, _, err := md.Read()
+		if err != nil {
+			return hash, err
 		}
-		indexer.Log.Info("inserted document index")
+		h.Write(src)
+		return hex.EncodeToString(h.Sum(nil)), nil
 	}
-	indexer.Log.Info("update complete")
-	return nil
+	m := content.Metadata()
+	for _, s := range []string{m.Title, m.Summary, text} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// embeddingInput includes the heading breadcrumb, so that the section's topic
+// contributes to the chunk's embedding.
+func embeddingInput(chunk splitter.Chunk) string {
+	if chunk.Heading == "" {
+		return chunk.Text
+	}
+	return chunk.Heading + "\n\n" + chunk.Text
 }
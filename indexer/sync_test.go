@@ -0,0 +1,446 @@
+package indexer_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/indexer"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/site"
+	"github.com/google/go-cmp/cmp"
+)
+
+// memoryQuerier stores the document index state, and records the documents that were chunked,
+// and whose triples were extracted.
+type memoryQuerier struct {
+	db.Querier
+	mu        sync.Mutex
+	docs      map[string]db.DocumentUpsertResult
+	chunked   []string
+	extracted []string
+	triples   map[string][]db.Triple
+}
+
+func newMemoryQuerier() *memoryQuerier {
+	return &memoryQuerier{
+		docs:    map[string]db.DocumentUpsertResult{},
+		triples: map[string][]db.Triple{},
+	}
+}
+
+func (q *memoryQuerier) DocumentUpsert(ctx context.Context, args db.DocumentUpsertArgs) (db.DocumentUpsertResult, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	doc, ok := q.docs[args.Path]
+	if !ok {
+		doc = db.DocumentUpsertResult{Path: args.Path}
+		q.docs[args.Path] = doc
+	}
+	return doc, nil
+}
+
+func (q *memoryQuerier) DocumentUpdateIndexed(ctx context.Context, args db.DocumentUpdateIndexedArgs) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.docs[args.Path] = db.DocumentUpsertResult{
+		Path:              args.Path,
+		LastUpdated:       args.LastUpdated,
+		ContentHash:       args.ContentHash,
+		EmbeddingModel:    args.EmbeddingModel,
+		SplitterVersion:   args.SplitterVersion,
+		ExtractionVersion: args.ExtractionVersion,
+		Type:              args.Type,
+		LastMod:           args.LastMod,
+	}
+	return nil
+}
+
+func (q *memoryQuerier) DocumentUpdateMetadata(ctx context.Context, args db.DocumentUpdateMetadataArgs) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	doc := q.docs[args.Path]
+	doc.Type = args.Type
+	doc.LastMod = args.LastMod
+	q.docs[args.Path] = doc
+	return nil
+}
+
+func (q *memoryQuerier) DocumentFTSUpsert(ctx context.Context, args db.DocumentFTSUpsertArgs) error {
+	return nil
+}
+
+func (q *memoryQuerier) ChunkDelete(ctx context.Context, args db.ChunkDeleteArgs) error {
+	return nil
+}
+
+func (q *memoryQuerier) ChunkInsert(ctx context.Context, args db.ChunkInsertArgs) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(args.Chunks) > 0 {
+		q.chunked = append(q.chunked, args.Chunks[0].Path)
+	}
+	return nil
+}
+
+func (q *memoryQuerier) TripleReplaceSource(ctx context.Context, args db.TripleReplaceSourceArgs) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.extracted = append(q.extracted, args.Source)
+	q.triples[args.Source] = args.Triples
+	return nil
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	dirFS := fstest.MapFS{
+		"a.md": &fstest.MapFile{Data: []byte("# A\n\nAlpha.")},
+		"b.md": &fstest.MapFile{Data: []byte("# B\n\nBravo.")},
+	}
+	newSite := func(t *testing.T) *site.Site {
+		t.Helper()
+		s, err := site.New(site.SiteArgs{
+			Log:             log,
+			Dir:             dirFS,
+			ContentHandlers: []site.DirEntryHandler{markdownHandler, directoryHandler},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return s
+	}
+	index := func(t *testing.T, q *memoryQuerier, configure func(idx *indexer.Indexer)) []string {
+		t.Helper()
+		q.chunked, q.extracted = nil, nil
+		idx := indexer.New(log, q, fake.New(), fake.New(), "embed", "chat")
+		if configure != nil {
+			configure(idx)
+		}
+		if _, err := idx.Index(ctx, newSite(t)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		slices.Sort(q.chunked)
+		return q.chunked
+	}
+	q := newMemoryQuerier()
+
+	t.Run("new documents are indexed", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"/a", "/b"}, index(t, q, nil)); diff != "" {
+			t.Errorf("unexpected documents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("unchanged documents are skipped", func(t *testing.T) {
+		if chunked := index(t, q, nil); len(chunked) != 0 {
+			t.Errorf("expected no documents to be indexed, got %v", chunked)
+		}
+	})
+	t.Run("changed documents are indexed", func(t *testing.T) {
+		dirFS["b.md"] = &fstest.MapFile{Data: []byte("# B\n\nBravo, updated.")}
+		if diff := cmp.Diff([]string{"/b"}, index(t, q, nil)); diff != "" {
+			t.Errorf("unexpected documents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("changing the embedding model indexes all documents", func(t *testing.T) {
+		chunked := index(t, q, func(idx *indexer.Indexer) { idx.EmbeddingModel = "new-model" })
+		if diff := cmp.Diff([]string{"/a", "/b"}, chunked); diff != "" {
+			t.Errorf("unexpected documents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("changing the splitter options indexes all documents", func(t *testing.T) {
+		chunked := index(t, q, func(idx *indexer.Indexer) {
+			idx.EmbeddingModel = "new-model"
+			idx.Splitter.MaxSize = 500
+		})
+		if diff := cmp.Diff([]string{"/a", "/b"}, chunked); diff != "" {
+			t.Errorf("unexpected documents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("force indexes unchanged documents", func(t *testing.T) {
+		chunked := index(t, q, func(idx *indexer.Indexer) {
+			idx.EmbeddingModel = "new-model"
+			idx.Splitter.MaxSize = 500
+			idx.Force = true
+		})
+		if diff := cmp.Diff([]string{"/a", "/b"}, chunked); diff != "" {
+			t.Errorf("unexpected documents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("missing metadata is added to unchanged documents without indexing them", func(t *testing.T) {
+		configure := func(idx *indexer.Indexer) {
+			idx.EmbeddingModel = "new-model"
+			idx.Splitter.MaxSize = 500
+		}
+		dirFS["a.md"] = &fstest.MapFile{Data: []byte("---\ntype: aircraft\nlastMod: 2024-10-01T00:00:00Z\n---\n\n# A\n\nAlpha.")}
+		index(t, q, configure)
+		// Documents indexed before the metadata was stored don't have it.
+		doc := q.docs["/a"]
+		doc.Type, doc.LastMod = "", time.Time{}
+		q.docs["/a"] = doc
+
+		if chunked := index(t, q, configure); len(chunked) != 0 {
+			t.Errorf("expected no documents to be indexed, got %v", chunked)
+		}
+		doc = q.docs["/a"]
+		expectedLastMod := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC)
+		if doc.Type != "aircraft" || !doc.LastMod.Equal(expectedLastMod) {
+			t.Errorf("expected the metadata to be added, got type %q, last modified %v", doc.Type, doc.LastMod)
+		}
+	})
+	extracted := func(t *testing.T, configure func(idx *indexer.Indexer)) []string {
+		t.Helper()
+		if chunked := index(t, q, configure); len(chunked) != 0 {
+			t.Errorf("expected no documents to be chunked, got %v", chunked)
+		}
+		slices.Sort(q.extracted)
+		return q.extracted
+	}
+	t.Run("enabling relationship extraction extracts triples from unchanged documents", func(t *testing.T) {
+		actual := extracted(t, func(idx *indexer.Indexer) {
+			idx.EmbeddingModel = "new-model"
+			idx.Splitter.MaxSize = 500
+			idx.ExtractRelationships = true
+		})
+		if diff := cmp.Diff([]string{"/a", "/b"}, actual); diff != "" {
+			t.Errorf("unexpected documents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("changing the chat model extracts triples from unchanged documents", func(t *testing.T) {
+		actual := extracted(t, func(idx *indexer.Indexer) {
+			idx.EmbeddingModel = "new-model"
+			idx.Splitter.MaxSize = 500
+			idx.ExtractRelationships = true
+			idx.ChatModel = "new-chat"
+		})
+		if diff := cmp.Diff([]string{"/a", "/b"}, actual); diff != "" {
+			t.Errorf("unexpected documents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("unchanged extraction state is skipped", func(t *testing.T) {
+		actual := extracted(t, func(idx *indexer.Indexer) {
+			idx.EmbeddingModel = "new-model"
+			idx.Splitter.MaxSize = 500
+			idx.ExtractRelationships = true
+			idx.ChatModel = "new-chat"
+		})
+		if len(actual) != 0 {
+			t.Errorf("expected no triples to be extracted, got %v", actual)
+		}
+	})
+}
+
+// recordingEmbedder records the size of each request, and the most requests in flight at once,
+// and returns errors for the first requests.
+type recordingEmbedder struct {
+	mu          sync.Mutex
+	embedder    *fake.Client
+	errors      []error
+	requests    []int
+	delay       time.Duration
+	inFlight    int
+	maxInFlight int
+}
+
+func (e *recordingEmbedder) Embed(ctx context.Context, req llm.EmbedRequest) ([][]float32, error) {
+	e.mu.Lock()
+	e.requests = append(e.requests, len(req.Input))
+	e.inFlight++
+	e.maxInFlight = max(e.maxInFlight, e.inFlight)
+	var err error
+	if len(e.errors) > 0 {
+		err, e.errors = e.errors[0], e.errors[1:]
+	}
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.inFlight--
+		e.mu.Unlock()
+	}()
+	time.Sleep(e.delay)
+	if err != nil {
+		return nil, err
+	}
+	return e.embedder.Embed(ctx, req)
+}
+
+func TestIndexPipeline(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	dirFS := fstest.MapFS{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		dirFS[name+".md"] = &fstest.MapFile{Data: []byte("# " + name + "\n\nSome text.")}
+	}
+	s, err := site.New(site.SiteArgs{
+		Log:             log,
+		Dir:             dirFS,
+		ContentHandlers: []site.DirEntryHandler{markdownHandler, directoryHandler},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	newIndexer := func(e *recordingEmbedder) *indexer.Indexer {
+		idx := indexer.New(log, newMemoryQuerier(), e, fake.New(), "embed", "chat")
+		idx.Concurrency = 5
+		idx.EmbedBatchSize = 3
+		idx.EmbedBatchWait = time.Second
+		idx.RetryDelay = time.Millisecond
+		return idx
+	}
+
+	t.Run("embedding requests are batched across documents", func(t *testing.T) {
+		e := &recordingEmbedder{embedder: fake.New()}
+		stats, err := newIndexer(e).Index(ctx, s)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Indexed != 5 || stats.Chunks != 5 {
+			t.Errorf("expected 5 documents and chunks to be indexed, got %+v", stats)
+		}
+		if stats.Indexed+stats.Skipped != stats.Documents {
+			t.Errorf("expected every document to be processed, got %+v", stats)
+		}
+		if diff := cmp.Diff([]int{3, 2}, e.requests); diff != "" {
+			t.Errorf("unexpected request sizes (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("embedding requests are sent concurrently", func(t *testing.T) {
+		e := &recordingEmbedder{embedder: fake.New(), delay: 100 * time.Millisecond}
+		idx := newIndexer(e)
+		idx.EmbedBatchSize = 1
+		idx.EmbedBatchWait = 0
+		stats, err := idx.Index(ctx, s)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Chunks != 5 {
+			t.Errorf("expected 5 chunks to be embedded, got %d", stats.Chunks)
+		}
+		if e.maxInFlight < 2 {
+			t.Errorf("expected concurrent embedding requests, got at most %d in flight", e.maxInFlight)
+		}
+		if e.maxInFlight > idx.Concurrency {
+			t.Errorf("expected at most %d requests in flight, got %d", idx.Concurrency, e.maxInFlight)
+		}
+	})
+	t.Run("transient errors are retried", func(t *testing.T) {
+		transient := llm.TransientError{Err: errors.New("overloaded")}
+		e := &recordingEmbedder{embedder: fake.New(), errors: []error{transient, transient}}
+		stats, err := newIndexer(e).Index(ctx, s)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Chunks != 5 {
+			t.Errorf("expected 5 chunks to be embedded, got %d", stats.Chunks)
+		}
+	})
+	t.Run("errors are returned once the retries are used up", func(t *testing.T) {
+		transient := llm.TransientError{Err: errors.New("overloaded")}
+		e := &recordingEmbedder{embedder: fake.New(), errors: []error{transient, transient}}
+		idx := newIndexer(e)
+		idx.MaxRetries = 1
+		if _, err := idx.Index(ctx, s); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+	t.Run("other errors are not retried", func(t *testing.T) {
+		e := &recordingEmbedder{embedder: fake.New(), errors: []error{errors.New("model not found")}}
+		if _, err := newIndexer(e).Index(ctx, s); err == nil {
+			t.Error("expected error, got nil")
+		}
+		if len(e.requests) != 1 {
+			t.Errorf("expected 1 request, got %d", len(e.requests))
+		}
+	})
+}
+
+func TestIndexTriples(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	s, err := site.New(site.SiteArgs{
+		Log:             log,
+		Dir:             fstest.MapFS{"apache.md": &fstest.MapFile{Data: []byte("# Apache\n\nAn attack helicopter.")}},
+		ContentHandlers: []site.DirEntryHandler{markdownHandler, directoryHandler},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q := newMemoryQuerier()
+	index := func(t *testing.T, response string) {
+		t.Helper()
+		chat := fake.New()
+		chat.Respond = func(req llm.ChatRequest) (string, error) {
+			return response, nil
+		}
+		idx := indexer.New(log, q, fake.New(), chat, "embed", "chat")
+		idx.Force = true
+		if _, err := idx.Index(ctx, s); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	t.Run("known types are stored", func(t *testing.T) {
+		index(t, `Outputs:
+  "Apache" rdf:type ies:Aircraft
+  "Apache" rdf:type ies:Aircraft
+  "Apache" rdf:type ies:AttackHelicopter
+  "Apache" rdf:type rdfs:Class
+  "Apache" ies:similarEntity "Tiger"
+The Apache is an aircraft.`)
+		expected := []db.Triple{
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft"},
+		}
+		if diff := cmp.Diff(expected, q.triples["/apache"]); diff != "" {
+			t.Errorf("unexpected triples (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("types are replaced when the document is indexed again", func(t *testing.T) {
+		index(t, `"Apache AH-64E" rdf:type ies:Vehicle`)
+		expected := []db.Triple{
+			{Subject: "Apache AH-64E", Predicate: "rdf:type", Object: "ies:Vehicle"},
+		}
+		if diff := cmp.Diff(expected, q.triples["/apache"]); diff != "" {
+			t.Errorf("unexpected triples (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("relationships with known predicates are stored if enabled", func(t *testing.T) {
+		var prompts []string
+		chat := fake.New()
+		chat.Respond = func(req llm.ChatRequest) (string, error) {
+			prompt := req.Messages[0].Content
+			prompts = append(prompts, prompt)
+			if strings.Contains(prompt, "extracted relationships") {
+				return `"Boeing" ies:make "Apache"
+"British Army" ies:owns "Apache"
+"Apache" ies:madeBy "Boeing"
+"Apache" ies:relationship "Lynx"`, nil
+			}
+			return `"Apache" rdf:type ies:Aircraft`, nil
+		}
+		idx := indexer.New(log, q, fake.New(), chat, "embed", "chat")
+		idx.Force = true
+		idx.ExtractRelationships = true
+		if _, err := idx.Index(ctx, s); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []db.Triple{
+			{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft"},
+			{Subject: "Boeing", Predicate: "ies:make", Object: "Apache"},
+			{Subject: "British Army", Predicate: "ies:owns", Object: "Apache"},
+		}
+		if diff := cmp.Diff(expected, q.triples["/apache"]); diff != "" {
+			t.Errorf("unexpected triples (-want +got):\n%s", diff)
+		}
+		if len(prompts) != 2 || !strings.Contains(prompts[1], `Use the subject "Apache".`) {
+			t.Errorf("expected the relationship prompt to use the document title as the subject")
+		}
+	})
+}
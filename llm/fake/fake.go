@@ -0,0 +1,99 @@
+package fake
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/a-h/ragmark/llm"
+)
+
+var _ llm.Embedder = &Client{}
+var _ llm.ChatCompleter = &Client{}
+
+// New creates a deterministic, in-process model for use in tests.
+//
+// Embeddings are created by hashing each word of the input into a vector, so texts
+// that share words are close to each other. Chat responses echo the last message,
+// unless Respond is set.
+func New() *Client {
+	return &Client{
+		Dimensions: 768,
+	}
+}
+
+type Client struct {
+	// Dimensions of the embeddings to return, defaults to 768 to match the database schema.
+	Dimensions int
+	// Respond returns the response to a chat request.
+	Respond func(req llm.ChatRequest) (response string, err error)
+}
+
+func (c *Client) Embed(ctx context.Context, req llm.EmbedRequest) (embeddings [][]float32, err error) {
+	embeddings = make([][]float32, len(req.Input))
+	for i, input := range req.Input {
+		embeddings[i] = c.embed(input)
+	}
+	return embeddings, nil
+}
+
+func (c *Client) embed(input string) (embedding []float32) {
+	embedding = make([]float32, c.Dimensions)
+	words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		// Use the low bits to pick a dimension, and the high bit for the sign.
+		value := float32(1)
+		if sum>>63 == 1 {
+			value = -1
+		}
+		embedding[sum%uint64(c.Dimensions)] += value
+	}
+	var norm float64
+	for _, v := range embedding {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		return embedding
+	}
+	norm = math.Sqrt(norm)
+	for i := range embedding {
+		embedding[i] = float32(float64(embedding[i]) / norm)
+	}
+	return embedding
+}
+
+func (c *Client) Chat(ctx context.Context, req llm.ChatRequest) (response string, err error) {
+	if c.Respond != nil {
+		return c.Respond(req)
+	}
+	if len(req.Messages) == 0 {
+		return "", nil
+	}
+	return req.Messages[len(req.Messages)-1].Content, nil
+}
+
+func (c *Client) ChatStream(ctx context.Context, req llm.ChatRequest, fn func(content string) error) (err error) {
+	response, err := c.Chat(ctx, req)
+	if err != nil {
+		return err
+	}
+	for _, word := range strings.SplitAfter(response, " ") {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if word == "" {
+			continue
+		}
+		if err = fn(word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
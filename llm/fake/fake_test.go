@@ -0,0 +1,107 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/google/go-cmp/cmp"
+)
+
+func dot(a, b []float32) (d float32) {
+	for i := range a {
+		d += a[i] * b[i]
+	}
+	return d
+}
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	c := fake.New()
+
+	t.Run("embeddings are deterministic", func(t *testing.T) {
+		a, err := c.Embed(ctx, llm.EmbedRequest{Input: []string{"The Challenger 2 tank"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b, err := c.Embed(ctx, llm.EmbedRequest{Input: []string{"The Challenger 2 tank"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff(a, b); diff != "" {
+			t.Errorf("expected identical embeddings:\n%s", diff)
+		}
+		if len(a[0]) != 768 {
+			t.Errorf("expected 768 dimensions, got %d", len(a[0]))
+		}
+	})
+	t.Run("texts that share words are closer than texts that do not", func(t *testing.T) {
+		embeddings, err := c.Embed(ctx, llm.EmbedRequest{
+			Input: []string{
+				"armoured tank with a rifled gun",
+				"the tank gun is rifled",
+				"helicopter rotor blades",
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		related := dot(embeddings[0], embeddings[1])
+		unrelated := dot(embeddings[0], embeddings[2])
+		if related <= unrelated {
+			t.Errorf("expected related similarity %v to be greater than unrelated similarity %v", related, unrelated)
+		}
+	})
+	t.Run("chat echoes the last message by default", func(t *testing.T) {
+		resp, err := c.Chat(ctx, llm.ChatRequest{
+			Messages: []llm.Message{
+				{Role: llm.RoleUser, Content: "first"},
+				{Role: llm.RoleUser, Content: "second"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp != "second" {
+			t.Errorf("expected %q, got %q", "second", resp)
+		}
+	})
+	t.Run("streamed chat produces the same response as chat", func(t *testing.T) {
+		c := fake.New()
+		c.Respond = func(req llm.ChatRequest) (string, error) {
+			return "The answer is 42.", nil
+		}
+		var sb strings.Builder
+		var parts int
+		err := c.ChatStream(ctx, llm.ChatRequest{}, func(content string) error {
+			sb.WriteString(content)
+			parts++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sb.String() != "The answer is 42." {
+			t.Errorf("unexpected response: %q", sb.String())
+		}
+		if parts != 4 {
+			t.Errorf("expected 4 parts, got %d", parts)
+		}
+	})
+	t.Run("chat errors are returned", func(t *testing.T) {
+		c := fake.New()
+		expected := errors.New("model unavailable")
+		c.Respond = func(req llm.ChatRequest) (string, error) {
+			return "", expected
+		}
+		err := c.ChatStream(ctx, llm.ChatRequest{}, func(content string) error {
+			return nil
+		})
+		if !errors.Is(err, expected) {
+			t.Errorf("expected error %v, got %v", expected, err)
+		}
+	})
+}
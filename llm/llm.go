@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	// Role of the message author, e.g. "user" or "assistant".
+	Role    string
+	Content string
+}
+
+type ChatRequest struct {
+	Model    string
+	Messages []Message
+}
+
+type EmbedRequest struct {
+	Model string
+	Input []string
+}
+
+// Embedder creates vector embeddings for text.
+type Embedder interface {
+	// Embed returns one embedding for each input, in the same order as the input.
+	Embed(ctx context.Context, req EmbedRequest) (embeddings [][]float32, err error)
+}
+
+// ChatCompleter sends chat messages to a model and returns the response.
+type ChatCompleter interface {
+	// Chat waits for the model to complete, and returns the full response.
+	Chat(ctx context.Context, req ChatRequest) (response string, err error)
+	// ChatStream calls fn with each part of the response as it is produced by the model.
+	ChatStream(ctx context.Context, req ChatRequest, fn func(content string) error) (err error)
+}
+
+// TransientError wraps an error that may not occur if the request is retried, e.g.
+// because the model server is overloaded, or still loading the model.
+type TransientError struct {
+	Err error
+}
+
+func (e TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e TransientError) Unwrap() error {
+	return e.Err
+}
+
+func (e TransientError) Temporary() bool {
+	return true
+}
+
+// IsTransientStatus returns true if a request that failed with the HTTP status code may succeed if retried.
+func IsTransientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// IsTransient returns true if the request that caused the error may succeed if retried.
+// Errors that implement Temporary() bool, e.g. TransientError, network timeouts, and
+// connections that were refused or reset are transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
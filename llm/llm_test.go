@@ -0,0 +1,32 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/a-h/ragmark/llm"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil is not transient", err: nil, expected: false},
+		{name: "other errors are not transient", err: errors.New("invalid request"), expected: false},
+		{name: "wrapped transient errors are transient", err: fmt.Errorf("failed: %w", llm.TransientError{Err: errors.New("busy")}), expected: true},
+		{name: "refused connections are transient", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), expected: true},
+		{name: "cancellation is not transient", err: fmt.Errorf("failed: %w", context.Canceled), expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := llm.IsTransient(tt.err); actual != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
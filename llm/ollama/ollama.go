@@ -0,0 +1,81 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/a-h/ragmark/llm"
+	ollamaapi "github.com/ollama/ollama/api"
+)
+
+var _ llm.Embedder = &Client{}
+var _ llm.ChatCompleter = &Client{}
+
+// New creates an adapter that uses the Ollama API client for embeddings and chat.
+func New(client *ollamaapi.Client) *Client {
+	return &Client{
+		client: client,
+	}
+}
+
+type Client struct {
+	client *ollamaapi.Client
+}
+
+func (c *Client) Embed(ctx context.Context, req llm.EmbedRequest) (embeddings [][]float32, err error) {
+	resp, err := c.client.Embed(ctx, &ollamaapi.EmbedRequest{
+		Model: req.Model,
+		Input: req.Input,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	if len(resp.Embeddings) != len(req.Input) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(req.Input), len(resp.Embeddings))
+	}
+	return resp.Embeddings, nil
+}
+
+func (c *Client) Chat(ctx context.Context, req llm.ChatRequest) (response string, err error) {
+	stream := false
+	var sb strings.Builder
+	r := newChatRequest(req)
+	r.Stream = &stream
+	err = c.client.Chat(ctx, r, func(resp ollamaapi.ChatResponse) error {
+		sb.WriteString(resp.Message.Content)
+		return nil
+	})
+	return sb.String(), convertError(err)
+}
+
+func (c *Client) ChatStream(ctx context.Context, req llm.ChatRequest, fn func(content string) error) (err error) {
+	err = c.client.Chat(ctx, newChatRequest(req), func(resp ollamaapi.ChatResponse) error {
+		return fn(resp.Message.Content)
+	})
+	return convertError(err)
+}
+
+// convertError marks Ollama status errors that may succeed if retried as transient.
+func convertError(err error) error {
+	var statusErr ollamaapi.StatusError
+	if errors.As(err, &statusErr) && llm.IsTransientStatus(statusErr.StatusCode) {
+		return llm.TransientError{Err: err}
+	}
+	return err
+}
+
+func newChatRequest(req llm.ChatRequest) *ollamaapi.ChatRequest {
+	messages := make([]ollamaapi.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = ollamaapi.Message{
+			Role:    m.Role,
+			Content: m.Content,
+		}
+	}
+	return &ollamaapi.ChatRequest{
+		Model:    req.Model,
+		Messages: messages,
+	}
+}
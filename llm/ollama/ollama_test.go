@@ -0,0 +1,129 @@
+package ollama_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/ollama"
+	"github.com/google/go-cmp/cmp"
+	ollamaapi "github.com/ollama/ollama/api"
+)
+
+func newServer(t *testing.T) (c *ollama.Client, close func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/embed", func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaapi.EmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.Model == "overloaded" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": "server busy"})
+			return
+		}
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "model not found"})
+			return
+		}
+		input := req.Input.([]any)
+		resp := ollamaapi.EmbedResponse{Model: req.Model}
+		for i := range input {
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(i), 1})
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaapi.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.Stream != nil && !*req.Stream {
+			json.NewEncoder(w).Encode(ollamaapi.ChatResponse{
+				Message: ollamaapi.Message{Role: "assistant", Content: "Hello, world"},
+				Done:    true,
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, part := range []string{"Hello", ", ", "world"} {
+			enc.Encode(ollamaapi.ChatResponse{
+				Message: ollamaapi.Message{Role: "assistant", Content: part},
+			})
+		}
+		enc.Encode(ollamaapi.ChatResponse{Done: true})
+	})
+	s := httptest.NewServer(mux)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+	return ollama.New(ollamaapi.NewClient(u, s.Client())), s.Close
+}
+
+func TestOllama(t *testing.T) {
+	ctx := context.Background()
+	c, close := newServer(t)
+	defer close()
+
+	t.Run("can create embeddings", func(t *testing.T) {
+		embeddings, err := c.Embed(ctx, llm.EmbedRequest{
+			Model: "nomic-embed-text",
+			Input: []string{"a", "b"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := [][]float32{{0, 1}, {1, 1}}
+		if diff := cmp.Diff(expected, embeddings); diff != "" {
+			t.Errorf("unexpected embeddings (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("overloaded server errors are transient", func(t *testing.T) {
+		_, err := c.Embed(ctx, llm.EmbedRequest{Model: "overloaded", Input: []string{"a"}})
+		if !llm.IsTransient(err) {
+			t.Errorf("expected transient error, got %v", err)
+		}
+	})
+	t.Run("missing model errors are not transient", func(t *testing.T) {
+		_, err := c.Embed(ctx, llm.EmbedRequest{Model: "missing", Input: []string{"a"}})
+		if err == nil || llm.IsTransient(err) {
+			t.Errorf("expected non-transient error, got %v", err)
+		}
+	})
+	t.Run("can chat without streaming", func(t *testing.T) {
+		resp, err := c.Chat(ctx, llm.ChatRequest{
+			Model:    "mistral-nemo",
+			Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp != "Hello, world" {
+			t.Errorf("unexpected response: %q", resp)
+		}
+	})
+	t.Run("can stream chat responses", func(t *testing.T) {
+		var parts []string
+		err := c.ChatStream(ctx, llm.ChatRequest{
+			Model:    "mistral-nemo",
+			Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}},
+		}, func(content string) error {
+			parts = append(parts, content)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := strings.Join(parts, ""); got != "Hello, world" {
+			t.Errorf("unexpected response: %q", got)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/a-h/ragmark/llm"
+)
+
+var _ llm.Embedder = &Client{}
+var _ llm.ChatCompleter = &Client{}
+
+// New creates a client for servers that implement the OpenAI embeddings and chat completions API,
+// such as vLLM and llama.cpp.
+//
+// The baseURL should include the API version, e.g. http://localhost:8000/v1
+func New(baseURL, apiKey string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		APIKey:     apiKey,
+		httpClient: httpClient,
+	}
+}
+
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	httpClient *http.Client
+}
+
+// StatusError is returned when the server responds with a non-2xx status code.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("openai: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("openai: unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary returns true if the request may succeed if retried, see llm.IsTransient.
+func (e StatusError) Temporary() bool {
+	return llm.IsTransientStatus(e.StatusCode)
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type errorResponse struct {
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embedding struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type embeddingsResponse struct {
+	Data []embedding `json:"data"`
+}
+
+func (c *Client) Embed(ctx context.Context, req llm.EmbedRequest) (embeddings [][]float32, err error) {
+	resp, err := c.post(ctx, "/embeddings", embeddingsRequest{
+		Model: req.Model,
+		Input: req.Input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var er embeddingsResponse
+	if err = json.NewDecoder(resp.Body).Decode(&er); err != nil {
+		return nil, fmt.Errorf("openai: failed to decode embeddings response: %w", err)
+	}
+	if len(er.Data) != len(req.Input) {
+		return nil, fmt.Errorf("openai: expected %d embeddings, got %d", len(req.Input), len(er.Data))
+	}
+	// The API does not guarantee the order of the results, so sort by index.
+	slices.SortFunc(er.Data, func(a, b embedding) int {
+		return a.Index - b.Index
+	})
+	embeddings = make([][]float32, len(er.Data))
+	for i, d := range er.Data {
+		embeddings[i] = d.Embedding
+	}
+	return embeddings, nil
+}
+
+type chatRequest struct {
+	Model    string    `json:"model"`
+	Messages []message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message message `json:"message"`
+		Delta   message `json:"delta"`
+	} `json:"choices"`
+}
+
+func newChatRequest(req llm.ChatRequest, stream bool) chatRequest {
+	cr := chatRequest{
+		Model:    req.Model,
+		Messages: make([]message, len(req.Messages)),
+		Stream:   stream,
+	}
+	for i, m := range req.Messages {
+		cr.Messages[i] = message{Role: m.Role, Content: m.Content}
+	}
+	return cr
+}
+
+func (c *Client) Chat(ctx context.Context, req llm.ChatRequest) (response string, err error) {
+	resp, err := c.post(ctx, "/chat/completions", newChatRequest(req, false))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var cr chatResponse
+	if err = json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return "", fmt.Errorf("openai: failed to decode chat response: %w", err)
+	}
+	if len(cr.Choices) == 0 {
+		return "", fmt.Errorf("openai: chat response contained no choices")
+	}
+	return cr.Choices[0].Message.Content, nil
+}
+
+func (c *Client) ChatStream(ctx context.Context, req llm.ChatRequest, fn func(content string) error) (err error) {
+	resp, err := c.post(ctx, "/chat/completions", newChatRequest(req, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// Server-sent events are made up of lines. Only the data lines are relevant.
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+		var er errorResponse
+		if err = json.Unmarshal([]byte(data), &er); err == nil && er.Error != nil {
+			return StatusError{StatusCode: resp.StatusCode, Message: er.Error.Message}
+		}
+		var cr chatResponse
+		if err = json.Unmarshal([]byte(data), &cr); err != nil {
+			return fmt.Errorf("openai: failed to decode chat stream event: %w", err)
+		}
+		for _, choice := range cr.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if err = fn(choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("openai: failed to read chat stream: %w", err)
+	}
+	return fmt.Errorf("openai: chat stream ended unexpectedly")
+}
+
+func (c *Client) post(ctx context.Context, path string, body any) (resp *http.Response, err error) {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("openai: failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("openai: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	resp, err = c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai: request failed: %w", err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	statusErr := StatusError{StatusCode: resp.StatusCode}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var er errorResponse
+	if json.Unmarshal(respBody, &er) == nil && er.Error != nil {
+		statusErr.Message = er.Error.Message
+	} else {
+		statusErr.Message = strings.TrimSpace(string(respBody))
+	}
+	return nil, statusErr
+}
@@ -0,0 +1,167 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/openai"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"invalid api key","type":"invalid_request_error"}}`)
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		// Return the results in reverse order to check that they're sorted.
+		var data []map[string]any
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, map[string]any{
+				"index":     i,
+				"embedding": []float32{float32(i), 0.5},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	})
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+			Stream bool `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		msg := req.Messages[len(req.Messages)-1].Content
+		if msg == "overloaded" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":{"message":"server overloaded"}}`)
+			return
+		}
+		if !req.Stream {
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Hello, world"}}]}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\", world\"}}]}\n\n")
+		if msg == "fail mid-stream" {
+			fmt.Fprint(w, "data: {\"error\":{\"message\":\"model crashed\"}}\n\n")
+			return
+		}
+		if msg == "truncate" {
+			return
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestOpenAI(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+	defer s.Close()
+	c := openai.New(s.URL+"/v1/", "key", s.Client())
+
+	stream := func(msg string) (response string, err error) {
+		var sb strings.Builder
+		err = c.ChatStream(ctx, llm.ChatRequest{
+			Model:    "model",
+			Messages: []llm.Message{{Role: llm.RoleUser, Content: msg}},
+		}, func(content string) error {
+			sb.WriteString(content)
+			return nil
+		})
+		return sb.String(), err
+	}
+
+	t.Run("embeddings are returned in input order", func(t *testing.T) {
+		embeddings, err := c.Embed(ctx, llm.EmbedRequest{Model: "model", Input: []string{"a", "b", "c"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := [][]float32{{0, 0.5}, {1, 0.5}, {2, 0.5}}
+		if diff := cmp.Diff(expected, embeddings); diff != "" {
+			t.Errorf("unexpected embeddings (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("API errors include the status code and message", func(t *testing.T) {
+		c := openai.New(s.URL+"/v1", "wrong", s.Client())
+		_, err := c.Embed(ctx, llm.EmbedRequest{Model: "model", Input: []string{"a"}})
+		var statusErr openai.StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("expected StatusError, got %v", err)
+		}
+		expected := openai.StatusError{StatusCode: http.StatusUnauthorized, Message: "invalid api key"}
+		if diff := cmp.Diff(expected, statusErr); diff != "" {
+			t.Errorf("unexpected error (-want +got):\n%s", diff)
+		}
+		if llm.IsTransient(err) {
+			t.Error("expected 401 errors not to be transient")
+		}
+	})
+	t.Run("can chat without streaming", func(t *testing.T) {
+		resp, err := c.Chat(ctx, llm.ChatRequest{
+			Model:    "model",
+			Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp != "Hello, world" {
+			t.Errorf("unexpected response: %q", resp)
+		}
+	})
+	t.Run("can stream chat responses", func(t *testing.T) {
+		resp, err := stream("Hi")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp != "Hello, world" {
+			t.Errorf("unexpected response: %q", resp)
+		}
+	})
+	t.Run("errors sent within the stream are returned", func(t *testing.T) {
+		_, err := stream("fail mid-stream")
+		if err == nil || !strings.Contains(err.Error(), "model crashed") {
+			t.Errorf("expected model crashed error, got %v", err)
+		}
+	})
+	t.Run("streams that end without a done message are an error", func(t *testing.T) {
+		_, err := stream("truncate")
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+	t.Run("error status codes are returned when streaming", func(t *testing.T) {
+		_, err := stream("overloaded")
+		var statusErr openai.StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("expected StatusError, got %v", err)
+		}
+		if statusErr.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected status 503, got %d", statusErr.StatusCode)
+		}
+		if !llm.IsTransient(err) {
+			t.Error("expected 503 errors to be transient")
+		}
+	})
+}
@@ -0,0 +1,174 @@
+// Package ontology reads hierarchies of RDF terms, e.g. the IES classes and predicates
+// used in the extraction prompts.
+//
+// Hierarchies are written as indented trees, with two spaces for each level:
+//
+//	rdfs:Class
+//	  ies:Vehicle
+//	    ies:Aircraft
+//
+// A term may appear more than once, under different parents.
+package ontology
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const indent = "  "
+
+// Hierarchy of terms.
+type Hierarchy struct {
+	roots    []string
+	parents  map[string][]string
+	children map[string][]string
+}
+
+// Parse an indented tree of terms.
+func Parse(r io.Reader) (h *Hierarchy, err error) {
+	h = &Hierarchy{
+		parents:  map[string][]string{},
+		children: map[string][]string{},
+	}
+	// path contains the term at each level of the current line's ancestry.
+	var path []string
+	scanner := bufio.NewScanner(r)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+		term := strings.TrimLeft(line, " ")
+		spaces := len(line) - len(term)
+		if spaces%len(indent) != 0 {
+			return nil, fmt.Errorf("ontology: line %d: indentation must be a multiple of %d spaces", lineNumber, len(indent))
+		}
+		level := spaces / len(indent)
+		if level > len(path) {
+			return nil, fmt.Errorf("ontology: line %d: %q is indented more than one level below its parent", lineNumber, term)
+		}
+		path = append(path[:level], term)
+		if level == 0 {
+			h.add("", term)
+			continue
+		}
+		h.add(path[level-1], term)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ontology: failed to read hierarchy: %w", err)
+	}
+	return h, nil
+}
+
+// add the term below the parent, or as a root if the parent is empty.
+func (h *Hierarchy) add(parent, term string) {
+	if _, exists := h.parents[term]; !exists {
+		h.parents[term] = nil
+	}
+	if parent == "" {
+		if !slices.Contains(h.roots, term) {
+			h.roots = append(h.roots, term)
+		}
+		return
+	}
+	if !slices.Contains(h.parents[term], parent) {
+		h.parents[term] = append(h.parents[term], parent)
+		h.children[parent] = append(h.children[parent], term)
+	}
+}
+
+// Roots returns the terms at the top level of the hierarchy.
+func (h *Hierarchy) Roots() []string {
+	return h.roots
+}
+
+// Contains returns true if the term is in the hierarchy.
+func (h *Hierarchy) Contains(term string) bool {
+	_, ok := h.parents[term]
+	return ok
+}
+
+// Parents returns the terms that the term is directly below.
+func (h *Hierarchy) Parents(term string) []string {
+	return h.parents[term]
+}
+
+// Children returns the terms that are directly below the term.
+func (h *Hierarchy) Children(term string) []string {
+	return h.children[term]
+}
+
+// IsA returns true if the term is the ancestor, or is below the ancestor in the hierarchy.
+func (h *Hierarchy) IsA(term, ancestor string) bool {
+	if !h.Contains(term) {
+		return false
+	}
+	seen := map[string]bool{}
+	queue := []string{term}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if t == ancestor {
+			return true
+		}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		queue = append(queue, h.parents[t]...)
+	}
+	return false
+}
+
+// Path returns the shortest path of terms from the ancestor to the term, including both,
+// or nil if the term isn't below the ancestor.
+func (h *Hierarchy) Path(term, ancestor string) (path []string) {
+	if !h.Contains(term) {
+		return nil
+	}
+	child := map[string]string{term: ""}
+	queue := []string{term}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if t == ancestor {
+			for ; t != ""; t = child[t] {
+				path = append(path, t)
+			}
+			return path
+		}
+		for _, parent := range h.parents[t] {
+			if _, seen := child[parent]; seen {
+				continue
+			}
+			child[parent] = t
+			queue = append(queue, parent)
+		}
+	}
+	return nil
+}
+
+// Descendants returns the term and the terms below it in the hierarchy, in breadth-first
+// order, or just the term if it isn't in the hierarchy.
+func (h *Hierarchy) Descendants(term string) (terms []string) {
+	seen := map[string]bool{term: true}
+	queue := []string{term}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		terms = append(terms, t)
+		for _, child := range h.children[t] {
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			queue = append(queue, child)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,100 @@
+package ontology_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/ontology"
+	"github.com/google/go-cmp/cmp"
+)
+
+const hierarchy = `rdfs:Class
+  ies:Asset
+    ies:Vehicle
+      ies:Aircraft
+      ies:RoadVehicle
+  ies:Location
+    ies:Airport
+rdfs:Resource
+  ies:Vehicle
+`
+
+func TestParse(t *testing.T) {
+	h, err := ontology.Parse(strings.NewReader(hierarchy))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Run("top level terms are roots", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"rdfs:Class", "rdfs:Resource"}, h.Roots()); diff != "" {
+			t.Errorf("unexpected roots (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("terms can have multiple parents", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"ies:Asset", "rdfs:Resource"}, h.Parents("ies:Vehicle")); diff != "" {
+			t.Errorf("unexpected parents (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("children are returned in order", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"ies:Aircraft", "ies:RoadVehicle"}, h.Children("ies:Vehicle")); diff != "" {
+			t.Errorf("unexpected children (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("path returns the terms from the ancestor to the term", func(t *testing.T) {
+		expected := []string{"rdfs:Class", "ies:Asset", "ies:Vehicle", "ies:Aircraft"}
+		if diff := cmp.Diff(expected, h.Path("ies:Aircraft", "rdfs:Class")); diff != "" {
+			t.Errorf("unexpected path (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("path is nil if the term isn't below the ancestor", func(t *testing.T) {
+		if path := h.Path("ies:Airport", "rdfs:Resource"); path != nil {
+			t.Errorf("expected nil, got %v", path)
+		}
+	})
+	t.Run("descendants include the term and the terms below it", func(t *testing.T) {
+		expected := []string{"ies:Asset", "ies:Vehicle", "ies:Aircraft", "ies:RoadVehicle"}
+		if diff := cmp.Diff(expected, h.Descendants("ies:Asset")); diff != "" {
+			t.Errorf("unexpected descendants (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("descendants of unknown terms are the term", func(t *testing.T) {
+		if diff := cmp.Diff([]string{"ies:Unknown"}, h.Descendants("ies:Unknown")); diff != "" {
+			t.Errorf("unexpected descendants (-want +got):\n%s", diff)
+		}
+	})
+	tests := []struct {
+		term, ancestor string
+		expected       bool
+	}{
+		{term: "ies:Aircraft", ancestor: "ies:Aircraft", expected: true},
+		{term: "ies:Aircraft", ancestor: "ies:Vehicle", expected: true},
+		{term: "ies:Aircraft", ancestor: "rdfs:Class", expected: true},
+		{term: "ies:Aircraft", ancestor: "rdfs:Resource", expected: true},
+		{term: "ies:Airport", ancestor: "ies:Vehicle", expected: false},
+		{term: "ies:Airport", ancestor: "rdfs:Resource", expected: false},
+		{term: "ies:Unknown", ancestor: "rdfs:Class", expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.term+" is a "+test.ancestor, func(t *testing.T) {
+			if actual := h.IsA(test.term, test.ancestor); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "odd indentation", input: "rdfs:Class\n   ies:Asset\n"},
+		{name: "skipped level", input: "rdfs:Class\n    ies:Asset\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ontology.Parse(strings.NewReader(test.input)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -4,24 +4,156 @@ import (
 	"embed"
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/ontology"
+	"github.com/a-h/ragmark/tokens"
 )
 
-func Chat(context []db.Chunk, msg string) string {
+type ChatArgs struct {
+	// Chunks of documents that are relevant to the message.
+	Chunks []db.Chunk
+	// Facts from the triple store about the entities in the message.
+	Facts []db.Triple
+	// Message is the user's question.
+	Message string
+}
+
+// Chat returns the prompt for a message. Each piece of context is numbered with its source,
+// see SourceNumbers, and the model is asked to cite the sources that it uses.
+func Chat(args ChatArgs) string {
 	var sb strings.Builder
 	sb.WriteString("Use the following pieces of context to answer the question at the end. If you don't know the answer, just say that you don't know, don't try to make up an answer.\n")
+	if len(args.Chunks) > 0 {
+		sb.WriteString("Each piece of context is numbered with its source. Cite the sources that you use with their number in square brackets, e.g. [1].\n")
+	}
 
-	for _, doc := range context {
-		sb.WriteString(fmt.Sprintf("Context from %s:\n%s\n\n", doc.Path, doc.Text))
+	numbers := SourceNumbers(args.Chunks)
+	for i, doc := range args.Chunks {
+		sb.WriteString(formatChunk(numbers[i], doc))
+	}
+	if len(args.Facts) > 0 {
+		sb.WriteString("Facts from the knowledge graph, as subject, predicate and object:\n")
+		for _, fact := range args.Facts {
+			sb.WriteString(formatFact(fact))
+		}
+		sb.WriteString("\n")
 	}
 	sb.WriteString("Question: ")
-	sb.WriteString(msg)
+	sb.WriteString(args.Message)
 	sb.WriteString("\nSuccint Answer: ")
 	return sb.String()
 }
 
+// SourceNumbers returns the source number of each chunk, starting from 1. Chunks from the same
+// section of a document are the same source, and sources are numbered in order of their first
+// chunk.
+func SourceNumbers(chunks []db.Chunk) (numbers []int) {
+	numbers = make([]int, len(chunks))
+	sources := map[[2]string]int{}
+	for i, chunk := range chunks {
+		key := [2]string{chunk.Path, chunk.Heading}
+		n, ok := sources[key]
+		if !ok {
+			n = len(sources) + 1
+			sources[key] = n
+		}
+		numbers[i] = n
+	}
+	return numbers
+}
+
+// History returns the most recent messages of a conversation that fit within maxTokens,
+// oldest first, to send to the model before the prompt for the latest message. The oldest
+// message returned is from the user, so that the model doesn't see an answer without its
+// question.
+func History(messages []llm.Message, maxTokens int) (history []llm.Message) {
+	start := len(messages)
+	var total int
+	for i := len(messages) - 1; i >= 0; i-- {
+		total += tokens.Estimate(messages[i].Content)
+		if total > maxTokens {
+			break
+		}
+		if messages[i].Role == llm.RoleUser {
+			start = i
+		}
+	}
+	return messages[start:]
+}
+
+// CondenseQuestion asks the model to rewrite the latest message of a conversation as a
+// standalone search query, so that follow-up questions such as "what's its top speed?"
+// can be used to find context.
+func CondenseQuestion(history []llm.Message, message string) string {
+	var sb strings.Builder
+	sb.WriteString("Given the following conversation and a follow-up question, rephrase the follow-up question to be a standalone question that can be understood without the conversation. Replace pronouns and references with the names that they refer to. Reply with the standalone question only.\n\n")
+	sb.WriteString("Conversation:\n")
+	for _, msg := range history {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	}
+	sb.WriteString("\nFollow-up question: ")
+	sb.WriteString(message)
+	sb.WriteString("\nStandalone question: ")
+	return sb.String()
+}
+
+// Relevance asks the model to score how relevant a chunk of a document is to a search query,
+// so that the chunks found by search can be reranked.
+func Relevance(query string, chunk db.Chunk) string {
+	var sb strings.Builder
+	sb.WriteString("Rate how relevant the following document is to the search query, from 0 (not relevant) to 10 (answers the query). Reply with the number only.\n\n")
+	sb.WriteString("Query: ")
+	sb.WriteString(query)
+	if chunk.Heading != "" {
+		sb.WriteString(fmt.Sprintf("\n\nDocument %s, section %q:\n", chunk.Path, chunk.Heading))
+	} else {
+		sb.WriteString(fmt.Sprintf("\n\nDocument %s:\n", chunk.Path))
+	}
+	sb.WriteString(chunk.Text)
+	sb.WriteString("\n\nRelevance: ")
+	return sb.String()
+}
+
+func formatChunk(number int, doc db.Chunk) string {
+	if doc.Heading != "" {
+		return fmt.Sprintf("[%d] Context from %s, section %q:\n%s\n\n", number, doc.Path, doc.Heading, doc.Text)
+	}
+	return fmt.Sprintf("[%d] Context from %s:\n%s\n\n", number, doc.Path, doc.Text)
+}
+
+func formatFact(fact db.Triple) string {
+	s := fmt.Sprintf("  %q %s %s", fact.Subject, fact.Predicate, formatObject(fact.Object))
+	if fact.Source != "" {
+		s += fmt.Sprintf(" (from %s)", fact.Source)
+	}
+	return s + "\n"
+}
+
+// ChunkTokens estimates the number of tokens that the chunk adds to the Chat prompt.
+func ChunkTokens(chunk db.Chunk) int {
+	return tokens.Estimate(formatChunk(0, chunk))
+}
+
+// FactTokens estimates the number of tokens that the fact adds to the Chat prompt.
+func FactTokens(fact db.Triple) int {
+	return tokens.Estimate(formatFact(fact))
+}
+
+// formatObject quotes literal objects, but not prefixed names such as ies:Vehicle.
+func formatObject(o string) string {
+	if prefixedNamePattern.MatchString(o) {
+		return o
+	}
+	return fmt.Sprintf("%q", o)
+}
+
+var prefixedNamePattern = regexp.MustCompile(`^[A-Za-z][\w-]*:[\w-]+$`)
+
 func Summarise(content string) string {
 	var sb strings.Builder
 	sb.WriteString("Summarise the following markdown document. Include main keywords.\n")
@@ -29,9 +161,73 @@ func Summarise(content string) string {
 	return sb.String()
 }
 
+// ExtractionVersion of the ExtractType and ExtractRelationships prompts and hierarchies.
+// Change it when they change, so that triples are extracted again when documents are next
+// indexed.
+const ExtractionVersion = "extract-1"
+
 //go:embed rdf
 var rdfFS embed.FS
 
+var typeHierarchy = sync.OnceValues(func() (*ontology.Hierarchy, error) {
+	return parseHierarchy("rdf/ies_types.rdf")
+})
+
+// TypeHierarchy returns the hierarchy of types used by the ExtractType prompt. Classes
+// are below rdfs:Class.
+func TypeHierarchy() (h *ontology.Hierarchy, err error) {
+	return typeHierarchy()
+}
+
+var relationshipHierarchy = sync.OnceValues(func() (*ontology.Hierarchy, error) {
+	return parseHierarchy("rdf/ies_relationships.rdf")
+})
+
+// RelationshipHierarchy returns the hierarchy of predicates used by the ExtractRelationships
+// prompt. Predicates are below ies:relationship.
+func RelationshipHierarchy() (h *ontology.Hierarchy, err error) {
+	return relationshipHierarchy()
+}
+
+func parseHierarchy(name string) (h *ontology.Hierarchy, err error) {
+	f, err := rdfFS.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+	if h, err = ontology.Parse(f); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return h, nil
+}
+
+// statementPattern matches a statement in model output, e.g. "Heathrow Airport" rdf:type ies:Airport,
+// or "London" ies:nearTo "Oxford". List markers, a colon after the predicate, and a trailing
+// full stop are allowed.
+var statementPattern = regexp.MustCompile(`^(?:[-*]|\d+\.)?\s*"([^"]+)"\s+([A-Za-z][\w-]*:[\w-]+):?\s+(?:"([^"]+)"|([A-Za-z][\w-]*:[\w-]+))\s*\.?$`)
+
+// ParseStatements parses the statements in the output of the ExtractType and ExtractRelationships
+// prompts. Lines that aren't statements are ignored.
+func ParseStatements(output string) (statements []db.Triple) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(strings.ReplaceAll(line, "`", ""))
+		m := statementPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		object := m[3]
+		if object == "" {
+			object = m[4]
+		}
+		statements = append(statements, db.Triple{
+			Subject:   strings.TrimSpace(m[1]),
+			Predicate: m[2],
+			Object:    strings.TrimSpace(object),
+		})
+	}
+	return statements
+}
+
 func ExtractRelationships(subject, content string) (s string, err error) {
 	var sb strings.Builder
 	sb.WriteString("Use the provided hierarchy of known RDF predicates to extract subject, predicate and objects from the markdown document. Quote the subject and objects.\n")
@@ -43,7 +239,7 @@ func ExtractRelationships(subject, content string) (s string, err error) {
 	sb.WriteString(fmt.Sprintf("Use the subject %q.\n", subject))
 	sb.WriteString("\n")
 	sb.WriteString("Here is a tree of known RDF predicates:\n\n")
-	f, err := rdfFS.Open("./ies_relationships.rdf")
+	f, err := rdfFS.Open("rdf/ies_relationships.rdf")
 	if err != nil {
 		return s, fmt.Errorf("failed to open relationships file: %w", err)
 	}
@@ -67,7 +263,7 @@ func ExtractType(content string) (s string, err error) {
 	sb.WriteString("  \"Heathrow Airport\" rdf:type ies:Airport\n")
 	sb.WriteString("  \"Islam\" rdf:type ies:Religion\n")
 	sb.WriteString("  \"GBP\" rdf:type ies:Currency\n")
-	sb.WriteString("  \"Apple iPhone\" rdf:type: ies:MobileHandset\n")
+	sb.WriteString("  \"Apple iPhone\" rdf:type ies:MobileHandset\n")
 	sb.WriteString("\n")
 	sb.WriteString("Here is a tree of known RDF predicates:\n\n")
 	f, err := rdfFS.Open("rdf/ies_types.rdf")
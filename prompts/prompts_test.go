@@ -0,0 +1,138 @@
+package prompts_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/prompts"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseStatements(t *testing.T) {
+	output := `Here are the types:
+  "UK" rdf:type ies:Country
+- "Heathrow Airport" rdf:type ies:Airport.
+1. "Apple iPhone" rdf:type: ies:MobileHandset
+` + "`\"GBP\" rdf:type ies:Currency`" + `
+"London" ies:nearTo "Oxford"
+UK is a country.
+"Unquoted object" rdf:type Country
+`
+	expected := []db.Triple{
+		{Subject: "UK", Predicate: "rdf:type", Object: "ies:Country"},
+		{Subject: "Heathrow Airport", Predicate: "rdf:type", Object: "ies:Airport"},
+		{Subject: "Apple iPhone", Predicate: "rdf:type", Object: "ies:MobileHandset"},
+		{Subject: "GBP", Predicate: "rdf:type", Object: "ies:Currency"},
+		{Subject: "London", Predicate: "ies:nearTo", Object: "Oxford"},
+	}
+	if diff := cmp.Diff(expected, prompts.ParseStatements(output)); diff != "" {
+		t.Errorf("unexpected statements (-want +got):\n%s", diff)
+	}
+}
+
+func TestTypeHierarchy(t *testing.T) {
+	h, err := prompts.TypeHierarchy()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !h.IsA("ies:Aircraft", "rdfs:Class") {
+		t.Error("expected ies:Aircraft to be a class")
+	}
+	if h.IsA("ies:inLanguage", "rdfs:Class") {
+		t.Error("expected ies:inLanguage not to be a class")
+	}
+}
+
+func TestRelationshipHierarchy(t *testing.T) {
+	h, err := prompts.RelationshipHierarchy()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !h.IsA("ies:successorTo", "ies:relationship") {
+		t.Error("expected ies:successorTo to be a relationship")
+	}
+}
+
+func TestExtractRelationships(t *testing.T) {
+	prompt, err := prompts.ExtractRelationships("Apache", "The Apache is made by Boeing.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(prompt, "ies:successorTo") {
+		t.Error("expected the prompt to include the relationship hierarchy")
+	}
+}
+
+func TestChat(t *testing.T) {
+	prompt := prompts.Chat(prompts.ChatArgs{
+		Chunks: []db.Chunk{{Path: "/combat-vehicles/challenger", Heading: "Challenger 2", Text: "A main battle tank."}},
+		Facts: []db.Triple{
+			{Subject: "BAE Systems", Predicate: "ies:make", Object: "Challenger 2", Source: "/combat-vehicles/challenger"},
+			{Subject: "Challenger 2", Predicate: "rdf:type", Object: "ies:Vehicle"},
+		},
+		Message: "Who makes the Challenger 2?",
+	})
+	for _, expected := range []string{
+		"[1] Context from /combat-vehicles/challenger, section \"Challenger 2\":\nA main battle tank.\n",
+		"  \"BAE Systems\" ies:make \"Challenger 2\" (from /combat-vehicles/challenger)\n",
+		"  \"Challenger 2\" rdf:type ies:Vehicle\n",
+		"Question: Who makes the Challenger 2?",
+	} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("expected prompt to contain %q, got:\n%s", expected, prompt)
+		}
+	}
+}
+
+func TestRelevance(t *testing.T) {
+	prompt := prompts.Relevance("Who makes the Warrior?", db.Chunk{Path: "/combat-vehicles/warrior", Heading: "Warrior", Text: "Made by BAE Systems."})
+	for _, expected := range []string{
+		"Query: Who makes the Warrior?",
+		"Document /combat-vehicles/warrior, section \"Warrior\":\nMade by BAE Systems.",
+	} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("expected prompt to contain %q, got:\n%s", expected, prompt)
+		}
+	}
+}
+
+func TestSourceNumbers(t *testing.T) {
+	chunks := []db.Chunk{
+		{Path: "/aircraft/apache", Heading: "Armament", Index: 3},
+		{Path: "/aircraft/apache", Heading: "Armament", Index: 4},
+		{Path: "/aircraft/apache", Heading: "Sensors", Index: 5},
+		{Path: "/aircraft/wildcat", Heading: "Armament", Index: 2},
+		{Path: "/aircraft/apache", Heading: "Armament", Index: 1},
+	}
+	if diff := cmp.Diff([]int{1, 1, 2, 3, 1}, prompts.SourceNumbers(chunks)); diff != "" {
+		t.Errorf("unexpected numbers (-want +got):\n%s", diff)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	messages := []llm.Message{
+		{Role: llm.RoleUser, Content: "What is the Warrior?"},
+		{Role: llm.RoleAssistant, Content: "The Warrior is a tracked armoured vehicle."},
+		{Role: llm.RoleUser, Content: "Who makes it?"},
+		{Role: llm.RoleAssistant, Content: "BAE Systems."},
+	}
+	tests := []struct {
+		name      string
+		maxTokens int
+		expected  []llm.Message
+	}{
+		{name: "all messages are returned if they fit", maxTokens: 100, expected: messages},
+		{name: "the oldest messages are removed first", maxTokens: 10, expected: messages[2:]},
+		{name: "answers without their question are removed", maxTokens: 4, expected: []llm.Message{}},
+		{name: "no messages are returned with no budget", maxTokens: 0, expected: []llm.Message{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.expected, prompts.History(messages, tt.maxTokens)); diff != "" {
+				t.Errorf("unexpected history (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/prompts"
+)
+
+type chunkKey struct {
+	path  string
+	index int
+}
+
+// chunkRange is a range of chunk indexes in a document, inclusive.
+type chunkRange struct {
+	path       string
+	start, end int
+}
+
+// assembleContext returns the candidates and up to ContextWindow chunks either side of each,
+// within maxTokens, or without a limit if maxTokens is zero. The origin of each chunk is the
+// candidate that it was added for.
+//
+// The candidates are added first, best first, then their surrounding chunks, nearest first.
+// If a candidate doesn't fit, its text is truncated at a line or sentence, and no more chunks
+// are added. The chunks are returned as passages of consecutive chunks in document order,
+// ordered by their best candidate.
+func (r *RAG) assembleContext(ctx context.Context, candidates []Candidate, maxTokens int) (result []db.Chunk, origins []Candidate, err error) {
+	chunks, err := r.getRanges(ctx, candidates)
+	if err != nil {
+		return result, origins, err
+	}
+
+	origin := map[chunkKey]int{}
+	var used int
+	add := func(c db.Chunk, candidate int) (ok bool) {
+		tokens := prompts.ChunkTokens(c)
+		if maxTokens > 0 && used+tokens > maxTokens {
+			return false
+		}
+		used += tokens
+		key := chunkKey{c.Path, c.Index}
+		chunks[key] = c
+		origin[key] = candidate
+		return true
+	}
+
+	full := false
+	for i, candidate := range candidates {
+		key := chunkKey{candidate.Path, candidate.Index}
+		if _, ok := origin[key]; ok {
+			continue
+		}
+		c, ok := chunks[key]
+		if !ok {
+			c = candidate.Chunk
+		}
+		if add(c, i) {
+			continue
+		}
+		if truncated, ok := truncate(c, maxTokens-used); ok {
+			add(truncated, i)
+		}
+		full = true
+		break
+	}
+	for distance := 1; distance <= r.ContextWindow && !full; distance++ {
+		for i, candidate := range candidates {
+			if _, ok := origin[chunkKey{candidate.Path, candidate.Index}]; !ok {
+				continue
+			}
+			for _, index := range []int{candidate.Index - distance, candidate.Index + distance} {
+				key := chunkKey{candidate.Path, index}
+				c, exists := chunks[key]
+				if _, added := origin[key]; !exists || added {
+					continue
+				}
+				if !add(c, i) {
+					full = true
+					break
+				}
+			}
+			if full {
+				break
+			}
+		}
+	}
+
+	for _, p := range passages(origin) {
+		for _, key := range p {
+			result = append(result, chunks[key])
+			origins = append(origins, candidates[origin[key]])
+		}
+	}
+	r.Log.Info("assembled context", slog.Int("chunks", len(result)), slog.Int("tokens", used), slog.Int("maxTokens", maxTokens))
+	return result, origins, nil
+}
+
+// getRanges returns the chunks within ContextWindow of each candidate. Overlapping ranges in
+// the same document are merged, so that each chunk is only selected once.
+func (r *RAG) getRanges(ctx context.Context, candidates []Candidate) (chunks map[chunkKey]db.Chunk, err error) {
+	ranges := make([]chunkRange, len(candidates))
+	for i, c := range candidates {
+		ranges[i] = chunkRange{path: c.Path, start: c.Index - r.ContextWindow, end: c.Index + r.ContextWindow}
+	}
+	chunks = map[chunkKey]db.Chunk{}
+	for _, cr := range mergeRanges(ranges) {
+		chunksInRange, err := r.queries.ChunkSelectRange(ctx, db.ChunkSelectRangeArgs{
+			Path:       cr.path,
+			StartIndex: cr.start,
+			EndIndex:   cr.end,
+		})
+		if err != nil {
+			return chunks, fmt.Errorf("failed to select chunk range: %w", err)
+		}
+		for _, c := range chunksInRange {
+			chunks[chunkKey{c.Path, c.Index}] = c
+		}
+	}
+	return chunks, nil
+}
+
+// mergeRanges merges overlapping and adjacent ranges in the same document.
+func mergeRanges(ranges []chunkRange) (merged []chunkRange) {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b chunkRange) int {
+		return cmp.Or(strings.Compare(a.path, b.path), cmp.Compare(a.start, b.start))
+	})
+	for _, cr := range sorted {
+		if n := len(merged); n > 0 && merged[n-1].path == cr.path && cr.start <= merged[n-1].end+1 {
+			merged[n-1].end = max(merged[n-1].end, cr.end)
+			continue
+		}
+		merged = append(merged, cr)
+	}
+	return merged
+}
+
+// passages groups the chunks into runs of consecutive chunks in the same document, in
+// document order. The passages are ordered by the best candidate that they contain, which
+// is the lowest origin.
+func passages(origin map[chunkKey]int) (result [][]chunkKey) {
+	keys := make([]chunkKey, 0, len(origin))
+	for key := range origin {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b chunkKey) int {
+		return cmp.Or(strings.Compare(a.path, b.path), cmp.Compare(a.index, b.index))
+	})
+	var priorities []int
+	for i, key := range keys {
+		if i > 0 && keys[i-1].path == key.path && keys[i-1].index+1 == key.index {
+			n := len(result) - 1
+			result[n] = append(result[n], key)
+			priorities[n] = min(priorities[n], origin[key])
+			continue
+		}
+		result = append(result, []chunkKey{key})
+		priorities = append(priorities, origin[key])
+	}
+	order := make([]int, len(result))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(priorities[a], priorities[b])
+	})
+	sorted := make([][]chunkKey, len(result))
+	for i, j := range order {
+		sorted[i] = result[j]
+	}
+	return sorted
+}
+
+// truncationMarker is added to the end of truncated text.
+const truncationMarker = " …"
+
+var boundaryPattern = regexp.MustCompile(`(\n|[.!?]\s)`)
+
+// truncate returns the chunk with its text cut at the last line or sentence that fits in
+// maxTokens, or at a word if there's no complete sentence. It returns false if none of the
+// text fits.
+func truncate(c db.Chunk, maxTokens int) (truncated db.Chunk, ok bool) {
+	fits := func(text string) bool {
+		t := c
+		t.Text = text + truncationMarker
+		return prompts.ChunkTokens(t) <= maxTokens
+	}
+	// The estimate grows with the length of the text, so find the longest prefix that fits.
+	lo, hi := 0, len(c.Text)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(c.Text[:mid]) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	prefix := c.Text[:lo]
+	if matches := boundaryPattern.FindAllStringIndex(prefix, -1); len(matches) > 0 {
+		prefix = prefix[:matches[len(matches)-1][0]+1]
+	} else if i := strings.LastIndexAny(prefix, " \t"); i >= 0 {
+		prefix = prefix[:i]
+	} else {
+		prefix = ""
+	}
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return c, false
+	}
+	c.Text = prefix + truncationMarker
+	return c, true
+}
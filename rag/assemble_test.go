@@ -0,0 +1,105 @@
+package rag_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/prompts"
+	"github.com/a-h/ragmark/rag"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetContextAssembly(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	text := func(path string, index int, s string) db.Chunk {
+		return db.Chunk{Path: path, Index: index, Text: s}
+	}
+	q := querier{
+		nearest: []db.ChunkSelectNearestResult{
+			{Chunk: text("/warrior", 4, "The Warrior is made by BAE Systems."), Distance: 0.1},
+			{Chunk: text("/scimitar", 1, "The Scimitar is a reconnaissance vehicle."), Distance: 0.2},
+			{Chunk: text("/warrior", 2, "The Warrior entered service in 1988."), Distance: 0.3},
+		},
+		chunks: []db.Chunk{
+			text("/warrior", 1, "Introduction."),
+			text("/warrior", 2, "The Warrior entered service in 1988."),
+			text("/warrior", 3, "It served in the Gulf War."),
+			text("/warrior", 4, "The Warrior is made by BAE Systems."),
+			text("/warrior", 5, "It has a 30mm cannon."),
+			text("/scimitar", 0, "Scimitar."),
+			text("/scimitar", 1, "The Scimitar is a reconnaissance vehicle."),
+			text("/scimitar", 2, "It is made by Alvis."),
+		},
+	}
+	r := rag.New(log, q, fake.New(), "model")
+	tokens := func(indexes ...db.Chunk) (n int) {
+		for _, c := range indexes {
+			n += prompts.ChunkTokens(c)
+		}
+		return n
+	}
+
+	tests := []struct {
+		name          string
+		contextTokens int
+		expected      []db.Chunk
+	}{
+		{
+			name:          "overlapping ranges are merged into passages in document order, best first",
+			contextTokens: 0,
+			expected: []db.Chunk{
+				chunk("/warrior", 1), chunk("/warrior", 2), chunk("/warrior", 3), chunk("/warrior", 4), chunk("/warrior", 5),
+				chunk("/scimitar", 0), chunk("/scimitar", 1), chunk("/scimitar", 2),
+			},
+		},
+		{
+			name:          "search results are added before surrounding chunks",
+			contextTokens: tokens(q.nearest[0].Chunk, q.nearest[1].Chunk, q.nearest[2].Chunk),
+			expected:      []db.Chunk{chunk("/warrior", 4), chunk("/scimitar", 1), chunk("/warrior", 2)},
+		},
+		{
+			name:          "surrounding chunks of the best results are added first",
+			contextTokens: tokens(q.nearest[0].Chunk, q.nearest[1].Chunk, q.nearest[2].Chunk, q.chunks[2]),
+			expected:      []db.Chunk{chunk("/warrior", 2), chunk("/warrior", 3), chunk("/warrior", 4), chunk("/scimitar", 1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := r.GetContext(ctx, "Who makes the Warrior?", rag.Options{Mode: rag.ModeVector, ContextTokens: tt.contextTokens})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var actual []db.Chunk
+			for _, c := range c.Chunks {
+				actual = append(actual, chunk(c.Path, c.Index))
+			}
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+			}
+			if tt.contextTokens > 0 && tokens(c.Chunks...) > tt.contextTokens {
+				t.Errorf("expected at most %d tokens, got %d", tt.contextTokens, tokens(c.Chunks...))
+			}
+		})
+	}
+	t.Run("chunks that don't fit are truncated at a sentence", func(t *testing.T) {
+		long := text("/challenger", 0, "The Challenger 2 is a main battle tank. It is made by BAE Systems. It entered service in 1998, and served in Iraq.")
+		r := rag.New(log, querier{nearest: []db.ChunkSelectNearestResult{{Chunk: long}}, chunks: []db.Chunk{long}}, fake.New(), "model")
+		maxTokens := tokens(db.Chunk{Path: long.Path, Text: "The Challenger 2 is a main battle tank. It is made by BAE Systems. It entered"})
+		c, err := r.GetContext(ctx, "Who makes the Challenger 2?", rag.Options{Mode: rag.ModeVector, ContextTokens: maxTokens})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(c.Chunks) != 1 {
+			t.Fatalf("expected 1 chunk, got %d", len(c.Chunks))
+		}
+		if !strings.HasSuffix(c.Chunks[0].Text, "It is made by BAE Systems. …") {
+			t.Errorf("expected the text to be truncated after a sentence, got %q", c.Chunks[0].Text)
+		}
+	})
+}
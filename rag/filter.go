@@ -0,0 +1,102 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/prompts"
+)
+
+// FilterArgs are the fields of a filter as text, as entered in the chat form, on the command
+// line, or in the JSON API.
+type FilterArgs struct {
+	// Path restricts search to a page, e.g. /aircraft/apache.
+	Path string
+	// IncludeChildren also searches the pages below Path.
+	IncludeChildren bool
+	// PathPrefix restricts search to a section of the site, e.g. /aircraft/.
+	PathPrefix string
+	// Type is the type in the metadata of the documents, e.g. aircraft.
+	Type string
+	// LastModFrom and LastModTo are dates, e.g. 2024-10-01, or RFC 3339 times. Dates
+	// include the whole day.
+	LastModFrom string
+	LastModTo   string
+	// RDFTypes are classes in the type hierarchy, e.g. ies:Aircraft. Documents of any of
+	// the types, or their subclasses, are searched.
+	RDFTypes []string
+}
+
+// IsZero returns true if none of the fields are set.
+func (args FilterArgs) IsZero() bool {
+	return args.Path == "" && args.PathPrefix == "" && args.Type == "" && args.LastModFrom == "" && args.LastModTo == "" && len(args.RDFTypes) == 0
+}
+
+const dateLayout = "2006-01-02"
+
+// ParseFilter returns the filter with the given fields.
+func ParseFilter(args FilterArgs) (f db.ChunkFilter, err error) {
+	f.Path = strings.TrimSpace(args.Path)
+	f.IncludeChildren = args.IncludeChildren
+	f.PathPrefix = strings.TrimSpace(args.PathPrefix)
+	f.Type = strings.TrimSpace(args.Type)
+	if f.LastModFrom, err = parseTime(args.LastModFrom, false); err != nil {
+		return f, fmt.Errorf("invalid last modified from time: %w", err)
+	}
+	if f.LastModTo, err = parseTime(args.LastModTo, true); err != nil {
+		return f, fmt.Errorf("invalid last modified to time: %w", err)
+	}
+	if !f.LastModFrom.IsZero() && !f.LastModTo.IsZero() && f.LastModTo.Before(f.LastModFrom) {
+		return f, fmt.Errorf("the last modified range ends before it starts")
+	}
+	for _, t := range args.RDFTypes {
+		if t = strings.TrimSpace(t); t != "" {
+			f.RDFTypes = append(f.RDFTypes, t)
+		}
+	}
+	return f, nil
+}
+
+// parseTime parses a date or RFC 3339 time. If end is true, dates are parsed as the last
+// second of the day.
+func parseTime(s string, end bool) (t time.Time, err error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return t, nil
+	}
+	if t, err = time.Parse(dateLayout, s); err == nil {
+		if end {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+		return t, nil
+	}
+	if t, err = time.Parse(time.RFC3339, s); err != nil {
+		return t, fmt.Errorf("expected a date such as 2024-10-01, got %q", s)
+	}
+	return t, nil
+}
+
+// expandTypes adds the subclasses of the filter's RDF types from the type hierarchy, so that
+// filtering by ies:Vehicle includes documents classified as ies:Aircraft.
+func expandTypes(f db.ChunkFilter) (db.ChunkFilter, error) {
+	if len(f.RDFTypes) == 0 {
+		return f, nil
+	}
+	h, err := prompts.TypeHierarchy()
+	if err != nil {
+		return f, fmt.Errorf("failed to load type hierarchy: %w", err)
+	}
+	seen := map[string]bool{}
+	var types []string
+	for _, t := range f.RDFTypes {
+		for _, d := range h.Descendants(t) {
+			if !seen[d] {
+				seen[d] = true
+				types = append(types, d)
+			}
+		}
+	}
+	f.RDFTypes = types
+	return f, nil
+}
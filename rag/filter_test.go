@@ -0,0 +1,100 @@
+package rag_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        rag.FilterArgs
+		expected    db.ChunkFilter
+		expectedErr bool
+	}{
+		{
+			name:     "empty fields don't filter",
+			args:     rag.FilterArgs{RDFTypes: []string{" "}},
+			expected: db.ChunkFilter{},
+		},
+		{
+			name: "dates include the whole of the last day",
+			args: rag.FilterArgs{PathPrefix: " /aircraft/ ", Type: "aircraft", LastModFrom: "2024-10-01", LastModTo: "2024-10-31", RDFTypes: []string{"ies:Aircraft"}},
+			expected: db.ChunkFilter{
+				PathPrefix:  "/aircraft/",
+				Type:        "aircraft",
+				LastModFrom: time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC),
+				LastModTo:   time.Date(2024, time.October, 31, 23, 59, 59, 0, time.UTC),
+				RDFTypes:    []string{"ies:Aircraft"},
+			},
+		},
+		{
+			name:     "a page and its children",
+			args:     rag.FilterArgs{Path: " /aircraft ", IncludeChildren: true},
+			expected: db.ChunkFilter{Path: "/aircraft", IncludeChildren: true},
+		},
+		{
+			name:     "times can be RFC 3339",
+			args:     rag.FilterArgs{LastModFrom: "2024-10-01T12:00:00Z"},
+			expected: db.ChunkFilter{LastModFrom: time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:        "invalid dates are an error",
+			args:        rag.FilterArgs{LastModFrom: "last tuesday"},
+			expectedErr: true,
+		},
+		{
+			name:        "ranges that end before they start are an error",
+			args:        rag.FilterArgs{LastModFrom: "2024-10-02", LastModTo: "2024-10-01"},
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := rag.ParseFilter(tt.args)
+			if tt.expectedErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("unexpected filter (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	var filters []db.ChunkFilter
+	r := rag.New(log, querier{filters: &filters}, fake.New(), "model")
+
+	filter := db.ChunkFilter{PathPrefix: "/aircraft/", RDFTypes: []string{"ies:Vehicle"}}
+	if _, err := r.Search(context.Background(), "Which aircraft have rotors?", rag.Options{Mode: rag.ModeHybrid, Filter: filter}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filters) != 2 {
+		t.Fatalf("expected the vector and full-text searches to be filtered, got %d searches", len(filters))
+	}
+	for _, f := range filters {
+		if f.PathPrefix != "/aircraft/" {
+			t.Errorf("expected the path prefix to be used, got %q", f.PathPrefix)
+		}
+		if !slices.Contains(f.RDFTypes, "ies:Vehicle") || !slices.Contains(f.RDFTypes, "ies:Aircraft") {
+			t.Errorf("expected the type and its subclasses, got %v", f.RDFTypes)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"github.com/a-h/ragmark/db"
+)
+
+const typePredicate = "rdf:type"
+
+// maxMentionedTerms limits the number of entities found in a message.
+const maxMentionedTerms = 100
+
+// GetFacts returns the triples within opts.GraphHops of the entities that are mentioned in the
+// message. Entities are the subjects and objects of triples in the store.
+func (r *RAG) GetFacts(ctx context.Context, msg string, opts Options) (facts []db.Triple, err error) {
+	entities, err := r.findEntities(ctx, msg)
+	if err != nil {
+		return facts, err
+	}
+	r.Log.Info("found entities", slog.Any("entities", entities))
+	return r.neighbourhood(ctx, entities, opts.GraphHops, opts.MaxFacts)
+}
+
+// findEntities returns the terms of the triple store that are mentioned in the message.
+func (r *RAG) findEntities(ctx context.Context, msg string) (entities []string, err error) {
+	// Terms are matched as substrings, e.g. "an" matches "Apache", so the terms aren't limited
+	// until they've been checked for word boundaries.
+	terms, err := r.queries.TripleSelectMentioned(ctx, db.TripleSelectMentionedArgs{
+		Text: msg,
+	})
+	if err != nil {
+		return entities, fmt.Errorf("failed to find entities: %w", err)
+	}
+	for _, term := range terms {
+		if len(entities) >= maxMentionedTerms {
+			break
+		}
+		if mentions(msg, term) {
+			entities = append(entities, term)
+		}
+	}
+	return entities, nil
+}
+
+// mentions returns true if the text contains the term as whole words, ignoring case. Prefixed
+// names match on their local name, and may be plural, so "vehicles" mentions ies:Vehicle.
+func mentions(text, term string) bool {
+	text, name := strings.ToLower(text), strings.ToLower(term)
+	prefixed := isPrefixedName(term)
+	if prefixed {
+		name = name[strings.Index(name, ":")+1:]
+	}
+	if name == "" {
+		return false
+	}
+	for offset := 0; offset < len(text); {
+		i := strings.Index(text[offset:], name)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(name)
+		if prefixed {
+			end += pluralSuffixLength(text[end:])
+		}
+		if isWordBoundary(text, start-1) && isWordBoundary(text, end) {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+// isPrefixedName returns true for terms such as ies:Vehicle, as opposed to literals such as "BAE Systems".
+func isPrefixedName(term string) bool {
+	prefix, local, ok := strings.Cut(term, ":")
+	return ok && prefix != "" && local != "" && !strings.ContainsAny(term, " /")
+}
+
+func pluralSuffixLength(s string) int {
+	if strings.HasPrefix(s, "es") && isWordBoundary(s, 2) {
+		return 2
+	}
+	if strings.HasPrefix(s, "s") && isWordBoundary(s, 1) {
+		return 1
+	}
+	return 0
+}
+
+// isWordBoundary returns true if the byte at index i isn't part of a word.
+func isWordBoundary(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return true
+	}
+	r := rune(s[i])
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// neighbourhood returns the triples that are within the given number of hops of the entities,
+// up to the limit. Triples closer to the entities are returned first.
+func (r *RAG) neighbourhood(ctx context.Context, entities []string, hops, limit int) (facts []db.Triple, err error) {
+	type key struct{ s, p, o string }
+	seenFacts := map[key]struct{}{}
+	visited := map[string]struct{}{}
+	frontier := entities
+	for hop := 0; hop < hops && len(frontier) > 0; hop++ {
+		var next []string
+		for _, term := range frontier {
+			if _, ok := visited[term]; ok {
+				continue
+			}
+			visited[term] = struct{}{}
+			bySubject, err := r.queries.TripleSelectSubject(ctx, term)
+			if err != nil {
+				return facts, fmt.Errorf("failed to select triples by subject: %w", err)
+			}
+			byObject, err := r.queries.TripleSelectObject(ctx, term)
+			if err != nil {
+				return facts, fmt.Errorf("failed to select triples by object: %w", err)
+			}
+			for _, t := range append(bySubject, byObject...) {
+				k := key{t.Subject, t.Predicate, t.Object}
+				if _, ok := seenFacts[k]; ok {
+					continue
+				}
+				if len(facts) >= limit {
+					return facts, nil
+				}
+				seenFacts[k] = struct{}{}
+				facts = append(facts, t)
+				next = append(next, t.Subject)
+				// Don't expand through classes, e.g. ies:Vehicle, since they're related to
+				// every entity of that type. Classes that are mentioned are still expanded.
+				if t.Predicate != typePredicate {
+					next = append(next, t.Object)
+				}
+			}
+		}
+		frontier = next
+	}
+	return facts, nil
+}
@@ -0,0 +1,145 @@
+package rag_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/google/go-cmp/cmp"
+)
+
+// tripleQuerier is an in-memory triple store.
+type tripleQuerier struct {
+	db.Querier
+	triples []db.Triple
+}
+
+func (q tripleQuerier) TripleSelectMentioned(ctx context.Context, args db.TripleSelectMentionedArgs) (terms []string, err error) {
+	seen := map[string]bool{}
+	for _, t := range q.triples {
+		for _, term := range []string{t.Subject, t.Object} {
+			_, local, ok := strings.Cut(term, ":")
+			if !ok {
+				local = term
+			}
+			if args.Limit > 0 && len(terms) >= args.Limit {
+				return terms, nil
+			}
+			if !seen[term] && strings.Contains(strings.ToLower(args.Text), strings.ToLower(local)) {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms, nil
+}
+
+func (q tripleQuerier) TripleSelectSubject(ctx context.Context, subject string) (triples []db.Triple, err error) {
+	for _, t := range q.triples {
+		if t.Subject == subject {
+			triples = append(triples, t)
+		}
+	}
+	return triples, nil
+}
+
+func (q tripleQuerier) TripleSelectObject(ctx context.Context, object string) (triples []db.Triple, err error) {
+	for _, t := range q.triples {
+		if t.Object == object {
+			triples = append(triples, t)
+		}
+	}
+	return triples, nil
+}
+
+func TestGetFacts(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	makesChallenger := db.Triple{Subject: "BAE Systems", Predicate: "ies:make", Object: "Challenger 2", Source: "/combat-vehicles/challenger"}
+	makesWarrior := db.Triple{Subject: "BAE Systems", Predicate: "ies:make", Object: "Warrior", Source: "/combat-vehicles/warrior"}
+	challengerIsVehicle := db.Triple{Subject: "Challenger 2", Predicate: "rdf:type", Object: "ies:Vehicle", Source: "/combat-vehicles/challenger"}
+	apacheIsVehicle := db.Triple{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Vehicle", Source: "/aircraft/apache"}
+	makesApache := db.Triple{Subject: "Boeing", Predicate: "ies:make", Object: "Apache", Source: "/aircraft/apache"}
+	operatesChallenger := db.Triple{Subject: "British Army", Predicate: "ies:operates", Object: "Challenger 2", Source: "/combat-vehicles/challenger"}
+	q := tripleQuerier{
+		triples: []db.Triple{makesChallenger, makesWarrior, challengerIsVehicle, apacheIsVehicle, makesApache, operatesChallenger},
+	}
+	r := rag.New(log, q, fake.New(), "model")
+
+	tests := []struct {
+		name     string
+		msg      string
+		opts     rag.Options
+		expected []db.Triple
+	}{
+		{
+			name:     "one hop returns the relationships of the entities in the message",
+			msg:      "What does BAE Systems make?",
+			opts:     rag.Options{GraphHops: 1, MaxFacts: 50},
+			expected: []db.Triple{makesChallenger, makesWarrior},
+		},
+		{
+			name:     "two hops returns the relationships of related entities",
+			msg:      "What does BAE Systems make?",
+			opts:     rag.Options{GraphHops: 2, MaxFacts: 50},
+			expected: []db.Triple{makesChallenger, makesWarrior, challengerIsVehicle, operatesChallenger},
+		},
+		{
+			name:     "classes match plural words",
+			msg:      "Which vehicles are made by BAE Systems?",
+			opts:     rag.Options{GraphHops: 1, MaxFacts: 50},
+			expected: []db.Triple{makesChallenger, makesWarrior, challengerIsVehicle, apacheIsVehicle},
+		},
+		{
+			name:     "classes aren't expanded unless they're mentioned",
+			msg:      "Who operates the Challenger 2?",
+			opts:     rag.Options{GraphHops: 2, MaxFacts: 50},
+			expected: []db.Triple{challengerIsVehicle, makesChallenger, operatesChallenger, makesWarrior},
+		},
+		{
+			name:     "entities must be whole words",
+			msg:      "Tell me about apaches and warriors.",
+			opts:     rag.Options{GraphHops: 2, MaxFacts: 50},
+			expected: nil,
+		},
+		{
+			name:     "the number of facts is limited",
+			msg:      "What does BAE Systems make?",
+			opts:     rag.Options{GraphHops: 2, MaxFacts: 3},
+			expected: []db.Triple{makesChallenger, makesWarrior, challengerIsVehicle},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			facts, err := r.GetFacts(ctx, tt.msg, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, facts); diff != "" {
+				t.Errorf("unexpected facts (-want +got):\n%s", diff)
+			}
+		})
+	}
+	t.Run("terms that are part of a word don't hide entities", func(t *testing.T) {
+		// Each term matches "make" as a substring, and is returned before the entity.
+		var partial []db.Triple
+		for i := range 200 {
+			partial = append(partial, db.Triple{Subject: fmt.Sprintf("ex%d:ake", i), Predicate: "rdf:type", Object: "ies:Vehicle"})
+		}
+		q := tripleQuerier{triples: append(partial, makesChallenger, makesWarrior)}
+		r := rag.New(log, q, fake.New(), "model")
+		facts, err := r.GetFacts(ctx, "What does BAE Systems make?", rag.Options{GraphHops: 1, MaxFacts: 50})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]db.Triple{makesChallenger, makesWarrior}, facts); diff != "" {
+			t.Errorf("unexpected facts (-want +got):\n%s", diff)
+		}
+	})
+}
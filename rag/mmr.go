@@ -0,0 +1,85 @@
+package rag
+
+import (
+	"cmp"
+	"math"
+)
+
+// selectCandidates returns up to opts.Limit candidates, with at most opts.MaxPerDocument from
+// each document. If opts.MMRLambda is set, candidates are selected using maximal marginal
+// relevance, otherwise in order.
+//
+// The relevance of each candidate is its similarity to the message's embedding, or the
+// reranker's score if the candidates were reranked.
+func selectCandidates(embedding []float32, candidates []Candidate, reranked bool, opts Options) (selected []Candidate) {
+	limit := cmp.Or(opts.Limit, DefaultOptions().Limit)
+	perDocument := map[string]int{}
+	available := func(c Candidate) bool {
+		return opts.MaxPerDocument <= 0 || perDocument[c.Path] < opts.MaxPerDocument
+	}
+	if opts.MMRLambda <= 0 {
+		for _, c := range candidates {
+			if len(selected) == limit {
+				break
+			}
+			if available(c) {
+				selected = append(selected, c)
+				perDocument[c.Path]++
+			}
+		}
+		return selected
+	}
+
+	relevance := make([]float64, len(candidates))
+	for i, c := range candidates {
+		relevance[i] = c.Relevance
+		if !reranked {
+			relevance[i] = cosineSimilarity(embedding, c.Embedding)
+		}
+	}
+	// redundancy is the highest similarity of each candidate to the selected candidates.
+	redundancy := make([]float64, len(candidates))
+	used := make([]bool, len(candidates))
+	for len(selected) < limit {
+		best, bestScore := -1, math.Inf(-1)
+		for i, c := range candidates {
+			if used[i] || !available(c) {
+				continue
+			}
+			score := opts.MMRLambda*relevance[i] - (1-opts.MMRLambda)*redundancy[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		used[best] = true
+		selected = append(selected, candidates[best])
+		perDocument[candidates[best].Path]++
+		for i, c := range candidates {
+			if !used[i] {
+				redundancy[i] = max(redundancy[i], cosineSimilarity(candidates[best].Embedding, c.Embedding))
+			}
+		}
+	}
+	return selected
+}
+
+// cosineSimilarity returns the cosine of the angle between the vectors, or zero if either is
+// missing or they have different dimensions.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
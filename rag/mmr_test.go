@@ -0,0 +1,80 @@
+package rag_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGetContextDiversification(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	model := fake.New()
+	texts := []db.Chunk{
+		{Path: "/warrior", Index: 0, Text: "Warrior specification: weight 25 tonnes, speed 75 km/h, crew 3."},
+		{Path: "/warrior", Index: 1, Text: "Warrior specification: weight 25 tonnes, speed 75 km/h, crew 3, armament 30mm."},
+		{Path: "/scimitar", Index: 0, Text: "Scimitar specification: weight 8 tonnes, speed 80 km/h, crew 3."},
+		{Path: "/warrior-history", Index: 0, Text: "The Warrior entered service in 1988, and served in the Gulf War."},
+	}
+	var q querier
+	for _, c := range texts {
+		embeddings, err := model.Embed(ctx, llm.EmbedRequest{Input: []string{c.Text}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c.Embedding = embeddings[0]
+		q.nearest = append(q.nearest, db.ChunkSelectNearestResult{Chunk: c})
+		q.chunks = append(q.chunks, c)
+	}
+	r := rag.New(log, q, model, "model")
+	r.ContextWindow = 0
+
+	tests := []struct {
+		name     string
+		opts     rag.Options
+		expected []db.Chunk
+	}{
+		{
+			name:     "without diversification the nearest chunks are used",
+			opts:     rag.Options{Mode: rag.ModeVector, Limit: 2},
+			expected: []db.Chunk{chunk("/warrior", 0), chunk("/warrior", 1)},
+		},
+		{
+			name:     "the number of chunks from each document can be limited",
+			opts:     rag.Options{Mode: rag.ModeVector, Limit: 2, Candidates: 4, MaxPerDocument: 1},
+			expected: []db.Chunk{chunk("/warrior", 0), chunk("/scimitar", 0)},
+		},
+		{
+			name:     "near-duplicate chunks are skipped by MMR",
+			opts:     rag.Options{Mode: rag.ModeVector, Limit: 2, Candidates: 4, MMRLambda: 0.5},
+			expected: []db.Chunk{chunk("/warrior", 0), chunk("/warrior-history", 0)},
+		},
+		{
+			name:     "MMR with a lambda of 1 uses relevance only",
+			opts:     rag.Options{Mode: rag.ModeVector, Limit: 2, Candidates: 4, MMRLambda: 1},
+			expected: []db.Chunk{chunk("/warrior", 0), chunk("/warrior", 1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := r.GetContext(ctx, "Warrior specification weight speed crew", tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var actual []db.Chunk
+			for _, c := range c.Chunks {
+				actual = append(actual, chunk(c.Path, c.Index))
+			}
+			if diff := cmp.Diff(tt.expected, actual); diff != "" {
+				t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
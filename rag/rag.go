@@ -1,21 +1,26 @@
 package rag
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/a-h/ragmark/db"
-	ollamaapi "github.com/ollama/ollama/api"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/prompts"
 )
 
-func New(log *slog.Logger, queries *db.Queries, oc *ollamaapi.Client, model string) *RAG {
+func New(log *slog.Logger, queries db.Querier, embedder llm.Embedder, model string) *RAG {
 	return &RAG{
 		Log:           log,
 		Model:         model,
 		ContextWindow: 10,
+		Reranker:      NoopReranker{},
 		queries:       queries,
-		oc:            oc,
+		embedder:      embedder,
 	}
 }
 
@@ -23,41 +28,300 @@ type RAG struct {
 	Log *slog.Logger
 	// Model to use for embeddings.
 	Model string
-	// Number of surrounding chunks to return.
+	// Maximum number of surrounding chunks to add either side of each search result, if they
+	// fit in the options' ContextTokens.
 	ContextWindow int
-	queries       *db.Queries
-	oc            *ollamaapi.Client
+	// Reranker reorders the candidates found by search before the best are expanded with
+	// their surrounding chunks. If nil, the search order is used.
+	Reranker Reranker
+	queries  db.Querier
+	embedder llm.Embedder
 }
 
-func (r *RAG) GetContext(ctx context.Context, msg string) (chunks []db.Chunk, err error) {
-	nearest, err := r.getNearestChunks(ctx, msg)
+// Mode is the method used to find chunks that are relevant to a message.
+type Mode string
+
+const (
+	// ModeVector finds the chunks with the nearest embeddings.
+	ModeVector Mode = "vector"
+	// ModeFTS finds the chunks that contain the message's terms.
+	ModeFTS Mode = "fts"
+	// ModeHybrid combines the vector and full-text search results using reciprocal rank fusion.
+	ModeHybrid Mode = "hybrid"
+	// ModeGraph finds chunks in the same way as ModeHybrid, and adds facts from the triple
+	// store about the entities mentioned in the message.
+	ModeGraph Mode = "graph"
+)
+
+var Modes = []Mode{ModeVector, ModeFTS, ModeHybrid, ModeGraph}
+
+// ParseMode returns the Mode with the given name.
+func ParseMode(s string) (m Mode, err error) {
+	for _, m := range Modes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return m, fmt.Errorf("unknown retrieval mode %q, expected vector, fts, hybrid or graph", s)
+}
+
+// Options control how context is retrieved.
+type Options struct {
+	Mode Mode
+	// Limit is the number of chunks to keep after reranking, before surrounding context is added.
+	Limit int
+	// Candidates is the number of chunks to find for the reranker to choose from. If it's
+	// less than Limit, Limit chunks are found.
+	Candidates int
+	// VectorWeight and FTSWeight scale each search's contribution to the hybrid ranking.
+	VectorWeight float64
+	FTSWeight    float64
+	// GraphHops is the number of relationships to follow from the entities in the message,
+	// in graph mode. MaxFacts limits the number of facts that are returned.
+	GraphHops int
+	MaxFacts  int
+	// MMRLambda enables maximal marginal relevance selection of the candidates, to avoid
+	// near-duplicate chunks. It's the weight of relevance to the message against
+	// dissimilarity to the chunks already selected, from 0 to 1. If zero, the best candidates
+	// are used.
+	MMRLambda float64
+	// MaxPerDocument is the maximum number of candidates to select from each document, or
+	// zero for no limit.
+	MaxPerDocument int
+	// ContextTokens is the maximum number of tokens of chunks and facts to add to the prompt,
+	// or zero for no limit. It should leave room in the chat model's context length for the
+	// history, the message and the answer.
+	ContextTokens int
+	// Filter restricts search to the chunks of matching documents. RDF types include their
+	// subclasses in the type hierarchy.
+	Filter db.ChunkFilter
+}
+
+// DefaultOptions returns vector search options, matching the original behaviour.
+func DefaultOptions() Options {
+	return Options{
+		Mode:         ModeVector,
+		Limit:        10,
+		Candidates:   10,
+		VectorWeight: 1,
+		FTSWeight:    1,
+		GraphHops:    2,
+		MaxFacts:     50,
+	}
+}
+
+// Context is the information retrieved for a message.
+type Context struct {
+	// Chunks of documents, in order of relevance.
+	Chunks []db.Chunk
+	// Facts from the triple store, in graph mode.
+	Facts []db.Triple
+	// Sources are the sections of documents that the chunks are from, numbered in the
+	// same way as the prompt, see prompts.SourceNumbers.
+	Sources []Source
+}
+
+// Source is a section of a document that context was retrieved from.
+type Source struct {
+	// Number is used to cite the source, starting from 1.
+	Number int
+	Path   string
+	// Heading is the breadcrumb of the section, e.g. "Install > Linux", or empty if the
+	// context is before the first heading.
+	Heading string
+	// Distance and Score are from the best search result in the section, or from the search
+	// result that the section was added to the context for.
+	Distance float64
+	Score    float64
+}
+
+// Candidate is a chunk that was found by one or more searches.
+type Candidate struct {
+	db.Chunk
+	// Distance is the vector distance, or zero if the chunk wasn't found by vector search.
+	Distance float64
+	// Score is the fused rank of the chunk, higher is better.
+	Score float64
+	// Relevance is the reranker's score, higher is better, or zero if the chunk wasn't reranked.
+	Relevance float64
+}
+
+func (r *RAG) GetContext(ctx context.Context, msg string, opts Options) (c Context, err error) {
+	var embedding []float32
+	if usesVectorSearch(opts.Mode) || opts.MMRLambda > 0 {
+		if embedding, err = r.embed(ctx, msg); err != nil {
+			return c, err
+		}
+	}
+	candidates, err := r.search(ctx, msg, embedding, opts)
 	if err != nil {
-		return chunks, fmt.Errorf("failed to get message embeddings: %w", err)
+		return c, err
 	}
 
-	r.Log.Info("found nearest chunks", slog.Int("count", len(nearest)))
-	for _, result := range nearest {
-		r.Log.Info("result", slog.String("doc", result.Path), slog.Float64("distance", result.Distance), slog.Int("index", result.Index))
+	r.Log.Info("found candidate chunks", slog.String("mode", string(opts.Mode)), slog.Int("count", len(candidates)))
+	for _, c := range candidates {
+		r.Log.Info("result", slog.String("doc", c.Path), slog.Int("index", c.Index), slog.Float64("distance", c.Distance), slog.Float64("score", c.Score))
 	}
 
+	candidates, reranked := r.rerank(ctx, msg, candidates)
+	candidates = selectCandidates(embedding, candidates, reranked, opts)
+
 	r.Log.Info("getting surrounding context for chunks")
-	return r.getChunkContext(ctx, nearest)
+	var origins []Candidate
+	if c.Chunks, origins, err = r.assembleContext(ctx, candidates, opts.ContextTokens); err != nil {
+		return c, err
+	}
+	c.Sources = sources(c.Chunks, origins)
+
+	if opts.Mode == ModeGraph {
+		r.Log.Info("getting facts")
+		if c.Facts, err = r.GetFacts(ctx, msg, opts); err != nil {
+			return c, err
+		}
+		if opts.ContextTokens > 0 {
+			c.Facts = limitFacts(c.Facts, opts.ContextTokens-chunkTokens(c.Chunks))
+		}
+		r.Log.Info("found facts", slog.Int("count", len(c.Facts)))
+	}
+	return c, nil
 }
 
-func (r *RAG) getNearestChunks(ctx context.Context, input string) (chunks []db.ChunkSelectNearestResult, err error) {
+// rerank returns the candidates in the reranker's order, and whether their Relevance was set.
+// If reranking fails, the search order is used.
+func (r *RAG) rerank(ctx context.Context, msg string, candidates []Candidate) (result []Candidate, reranked bool) {
+	if _, noop := r.Reranker.(NoopReranker); r.Reranker == nil || noop || len(candidates) == 0 {
+		return candidates, false
+	}
+	result, err := r.Reranker.Rerank(ctx, msg, candidates)
+	if err != nil {
+		r.Log.Warn("failed to rerank candidates, using the search order", slog.Any("error", err))
+		return candidates, false
+	}
+	for _, c := range result {
+		r.Log.Info("reranked", slog.String("doc", c.Path), slog.Int("index", c.Index), slog.Float64("relevance", c.Relevance))
+	}
+	return result, true
+}
+
+// Search returns the chunks that best match the message, best first. The number of chunks is
+// the larger of the options' Limit and Candidates, so that there are candidates to rerank.
+func (r *RAG) Search(ctx context.Context, msg string, opts Options) (candidates []Candidate, err error) {
+	var embedding []float32
+	if usesVectorSearch(opts.Mode) {
+		if embedding, err = r.embed(ctx, msg); err != nil {
+			return candidates, err
+		}
+	}
+	return r.search(ctx, msg, embedding, opts)
+}
+
+func usesVectorSearch(m Mode) bool {
+	return m == ModeVector || m == ModeHybrid || m == ModeGraph
+}
+
+// search finds candidates using the embedding of the message, which is only required by
+// the modes that use vector search.
+func (r *RAG) search(ctx context.Context, msg string, embedding []float32, opts Options) (candidates []Candidate, err error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultOptions().Limit
+	}
+	opts.Limit = max(opts.Limit, opts.Candidates)
+	filter, err := expandTypes(opts.Filter)
+	if err != nil {
+		return candidates, err
+	}
+	var nearest []db.ChunkSelectNearestResult
+	if usesVectorSearch(opts.Mode) {
+		nearest, err = r.getNearestChunks(ctx, embedding, opts.Limit, filter)
+		if err != nil {
+			return candidates, err
+		}
+	}
+	var matches []db.ChunkFTSSearchResult
+	if opts.Mode == ModeFTS || opts.Mode == ModeHybrid || opts.Mode == ModeGraph {
+		matches, err = r.queries.ChunkFTSSearch(ctx, db.ChunkFTSSearchArgs{
+			Query:  msg,
+			Limit:  opts.Limit,
+			Filter: filter,
+		})
+		if err != nil {
+			return candidates, fmt.Errorf("failed to search chunks: %w", err)
+		}
+	}
+	switch opts.Mode {
+	case ModeVector:
+		return fuse(nearest, nil, 1, 0, opts.Limit), nil
+	case ModeFTS:
+		return fuse(nil, matches, 0, 1, opts.Limit), nil
+	case ModeHybrid, ModeGraph:
+		return fuse(nearest, matches, opts.VectorWeight, opts.FTSWeight, opts.Limit), nil
+	}
+	return candidates, fmt.Errorf("unknown retrieval mode %q", opts.Mode)
+}
+
+// rrfK dampens the contribution of the top ranks, 60 is the value used in the
+// original reciprocal rank fusion paper.
+const rrfK = 60
+
+// fuse combines the search results using weighted reciprocal rank fusion, where each
+// chunk scores weight / (rrfK + rank) for each list it appears in.
+func fuse(nearest []db.ChunkSelectNearestResult, matches []db.ChunkFTSSearchResult, vectorWeight, ftsWeight float64, limit int) (candidates []Candidate) {
+	byKey := map[string]*Candidate{}
+	get := func(chunk db.Chunk) *Candidate {
+		key := fmt.Sprintf("%s_%d", chunk.Path, chunk.Index)
+		c, ok := byKey[key]
+		if !ok {
+			c = &Candidate{Chunk: chunk}
+			byKey[key] = c
+		}
+		return c
+	}
+	for i, n := range nearest {
+		c := get(n.Chunk)
+		c.Distance = n.Distance
+		c.Score += vectorWeight / float64(rrfK+i+1)
+	}
+	for i, m := range matches {
+		c := get(m.Chunk)
+		c.Score += ftsWeight / float64(rrfK+i+1)
+	}
+	for _, c := range byKey {
+		candidates = append(candidates, *c)
+	}
+	slices.SortStableFunc(candidates, func(a, b Candidate) int {
+		if a.Score != b.Score {
+			return cmp.Compare(b.Score, a.Score)
+		}
+		if a.Path != b.Path {
+			return strings.Compare(a.Path, b.Path)
+		}
+		return cmp.Compare(a.Index, b.Index)
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+func (r *RAG) embed(ctx context.Context, input string) (embedding []float32, err error) {
 	if len(input) == 0 {
-		return chunks, fmt.Errorf("input is empty")
+		return embedding, fmt.Errorf("input is empty")
 	}
-	embeddings, err := r.oc.Embed(ctx, &ollamaapi.EmbedRequest{
+	embeddings, err := r.embedder.Embed(ctx, llm.EmbedRequest{
 		Model: r.Model,
-		Input: input,
+		Input: []string{input},
 	})
 	if err != nil {
-		return chunks, fmt.Errorf("failed to get message embeddings: %w", err)
+		return embedding, fmt.Errorf("failed to get message embeddings: %w", err)
 	}
+	return embeddings[0], nil
+}
+
+func (r *RAG) getNearestChunks(ctx context.Context, embedding []float32, limit int, filter db.ChunkFilter) (chunks []db.ChunkSelectNearestResult, err error) {
 	chunks, err = r.queries.ChunkSelectNearest(ctx, db.ChunkSelectNearestArgs{
-		Embedding: embeddings.Embeddings[0],
-		Limit:     10,
+		Embedding: embedding,
+		Limit:     limit,
+		Filter:    filter,
 	})
 	if err != nil {
 		return chunks, fmt.Errorf("failed to get nearest documents: %w", err)
@@ -65,25 +329,43 @@ func (r *RAG) getNearestChunks(ctx context.Context, input string) (chunks []db.C
 	return chunks, nil
 }
 
-func (r *RAG) getChunkContext(ctx context.Context, chunks []db.ChunkSelectNearestResult) (result []db.Chunk, err error) {
-	previousChunks := map[string]struct{}{}
-	for _, chunk := range chunks {
-		chunkRange, err := r.queries.ChunkSelectRange(ctx, db.ChunkSelectRangeArgs{
-			Path:       chunk.Path,
-			StartIndex: chunk.Index - r.ContextWindow,
-			EndIndex:   chunk.Index + r.ContextWindow,
-		})
-		if err != nil {
-			return result, fmt.Errorf("failed to select chunk range: %w", err)
+func chunkTokens(chunks []db.Chunk) (n int) {
+	for _, c := range chunks {
+		n += prompts.ChunkTokens(c)
+	}
+	return n
+}
+
+// limitFacts returns the facts that fit in maxTokens, in order.
+func limitFacts(facts []db.Triple, maxTokens int) []db.Triple {
+	var used int
+	for i, f := range facts {
+		if used += prompts.FactTokens(f); used > maxTokens {
+			return facts[:i]
+		}
+	}
+	return facts
+}
+
+// sources groups the chunks by their source number. Each source takes the distance and score
+// of the best candidate that its chunks were added for.
+func sources(chunks []db.Chunk, origins []Candidate) (sources []Source) {
+	for i, n := range prompts.SourceNumbers(chunks) {
+		origin := origins[i]
+		if n > len(sources) {
+			sources = append(sources, Source{
+				Number:   n,
+				Path:     chunks[i].Path,
+				Heading:  chunks[i].Heading,
+				Distance: origin.Distance,
+				Score:    origin.Score,
+			})
+			continue
 		}
-		for _, chunkInRange := range chunkRange {
-			cacheKey := fmt.Sprintf("%s_%d", chunkInRange.Path, chunkInRange.Index)
-			if _, previouslyAdded := previousChunks[cacheKey]; previouslyAdded {
-				continue
-			}
-			result = append(result, chunkInRange)
-			previousChunks[cacheKey] = struct{}{}
+		if s := &sources[n-1]; origin.Score > s.Score {
+			s.Distance = origin.Distance
+			s.Score = origin.Score
 		}
 	}
-	return result, nil
+	return sources
 }
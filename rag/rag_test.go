@@ -0,0 +1,162 @@
+package rag_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/google/go-cmp/cmp"
+)
+
+type querier struct {
+	db.Querier
+	nearest []db.ChunkSelectNearestResult
+	matches []db.ChunkFTSSearchResult
+	chunks  []db.Chunk
+	// filters records the filter of each search, if set.
+	filters *[]db.ChunkFilter
+}
+
+func (q querier) ChunkSelectRange(ctx context.Context, args db.ChunkSelectRangeArgs) (chunks []db.Chunk, err error) {
+	for _, c := range q.chunks {
+		if c.Path == args.Path && c.Index >= args.StartIndex && c.Index <= args.EndIndex {
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks, nil
+}
+
+func (q querier) ChunkSelectNearest(ctx context.Context, args db.ChunkSelectNearestArgs) ([]db.ChunkSelectNearestResult, error) {
+	if q.filters != nil {
+		*q.filters = append(*q.filters, args.Filter)
+	}
+	return q.nearest, nil
+}
+
+func (q querier) ChunkFTSSearch(ctx context.Context, args db.ChunkFTSSearchArgs) ([]db.ChunkFTSSearchResult, error) {
+	if q.filters != nil {
+		*q.filters = append(*q.filters, args.Filter)
+	}
+	return q.matches, nil
+}
+
+func chunk(path string, index int) db.Chunk {
+	return db.Chunk{Path: path, Index: index}
+}
+
+func keys(candidates []rag.Candidate) (keys []db.Chunk) {
+	for _, c := range candidates {
+		keys = append(keys, chunk(c.Path, c.Index))
+	}
+	return keys
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	q := querier{
+		nearest: []db.ChunkSelectNearestResult{
+			{Chunk: chunk("/a", 0), Distance: 0.1},
+			{Chunk: chunk("/b", 0), Distance: 0.2},
+			{Chunk: chunk("/c", 0), Distance: 0.3},
+		},
+		matches: []db.ChunkFTSSearchResult{
+			{Chunk: chunk("/c", 0), Rank: -5},
+			{Chunk: chunk("/d", 0), Rank: -4},
+		},
+	}
+	r := rag.New(log, q, fake.New(), "model")
+
+	tests := []struct {
+		name     string
+		opts     rag.Options
+		expected []db.Chunk
+	}{
+		{
+			name:     "vector mode uses the nearest chunks",
+			opts:     rag.Options{Mode: rag.ModeVector},
+			expected: []db.Chunk{chunk("/a", 0), chunk("/b", 0), chunk("/c", 0)},
+		},
+		{
+			name:     "fts mode uses the full-text matches",
+			opts:     rag.Options{Mode: rag.ModeFTS},
+			expected: []db.Chunk{chunk("/c", 0), chunk("/d", 0)},
+		},
+		{
+			name:     "hybrid mode ranks chunks found by both searches first",
+			opts:     rag.Options{Mode: rag.ModeHybrid, VectorWeight: 1, FTSWeight: 1},
+			expected: []db.Chunk{chunk("/c", 0), chunk("/a", 0), chunk("/b", 0), chunk("/d", 0)},
+		},
+		{
+			name:     "hybrid mode weights can favour full-text matches",
+			opts:     rag.Options{Mode: rag.ModeHybrid, VectorWeight: 1, FTSWeight: 3},
+			expected: []db.Chunk{chunk("/c", 0), chunk("/d", 0), chunk("/a", 0), chunk("/b", 0)},
+		},
+		{
+			name:     "the number of results is limited",
+			opts:     rag.Options{Mode: rag.ModeHybrid, VectorWeight: 1, FTSWeight: 1, Limit: 2},
+			expected: []db.Chunk{chunk("/c", 0), chunk("/a", 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates, err := r.Search(ctx, "message", tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.expected, keys(candidates)); diff != "" {
+				t.Errorf("unexpected candidates (-want +got):\n%s", diff)
+			}
+		})
+	}
+	t.Run("vector distances are kept in hybrid mode", func(t *testing.T) {
+		candidates, err := r.Search(ctx, "message", rag.Options{Mode: rag.ModeHybrid, VectorWeight: 1, FTSWeight: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if candidates[0].Distance != 0.3 {
+			t.Errorf("expected distance 0.3, got %v", candidates[0].Distance)
+		}
+	})
+	t.Run("unknown modes are an error", func(t *testing.T) {
+		if _, err := r.Search(ctx, "message", rag.Options{Mode: "psychic"}); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestGetContextSources(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	q := querier{
+		nearest: []db.ChunkSelectNearestResult{
+			{Chunk: db.Chunk{Path: "/apache", Index: 2, Heading: "Armament"}, Distance: 0.1},
+			{Chunk: db.Chunk{Path: "/wildcat", Index: 0}, Distance: 0.4},
+		},
+		chunks: []db.Chunk{
+			{Path: "/apache", Index: 1, Heading: "Sensors"},
+			{Path: "/apache", Index: 2, Heading: "Armament"},
+			{Path: "/apache", Index: 3, Heading: "Armament"},
+			{Path: "/wildcat", Index: 0},
+			{Path: "/wildcat", Index: 1},
+		},
+	}
+	r := rag.New(log, q, fake.New(), "model")
+
+	c, err := r.GetContext(ctx, "message", rag.Options{Mode: rag.ModeVector})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []rag.Source{
+		{Number: 1, Path: "/apache", Heading: "Sensors", Distance: 0.1, Score: 1.0 / 61},
+		{Number: 2, Path: "/apache", Heading: "Armament", Distance: 0.1, Score: 1.0 / 61},
+		{Number: 3, Path: "/wildcat", Distance: 0.4, Score: 1.0 / 62},
+	}
+	if diff := cmp.Diff(expected, c.Sources); diff != "" {
+		t.Errorf("unexpected sources (-want +got):\n%s", diff)
+	}
+}
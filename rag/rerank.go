@@ -0,0 +1,179 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/prompts"
+)
+
+// Reranker reorders the candidates found by search, most relevant first. Rerankers set the
+// Relevance of each candidate.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, candidates []Candidate) ([]Candidate, error)
+}
+
+// Rerankers are the names of the available rerankers, see NewReranker.
+var Rerankers = []string{"none", "lexical", "model"}
+
+// NewReranker returns the reranker with the given name. The chat model is only used by the
+// model reranker.
+func NewReranker(log *slog.Logger, name string, chat llm.ChatCompleter, model string) (Reranker, error) {
+	switch name {
+	case "none":
+		return NoopReranker{}, nil
+	case "lexical":
+		return LexicalReranker{}, nil
+	case "model":
+		return NewModelReranker(log, chat, model), nil
+	}
+	return nil, fmt.Errorf("unknown reranker %q, expected none, lexical or model", name)
+}
+
+// NoopReranker keeps the order of the search results.
+type NoopReranker struct{}
+
+func (NoopReranker) Rerank(ctx context.Context, query string, candidates []Candidate) ([]Candidate, error) {
+	return candidates, nil
+}
+
+// LexicalReranker orders candidates by the proportion of the query's terms that appear in
+// their heading or text. It's cheap, but doesn't understand synonyms.
+type LexicalReranker struct{}
+
+func (LexicalReranker) Rerank(ctx context.Context, query string, candidates []Candidate) ([]Candidate, error) {
+	queryTerms := terms(query)
+	if len(queryTerms) == 0 {
+		return candidates, nil
+	}
+	reranked := slices.Clone(candidates)
+	for i, c := range reranked {
+		chunkTerms := terms(c.Heading + " " + c.Text)
+		var matched int
+		for t := range queryTerms {
+			if _, ok := chunkTerms[t]; ok {
+				matched++
+			}
+		}
+		reranked[i].Relevance = float64(matched) / float64(len(queryTerms))
+	}
+	sortByRelevance(reranked)
+	return reranked, nil
+}
+
+// stopWords are ignored by the lexical reranker, because most chunks contain them.
+var stopWords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "are": {}, "as": {}, "at": {}, "be": {}, "by": {}, "do": {},
+	"does": {}, "for": {}, "from": {}, "how": {}, "i": {}, "in": {}, "is": {}, "it": {},
+	"its": {}, "of": {}, "on": {}, "or": {}, "that": {}, "the": {}, "this": {}, "to": {},
+	"was": {}, "what": {}, "when": {}, "where": {}, "which": {}, "who": {}, "why": {},
+	"with": {},
+}
+
+// terms returns the lowercase words and numbers in s, without stop words.
+func terms(s string) map[string]struct{} {
+	result := map[string]struct{}{}
+	for _, t := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if _, ok := stopWords[t]; ok {
+			continue
+		}
+		result[t] = struct{}{}
+	}
+	return result
+}
+
+func NewModelReranker(log *slog.Logger, chat llm.ChatCompleter, model string) *ModelReranker {
+	return &ModelReranker{
+		Log:         log,
+		Model:       model,
+		Concurrency: 4,
+		chat:        chat,
+	}
+}
+
+// ModelReranker asks a chat model to score the relevance of each candidate to the query, in
+// the style of a cross-encoder. It's more accurate than the lexical reranker, but makes a
+// request for each candidate.
+type ModelReranker struct {
+	Log *slog.Logger
+	// Model to use for scoring.
+	Model string
+	// Concurrency is the number of candidates to score at the same time.
+	Concurrency int
+	chat        llm.ChatCompleter
+}
+
+func (mr *ModelReranker) Rerank(ctx context.Context, query string, candidates []Candidate) ([]Candidate, error) {
+	reranked := slices.Clone(candidates)
+	errs := make([]error, len(reranked))
+	sem := make(chan struct{}, max(mr.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range reranked {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			reranked[i].Relevance, errs[i] = mr.score(ctx, query, reranked[i])
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return candidates, fmt.Errorf("failed to score candidates: %w", err)
+	}
+	sortByRelevance(reranked)
+	return reranked, nil
+}
+
+// score returns the relevance of the candidate from 0 to 1. Responses without a score are
+// treated as irrelevant.
+func (mr *ModelReranker) score(ctx context.Context, query string, c Candidate) (relevance float64, err error) {
+	response, err := mr.chat.Chat(ctx, llm.ChatRequest{
+		Model: mr.Model,
+		Messages: []llm.Message{
+			{
+				Role:    llm.RoleUser,
+				Content: prompts.Relevance(query, c.Chunk),
+			},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	relevance, ok := parseRelevance(response)
+	if !ok {
+		mr.Log.Warn("failed to parse relevance", slog.String("doc", c.Path), slog.Int("index", c.Index), slog.String("response", response))
+	}
+	return relevance, nil
+}
+
+var numberPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// parseRelevance returns the first number in the response, scaled from 0-10 to 0-1.
+func parseRelevance(response string) (relevance float64, ok bool) {
+	n, err := strconv.ParseFloat(numberPattern.FindString(response), 64)
+	if err != nil {
+		return 0, false
+	}
+	return min(n, 10) / 10, true
+}
+
+// sortByRelevance sorts the candidates by relevance, keeping the search order of candidates
+// with the same relevance.
+func sortByRelevance(candidates []Candidate) {
+	slices.SortStableFunc(candidates, func(a, b Candidate) int {
+		return cmp.Compare(b.Relevance, a.Relevance)
+	})
+}
@@ -0,0 +1,139 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+	"github.com/google/go-cmp/cmp"
+)
+
+func candidate(path, text string) rag.Candidate {
+	return rag.Candidate{Chunk: db.Chunk{Path: path, Text: text}}
+}
+
+func TestLexicalReranker(t *testing.T) {
+	candidates := []rag.Candidate{
+		candidate("/a", "The Apache is an attack helicopter."),
+		candidate("/b", "The Warrior is made by BAE Systems."),
+		candidate("/c", "BAE Systems makes the Challenger 2 and the Warrior."),
+	}
+	reranked, err := rag.LexicalReranker{}.Rerank(context.Background(), "Who makes the Warrior?", candidates)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]db.Chunk{chunk("/c", 0), chunk("/b", 0), chunk("/a", 0)}, keys(reranked)); diff != "" {
+		t.Errorf("unexpected order (-want +got):\n%s", diff)
+	}
+	if reranked[0].Relevance != 1 || reranked[2].Relevance != 0 {
+		t.Errorf("expected relevance from 1 to 0, got %v and %v", reranked[0].Relevance, reranked[2].Relevance)
+	}
+}
+
+func TestModelReranker(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	candidates := []rag.Candidate{
+		candidate("/a", "The Apache is an attack helicopter."),
+		candidate("/b", "The Warrior is made by BAE Systems."),
+		candidate("/c", "The Warrior is a tracked armoured vehicle."),
+	}
+	t.Run("candidates are ordered by the model's score", func(t *testing.T) {
+		model := fake.New()
+		model.Respond = func(req llm.ChatRequest) (string, error) {
+			prompt := req.Messages[0].Content
+			switch {
+			case strings.Contains(prompt, "BAE Systems"):
+				return "9", nil
+			case strings.Contains(prompt, "tracked"):
+				return "Relevance: 4.5/10", nil
+			}
+			return "Not relevant.", nil
+		}
+		reranked, err := rag.NewModelReranker(log, model, "model").Rerank(ctx, "Who makes the Warrior?", candidates)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if diff := cmp.Diff([]db.Chunk{chunk("/b", 0), chunk("/c", 0), chunk("/a", 0)}, keys(reranked)); diff != "" {
+			t.Errorf("unexpected order (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]float64{0.9, 0.45, 0}, []float64{reranked[0].Relevance, reranked[1].Relevance, reranked[2].Relevance}); diff != "" {
+			t.Errorf("unexpected relevance (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("model errors are returned", func(t *testing.T) {
+		model := fake.New()
+		model.Respond = func(req llm.ChatRequest) (string, error) {
+			return "", errors.New("model unavailable")
+		}
+		if _, err := rag.NewModelReranker(log, model, "model").Rerank(ctx, "Who makes the Warrior?", candidates); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestNewReranker(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	for _, name := range rag.Rerankers {
+		if _, err := rag.NewReranker(log, name, fake.New(), "model"); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+	if _, err := rag.NewReranker(log, "psychic", fake.New(), "model"); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+type failingReranker struct{}
+
+func (failingReranker) Rerank(ctx context.Context, query string, candidates []rag.Candidate) ([]rag.Candidate, error) {
+	return nil, errors.New("reranker unavailable")
+}
+
+func TestGetContextReranking(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	q := querier{
+		nearest: []db.ChunkSelectNearestResult{
+			{Chunk: db.Chunk{Path: "/apache", Text: "The Apache is an attack helicopter."}, Distance: 0.1},
+			{Chunk: db.Chunk{Path: "/wildcat", Text: "The Wildcat is a helicopter."}, Distance: 0.2},
+			{Chunk: db.Chunk{Path: "/warrior", Text: "The Warrior is made by BAE Systems."}, Distance: 0.3},
+		},
+		chunks: []db.Chunk{
+			{Path: "/apache", Text: "The Apache is an attack helicopter."},
+			{Path: "/wildcat", Text: "The Wildcat is a helicopter."},
+			{Path: "/warrior", Text: "The Warrior is made by BAE Systems."},
+		},
+	}
+	opts := rag.Options{Mode: rag.ModeVector, Limit: 1, Candidates: 3}
+
+	t.Run("the best reranked candidates are kept", func(t *testing.T) {
+		r := rag.New(log, q, fake.New(), "model")
+		r.Reranker = rag.LexicalReranker{}
+		c, err := r.GetContext(ctx, "Who makes the Warrior?", opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(c.Chunks) != 1 || c.Chunks[0].Path != "/warrior" {
+			t.Errorf("expected the Warrior chunk, got %v", c.Chunks)
+		}
+	})
+	t.Run("the search order is used if reranking fails", func(t *testing.T) {
+		r := rag.New(log, q, fake.New(), "model")
+		r.Reranker = failingReranker{}
+		c, err := r.GetContext(ctx, "Who makes the Warrior?", opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(c.Chunks) != 1 || c.Chunks[0].Path != "/apache" {
+			t.Errorf("expected the Apache chunk, got %v", c.Chunks)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/prompts"
+)
+
+func NewQueryRewriter(log *slog.Logger, chat llm.ChatCompleter, model string) *QueryRewriter {
+	return &QueryRewriter{
+		Log:   log,
+		Model: model,
+		chat:  chat,
+	}
+}
+
+// QueryRewriter uses a chat model to rewrite follow-up messages as standalone search queries,
+// e.g. "what's its top speed?" becomes "What is the top speed of the Warrior?". The query is
+// only used to find context, the original message is answered.
+type QueryRewriter struct {
+	Log *slog.Logger
+	// Model to use for rewriting.
+	Model string
+	chat  llm.ChatCompleter
+}
+
+// Rewrite returns the search query for the latest message in the conversation. If there's
+// no history, or the model doesn't return a query, the message is returned.
+func (qr *QueryRewriter) Rewrite(ctx context.Context, history []llm.Message, msg string) (query string, err error) {
+	if len(history) == 0 {
+		return msg, nil
+	}
+	response, err := qr.chat.Chat(ctx, llm.ChatRequest{
+		Model: qr.Model,
+		Messages: []llm.Message{
+			{
+				Role:    llm.RoleUser,
+				Content: prompts.CondenseQuestion(history, msg),
+			},
+		},
+	})
+	if err != nil {
+		return msg, fmt.Errorf("failed to rewrite query: %w", err)
+	}
+	query = cleanQuery(response)
+	if query == "" {
+		query = msg
+	}
+	qr.Log.Info("rewrote query", slog.String("message", msg), slog.String("query", query))
+	return query, nil
+}
+
+// cleanQuery removes the label and quotes that models sometimes add around the query, and
+// any explanation after the first line.
+func cleanQuery(response string) string {
+	query := strings.TrimSpace(response)
+	query, _, _ = strings.Cut(query, "\n")
+	query = strings.TrimSpace(query)
+	if label, rest, ok := strings.Cut(query, ":"); ok && strings.EqualFold(strings.TrimSpace(label), "standalone question") {
+		query = strings.TrimSpace(rest)
+	}
+	return strings.Trim(query, "\"'` ")
+}
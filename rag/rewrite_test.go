@@ -0,0 +1,86 @@
+package rag_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/llm"
+	"github.com/a-h/ragmark/llm/fake"
+	"github.com/a-h/ragmark/rag"
+)
+
+func TestQueryRewriter(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "What is the Warrior?"},
+		{Role: llm.RoleAssistant, Content: "The Warrior is a tracked armoured vehicle."},
+	}
+
+	tests := []struct {
+		name     string
+		history  []llm.Message
+		response string
+		expected string
+	}{
+		{
+			name:     "messages without history are not rewritten",
+			history:  nil,
+			response: "unexpected",
+			expected: "What's its top speed?",
+		},
+		{
+			name:     "follow-up messages are rewritten",
+			history:  history,
+			response: "What is the top speed of the Warrior?",
+			expected: "What is the top speed of the Warrior?",
+		},
+		{
+			name:     "labels, quotes and explanations are removed",
+			history:  history,
+			response: "Standalone question: \"What is the top speed of the Warrior?\"\nI replaced its with the Warrior.",
+			expected: "What is the top speed of the Warrior?",
+		},
+		{
+			name:     "empty responses use the message",
+			history:  history,
+			response: "  ",
+			expected: "What's its top speed?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := fake.New()
+			model.Respond = func(req llm.ChatRequest) (string, error) {
+				if !strings.Contains(req.Messages[0].Content, "The Warrior is a tracked armoured vehicle.") {
+					t.Errorf("expected the history in the prompt, got %q", req.Messages[0].Content)
+				}
+				return tt.response, nil
+			}
+			query, err := rag.NewQueryRewriter(log, model, "model").Rewrite(ctx, tt.history, "What's its top speed?")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if query != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, query)
+			}
+		})
+	}
+	t.Run("errors return the message", func(t *testing.T) {
+		model := fake.New()
+		model.Respond = func(req llm.ChatRequest) (string, error) {
+			return "", errors.New("model unavailable")
+		}
+		query, err := rag.NewQueryRewriter(log, model, "model").Rewrite(ctx, history, "What's its top speed?")
+		if err == nil {
+			t.Error("expected an error")
+		}
+		if query != "What's its top speed?" {
+			t.Errorf("expected the message, got %q", query)
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package rdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteJSONLD writes the statements as a JSON-LD document, with a node object for each
+// subject in the @graph. The prefixes are written to the @context, and used to compact IRIs.
+func WriteJSONLD(w io.Writer, statements []Statement, prefixes []Prefix) (err error) {
+	context := map[string]string{}
+	for _, p := range prefixes {
+		context[p.Name] = p.IRI
+	}
+	iri := func(value string) string {
+		if name, ok := compact(prefixes, value); ok {
+			return name
+		}
+		return value
+	}
+	id := func(t Term) string {
+		if t.Kind == BlankNode {
+			return "_:" + t.Value
+		}
+		return iri(t.Value)
+	}
+	graph := []map[string]any{}
+	for _, group := range groupBySubject(statements) {
+		node := map[string]any{"@id": id(group[0].Subject)}
+		for _, s := range group {
+			if s.Predicate.Value == RDF+"type" && s.Object.Kind != Literal {
+				types, _ := node["@type"].([]string)
+				node["@type"] = append(types, id(s.Object))
+				continue
+			}
+			var value map[string]any
+			switch s.Object.Kind {
+			case Literal:
+				value = map[string]any{"@value": s.Object.Value}
+				if s.Object.Language != "" {
+					value["@language"] = s.Object.Language
+				} else if s.Object.Datatype != "" && s.Object.Datatype != XSD+"string" {
+					value["@type"] = iri(s.Object.Datatype)
+				}
+			default:
+				value = map[string]any{"@id": id(s.Object)}
+			}
+			key := iri(s.Predicate.Value)
+			values, _ := node[key].([]map[string]any)
+			node[key] = append(values, value)
+		}
+		graph = append(graph, node)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{
+		"@context": context,
+		"@graph":   graph,
+	})
+}
+
+// ReadJSONLD parses a JSON-LD document. The document can be a node object, an array of node
+// objects, or an object with a @graph. Contexts that map prefixes or terms to IRIs are
+// supported, but remote contexts, @vocab and lists aren't.
+func ReadJSONLD(r io.Reader) (statements []Statement, err error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var doc any
+	if err = dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("rdf: failed to decode JSON-LD: %w", err)
+	}
+	p := &jsonldParser{terms: map[string]string{}}
+	if err = p.document(doc); err != nil {
+		return nil, err
+	}
+	return p.statements, nil
+}
+
+type jsonldParser struct {
+	terms      map[string]string
+	blankNodes int
+	statements []Statement
+}
+
+func (p *jsonldParser) document(doc any) (err error) {
+	switch doc := doc.(type) {
+	case []any:
+		for _, node := range doc {
+			if _, err = p.node(node); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		if err = p.context(doc["@context"]); err != nil {
+			return err
+		}
+		if graph, ok := doc["@graph"]; ok {
+			return p.document(graph)
+		}
+		_, err = p.node(doc)
+		return err
+	}
+	return fmt.Errorf("rdf: expected a JSON-LD object or array, got %T", doc)
+}
+
+func (p *jsonldParser) context(ctx any) (err error) {
+	switch ctx := ctx.(type) {
+	case nil:
+		return nil
+	case []any:
+		for _, c := range ctx {
+			if err = p.context(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		// Sort the terms, so that errors are reported consistently.
+		keys := make([]string, 0, len(ctx))
+		for k := range ctx {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, term := range keys {
+			switch definition := ctx[term].(type) {
+			case string:
+				p.terms[term] = definition
+			case map[string]any:
+				id, ok := definition["@id"].(string)
+				if !ok {
+					return fmt.Errorf("rdf: unsupported JSON-LD term definition for %q", term)
+				}
+				p.terms[term] = id
+			default:
+				return fmt.Errorf("rdf: unsupported JSON-LD context value for %q", term)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("rdf: unsupported JSON-LD context, remote contexts aren't supported")
+}
+
+// expand returns the IRI of a term, compact IRI or absolute IRI.
+func (p *jsonldParser) expand(value string) (t Term, err error) {
+	if label, ok := strings.CutPrefix(value, "_:"); ok {
+		return NewBlankNode(label), nil
+	}
+	if iri, ok := p.terms[value]; ok {
+		return p.expand(iri)
+	}
+	if prefix, suffix, ok := strings.Cut(value, ":"); ok && !strings.HasPrefix(suffix, "//") {
+		if namespace, ok := p.terms[prefix]; ok {
+			return NewIRI(namespace + suffix), nil
+		}
+	}
+	if !strings.Contains(value, ":") {
+		return t, fmt.Errorf("rdf: can't expand JSON-LD term %q", value)
+	}
+	return NewIRI(value), nil
+}
+
+func (p *jsonldParser) node(v any) (subject Term, err error) {
+	node, ok := v.(map[string]any)
+	if !ok {
+		return subject, fmt.Errorf("rdf: expected a JSON-LD node object, got %T", v)
+	}
+	if err = p.context(node["@context"]); err != nil {
+		return subject, err
+	}
+	if id, ok := node["@id"].(string); ok {
+		if subject, err = p.expand(id); err != nil {
+			return subject, err
+		}
+	} else {
+		p.blankNodes++
+		subject = NewBlankNode("b" + strconv.Itoa(p.blankNodes))
+	}
+	keys := make([]string, 0, len(node))
+	for k := range node {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case "@id", "@context":
+			continue
+		case "@graph":
+			if err = p.document(node[key]); err != nil {
+				return subject, err
+			}
+			continue
+		case "@type":
+			for _, t := range asArray(node[key]) {
+				s, ok := t.(string)
+				if !ok {
+					return subject, fmt.Errorf("rdf: expected @type to be a string, got %T", t)
+				}
+				object, err := p.expand(s)
+				if err != nil {
+					return subject, err
+				}
+				p.statements = append(p.statements, Statement{Subject: subject, Predicate: NewIRI(RDF + "type"), Object: object})
+			}
+			continue
+		}
+		if strings.HasPrefix(key, "@") {
+			return subject, fmt.Errorf("rdf: unsupported JSON-LD keyword %q", key)
+		}
+		predicate, err := p.expand(key)
+		if err != nil {
+			return subject, err
+		}
+		for _, value := range asArray(node[key]) {
+			object, err := p.value(value)
+			if err != nil {
+				return subject, err
+			}
+			p.statements = append(p.statements, Statement{Subject: subject, Predicate: predicate, Object: object})
+		}
+	}
+	return subject, nil
+}
+
+func (p *jsonldParser) value(v any) (t Term, err error) {
+	switch v := v.(type) {
+	case string:
+		return NewLiteral(v), nil
+	case bool:
+		return Term{Kind: Literal, Value: strconv.FormatBool(v), Datatype: XSD + "boolean"}, nil
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return Term{Kind: Literal, Value: v.String(), Datatype: XSD + "integer"}, nil
+		}
+		return Term{Kind: Literal, Value: v.String(), Datatype: XSD + "double"}, nil
+	case map[string]any:
+		if value, ok := v["@value"]; ok {
+			t, err = p.value(value)
+			if err != nil {
+				return t, err
+			}
+			if language, ok := v["@language"].(string); ok {
+				t.Language, t.Datatype = language, ""
+			}
+			if datatype, ok := v["@type"].(string); ok {
+				dt, err := p.expand(datatype)
+				if err != nil {
+					return t, err
+				}
+				t.Datatype = dt.Value
+			}
+			return t, nil
+		}
+		if _, ok := v["@list"]; ok {
+			return t, fmt.Errorf("rdf: JSON-LD lists aren't supported")
+		}
+		if id, ok := v["@id"].(string); ok && len(v) == 1 {
+			return p.expand(id)
+		}
+		return p.node(v)
+	}
+	return t, fmt.Errorf("rdf: unsupported JSON-LD value %v", v)
+}
+
+func asArray(v any) []any {
+	if a, ok := v.([]any); ok {
+		return a
+	}
+	return []any{v}
+}
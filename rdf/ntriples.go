@@ -0,0 +1,68 @@
+package rdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteNTriples writes one statement per line, with full IRIs.
+func WriteNTriples(w io.Writer, statements []Statement) (err error) {
+	bw := bufio.NewWriter(w)
+	for _, s := range statements {
+		if _, err = fmt.Fprintf(bw, "%s %s %s .\n", s.Subject, s.Predicate, s.Object); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadNTriples parses an N-Triples document. N-Triples is a subset of Turtle, so the Turtle
+// parser is used.
+func ReadNTriples(r io.Reader) (statements []Statement, err error) {
+	return ReadTurtle(r)
+}
+
+// formatIRI writes an IRI reference, escaping the characters that aren't allowed in IRIs.
+func formatIRI(iri string) string {
+	var sb strings.Builder
+	sb.WriteByte('<')
+	for _, r := range iri {
+		if r <= 0x20 || strings.ContainsRune("<>\"{}|^`\\", r) {
+			fmt.Fprintf(&sb, "\\u%04X", r)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('>')
+	return sb.String()
+}
+
+// quote writes a string literal, escaping quotes, backslashes and line breaks.
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7F {
+				fmt.Fprintf(&sb, "\\u%04X", r)
+				continue
+			}
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
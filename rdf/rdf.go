@@ -0,0 +1,153 @@
+// Package rdf converts the triple store to and from RDF, so that the graph can be exchanged
+// with other RDF tools. N-Triples, Turtle and JSON-LD are supported.
+package rdf
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+type TermKind int
+
+const (
+	IRI TermKind = iota
+	BlankNode
+	Literal
+)
+
+// Term is an IRI, blank node or literal.
+type Term struct {
+	Kind TermKind
+	// Value is the IRI, the blank node label without the _: prefix, or the literal's lexical form.
+	Value string
+	// Datatype is the IRI of the literal's datatype, or empty for xsd:string.
+	Datatype string
+	// Language of the literal, if any.
+	Language string
+}
+
+func NewIRI(iri string) Term {
+	return Term{Kind: IRI, Value: iri}
+}
+
+func NewBlankNode(label string) Term {
+	return Term{Kind: BlankNode, Value: label}
+}
+
+func NewLiteral(value string) Term {
+	return Term{Kind: Literal, Value: value}
+}
+
+func (t Term) String() string {
+	switch t.Kind {
+	case BlankNode:
+		return "_:" + t.Value
+	case Literal:
+		s := quote(t.Value)
+		if t.Language != "" {
+			return s + "@" + t.Language
+		}
+		if t.Datatype != "" && t.Datatype != XSD+"string" {
+			return s + "^^" + formatIRI(t.Datatype)
+		}
+		return s
+	}
+	return formatIRI(t.Value)
+}
+
+// Statement is an RDF triple. It's named to avoid confusion with db.Triple.
+type Statement struct {
+	Subject   Term
+	Predicate Term
+	Object    Term
+}
+
+// Namespaces used by the triple store.
+const (
+	RDF  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	RDFS = "http://www.w3.org/2000/01/rdf-schema#"
+	XSD  = "http://www.w3.org/2001/XMLSchema#"
+	PROV = "http://www.w3.org/ns/prov#"
+	IES  = "http://ies.data.gov.uk/ontology/ies4#"
+)
+
+// Prefix is a short name for a namespace, e.g. ies for http://ies.data.gov.uk/ontology/ies4#.
+type Prefix struct {
+	Name string
+	IRI  string
+}
+
+// DefaultPrefixes are the prefixes used in the triple store, and written to Turtle and JSON-LD.
+var DefaultPrefixes = []Prefix{
+	{Name: "rdf", IRI: RDF},
+	{Name: "rdfs", IRI: RDFS},
+	{Name: "xsd", IRI: XSD},
+	{Name: "prov", IRI: PROV},
+	{Name: "ies", IRI: IES},
+}
+
+// localNamePattern matches local names that can be written as prefixed names in every format.
+var localNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// compact returns the prefixed name of the IRI, if it's in one of the namespaces.
+func compact(prefixes []Prefix, iri string) (name string, ok bool) {
+	for _, p := range prefixes {
+		if local, found := strings.CutPrefix(iri, p.IRI); found && localNamePattern.MatchString(local) {
+			return p.Name + ":" + local, true
+		}
+	}
+	return "", false
+}
+
+// Format of an RDF document.
+type Format string
+
+const (
+	FormatNTriples Format = "ntriples"
+	FormatTurtle   Format = "turtle"
+	FormatJSONLD   Format = "jsonld"
+)
+
+var Formats = []Format{FormatNTriples, FormatTurtle, FormatJSONLD}
+
+// ParseFormat returns the Format with the given name, or the format used by a file extension,
+// e.g. .nt, .ttl or .jsonld.
+func ParseFormat(s string) (f Format, err error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "ntriples", "nt", "n-triples":
+		return FormatNTriples, nil
+	case "turtle", "ttl":
+		return FormatTurtle, nil
+	case "jsonld", "json-ld", "json":
+		return FormatJSONLD, nil
+	}
+	return f, fmt.Errorf("unknown RDF format %q, expected ntriples, turtle or jsonld", s)
+}
+
+// Write the statements in the format.
+func Write(w io.Writer, format Format, statements []Statement) (err error) {
+	switch format {
+	case FormatNTriples:
+		return WriteNTriples(w, statements)
+	case FormatTurtle:
+		return WriteTurtle(w, statements, DefaultPrefixes)
+	case FormatJSONLD:
+		return WriteJSONLD(w, statements, DefaultPrefixes)
+	}
+	return fmt.Errorf("unknown RDF format %q", format)
+}
+
+// Read statements in the format.
+func Read(r io.Reader, format Format) (statements []Statement, err error) {
+	switch format {
+	case FormatNTriples:
+		return ReadNTriples(r)
+	case FormatTurtle:
+		return ReadTurtle(r)
+	case FormatJSONLD:
+		return ReadJSONLD(r)
+	}
+	return nil, fmt.Errorf("unknown RDF format %q", format)
+}
@@ -0,0 +1,226 @@
+package rdf_test
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/rdf"
+	gocmp "github.com/google/go-cmp/cmp"
+)
+
+func sortTriples(triples []db.Triple) []db.Triple {
+	slices.SortFunc(triples, func(a, b db.Triple) int {
+		return cmp.Or(
+			strings.Compare(a.Subject, b.Subject),
+			strings.Compare(a.Predicate, b.Predicate),
+			strings.Compare(a.Object, b.Object),
+			strings.Compare(a.Source, b.Source),
+		)
+	})
+	return triples
+}
+
+func TestRoundTrip(t *testing.T) {
+	triples := []db.Triple{
+		{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: "/aircraft/apache"},
+		{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft", Source: "/aircraft"},
+		{Subject: "Boeing", Predicate: "ies:make", Object: "Apache", Source: "/aircraft/apache"},
+		{Subject: "subject", Predicate: "has_used", Object: "object"},
+		{Subject: "subject", Predicate: "has_used", Object: "object", Source: "/with space/and ünïcode"},
+		{Subject: `The "Quoted" <Name>`, Predicate: "ies:nearTo", Object: "Line one\nline two"},
+		{Subject: "Note: a colon", Predicate: "ies:isPartOf", Object: "ies:Not A Local Name"},
+		{Subject: "https://example.com/vehicles#tank", Predicate: "rdfs:seeAlso", Object: "urn:isbn:0451450523"},
+		{Subject: "http://ies.data.gov.uk/ontology/ies4#Aircraft", Predicate: "rdfs:label", Object: "https://example.com/graph/entity?id=Apache"},
+		{Subject: "_:blank", Predicate: "unknown:predicate", Object: "ies:Tank.Heavy"},
+	}
+	m, err := rdf.NewMapping("https://example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, format := range rdf.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := rdf.Write(&buf, format, m.Encode(triples)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			statements, err := rdf.Read(&buf, format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v\n%s", err, buf.String())
+			}
+			actual, err := m.Decode(statements)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := gocmp.Diff(sortTriples(slices.Clone(triples)), sortTriples(actual)); diff != "" {
+				t.Errorf("unexpected triples (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMapping(t *testing.T) {
+	m, err := rdf.NewMapping("https://example.com/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		term     string
+		expected string
+	}{
+		{term: "ies:Aircraft", expected: "http://ies.data.gov.uk/ontology/ies4#Aircraft"},
+		{term: "rdf:type", expected: "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"},
+		{term: "Challenger 2", expected: "https://example.com/graph/entity?id=Challenger+2"},
+		{term: "https://example.com/vehicles", expected: "https://example.com/vehicles"},
+	}
+	for _, test := range tests {
+		t.Run(test.term, func(t *testing.T) {
+			if actual := m.TermIRI(test.term); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+	t.Run("document paths are relative to the base IRI", func(t *testing.T) {
+		if actual := m.DocumentIRI("/aircraft/apache"); actual != "https://example.com/aircraft/apache" {
+			t.Errorf("unexpected IRI %q", actual)
+		}
+	})
+	t.Run("the base IRI must be absolute", func(t *testing.T) {
+		if _, err := rdf.NewMapping("/graph"); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestReadTurtle(t *testing.T) {
+	input := `@prefix ies: <http://ies.data.gov.uk/ontology/ies4#> .
+PREFIX ex: <https://example.com/>
+@base <https://example.com/docs/> .
+
+# Comments are ignored.
+ex:apache a ies:Aircraft, ies:Vehicle ;
+    ex:name "Apache"@en, 'AH-64'^^<http://www.w3.org/2001/XMLSchema#token> ;
+    ex:rotors 2 ;
+    ex:speed 1.5e2 ;
+    ex:armed true ;
+    ex:description """Multi
+line""" ;
+    ex:page <apache> ;
+    ex:operator [ ex:name "British Army" ] .
+_:x ex:escaped "tab\tquote\" é" .
+`
+	statements, err := rdf.ReadTurtle(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	apache := rdf.NewIRI("https://example.com/apache")
+	iri := func(s string) rdf.Term { return rdf.NewIRI("https://example.com/" + s) }
+	expected := []rdf.Statement{
+		{Subject: apache, Predicate: rdf.NewIRI(rdf.RDF + "type"), Object: rdf.NewIRI(rdf.IES + "Aircraft")},
+		{Subject: apache, Predicate: rdf.NewIRI(rdf.RDF + "type"), Object: rdf.NewIRI(rdf.IES + "Vehicle")},
+		{Subject: apache, Predicate: iri("name"), Object: rdf.Term{Kind: rdf.Literal, Value: "Apache", Language: "en"}},
+		{Subject: apache, Predicate: iri("name"), Object: rdf.Term{Kind: rdf.Literal, Value: "AH-64", Datatype: rdf.XSD + "token"}},
+		{Subject: apache, Predicate: iri("rotors"), Object: rdf.Term{Kind: rdf.Literal, Value: "2", Datatype: rdf.XSD + "integer"}},
+		{Subject: apache, Predicate: iri("speed"), Object: rdf.Term{Kind: rdf.Literal, Value: "1.5e2", Datatype: rdf.XSD + "double"}},
+		{Subject: apache, Predicate: iri("armed"), Object: rdf.Term{Kind: rdf.Literal, Value: "true", Datatype: rdf.XSD + "boolean"}},
+		{Subject: apache, Predicate: iri("description"), Object: rdf.NewLiteral("Multi\nline")},
+		{Subject: apache, Predicate: iri("page"), Object: rdf.NewIRI("https://example.com/docs/apache")},
+		{Subject: rdf.NewBlankNode("anon1"), Predicate: iri("name"), Object: rdf.NewLiteral("British Army")},
+		{Subject: apache, Predicate: iri("operator"), Object: rdf.NewBlankNode("anon1")},
+		{Subject: rdf.NewBlankNode("x"), Predicate: iri("escaped"), Object: rdf.NewLiteral("tab\tquote\" é")},
+	}
+	if diff := gocmp.Diff(expected, statements); diff != "" {
+		t.Errorf("unexpected statements (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadTurtleErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "unknown prefix", input: "ex:a ex:b ex:c ."},
+		{name: "missing full stop", input: "<a> <b> <c>"},
+		{name: "literal subject", input: `"a" <b> <c> .`},
+		{name: "unterminated string", input: `<a> <b> "c .`},
+		{name: "collection", input: "<a> <b> ( <c> ) ."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := rdf.ReadTurtle(strings.NewReader(test.input)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestReadJSONLD(t *testing.T) {
+	input := `{
+  "@context": {"ies": "http://ies.data.gov.uk/ontology/ies4#", "name": {"@id": "https://example.com/name"}},
+  "@graph": [
+    {
+      "@id": "https://example.com/apache",
+      "@type": "ies:Aircraft",
+      "name": [{"@value": "Apache", "@language": "en"}, "AH-64"],
+      "ies:rotors": 2,
+      "ies:operator": {"name": "British Army"},
+      "ies:page": {"@id": "https://example.com/docs/apache"}
+    }
+  ]
+}`
+	statements, err := rdf.ReadJSONLD(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	apache := rdf.NewIRI("https://example.com/apache")
+	name := rdf.NewIRI("https://example.com/name")
+	expected := []rdf.Statement{
+		{Subject: apache, Predicate: rdf.NewIRI(rdf.RDF + "type"), Object: rdf.NewIRI(rdf.IES + "Aircraft")},
+		{Subject: rdf.NewBlankNode("b1"), Predicate: name, Object: rdf.NewLiteral("British Army")},
+		{Subject: apache, Predicate: rdf.NewIRI(rdf.IES + "operator"), Object: rdf.NewBlankNode("b1")},
+		{Subject: apache, Predicate: rdf.NewIRI(rdf.IES + "page"), Object: rdf.NewIRI("https://example.com/docs/apache")},
+		{Subject: apache, Predicate: rdf.NewIRI(rdf.IES + "rotors"), Object: rdf.Term{Kind: rdf.Literal, Value: "2", Datatype: rdf.XSD + "integer"}},
+		{Subject: apache, Predicate: name, Object: rdf.Term{Kind: rdf.Literal, Value: "Apache", Language: "en"}},
+		{Subject: apache, Predicate: name, Object: rdf.NewLiteral("AH-64")},
+	}
+	if diff := gocmp.Diff(expected, statements); diff != "" {
+		t.Errorf("unexpected statements (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteTurtle(t *testing.T) {
+	m, err := rdf.NewMapping("https://example.com/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	err = rdf.WriteTurtle(&buf, m.Encode([]db.Triple{
+		{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Aircraft"},
+		{Subject: "Apache", Predicate: "rdf:type", Object: "ies:Vehicle"},
+		{Subject: "Apache", Predicate: "ies:operator", Object: "British Army", Source: "/aircraft/apache"},
+	}), rdf.DefaultPrefixes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .
+@prefix rdfs: <http://www.w3.org/2000/01/rdf-schema#> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+@prefix prov: <http://www.w3.org/ns/prov#> .
+@prefix ies: <http://ies.data.gov.uk/ontology/ies4#> .
+
+<https://example.com/graph/entity?id=Apache> a ies:Aircraft, ies:Vehicle ;
+    ies:operator <https://example.com/graph/entity?id=British+Army> .
+
+_:s1 a rdf:Statement ;
+    rdf:subject <https://example.com/graph/entity?id=Apache> ;
+    rdf:predicate ies:operator ;
+    rdf:object <https://example.com/graph/entity?id=British+Army> ;
+    prov:wasDerivedFrom <https://example.com/aircraft/apache> .
+`
+	if diff := gocmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("unexpected output (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,236 @@
+package rdf
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/a-h/ragmark/db"
+)
+
+// Mapping converts between the triple store and RDF.
+//
+// Terms in the triple store are names, e.g. "Apache", or prefixed names, e.g. ies:Aircraft.
+// Prefixed names in DefaultPrefixes are expanded to IRIs in their namespace, and absolute
+// IRIs are used as they are. Other names become IRIs of the entity page of the graph browser,
+// e.g. https://example.com/graph/entity?id=Apache.
+//
+// The source document of each triple is recorded by reifying the triple, with a
+// prov:wasDerivedFrom statement that links to the document's IRI, e.g.
+// https://example.com/aircraft/apache. Triples are only reified if they have a source.
+type Mapping struct {
+	// BaseIRI is used to create the IRIs of documents and entities, e.g. https://example.com/.
+	BaseIRI  string
+	Prefixes []Prefix
+}
+
+// NewMapping creates a mapping that uses the base IRI for documents and entities.
+func NewMapping(baseIRI string) (m Mapping, err error) {
+	u, err := url.Parse(baseIRI)
+	if err != nil || !u.IsAbs() {
+		return m, fmt.Errorf("rdf: the base IRI must be an absolute IRI, e.g. https://example.com/, got %q", baseIRI)
+	}
+	if !strings.HasSuffix(baseIRI, "/") {
+		baseIRI += "/"
+	}
+	return Mapping{
+		BaseIRI:  baseIRI,
+		Prefixes: DefaultPrefixes,
+	}, nil
+}
+
+func (m Mapping) entityPrefix() string {
+	return m.BaseIRI + "graph/entity?id="
+}
+
+// absoluteIRIPattern matches IRIs with a scheme that don't contain characters that aren't
+// allowed in IRIs, e.g. spaces.
+var absoluteIRIPattern = regexp.MustCompile("^[A-Za-z][A-Za-z0-9+.-]*:[^\\s<>\"{}|\\\\^`]+$")
+
+// TermIRI returns the IRI of a term in the triple store.
+func (m Mapping) TermIRI(term string) string {
+	prefix, local, _ := strings.Cut(term, ":")
+	for _, p := range m.Prefixes {
+		if p.Name != prefix {
+			continue
+		}
+		if localNamePattern.MatchString(local) {
+			return p.IRI + local
+		}
+		// A scheme that's also a prefix, e.g. ies:Tank.Heavy, would be expanded by JSON-LD.
+		return m.entityPrefix() + url.QueryEscape(term)
+	}
+	// Absolute IRIs that would be read back as a different term are treated as names.
+	if absoluteIRIPattern.MatchString(term) && m.Term(term) == term {
+		return term
+	}
+	return m.entityPrefix() + url.QueryEscape(term)
+}
+
+// Term returns the triple store term of an IRI.
+func (m Mapping) Term(iri string) string {
+	if escaped, ok := strings.CutPrefix(iri, m.entityPrefix()); ok {
+		if term, err := url.QueryUnescape(escaped); err == nil {
+			return term
+		}
+	}
+	if name, ok := compact(m.Prefixes, iri); ok {
+		return name
+	}
+	return iri
+}
+
+// DocumentIRI returns the IRI of a document path, e.g. /aircraft/apache.
+func (m Mapping) DocumentIRI(path string) string {
+	return m.BaseIRI + strings.TrimPrefix((&url.URL{Path: path}).EscapedPath(), "/")
+}
+
+// DocumentPath returns the path of a document IRI, or the IRI if it's not below the base IRI.
+func (m Mapping) DocumentPath(iri string) string {
+	escaped, ok := strings.CutPrefix(iri, m.BaseIRI)
+	if !ok {
+		return iri
+	}
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return iri
+	}
+	return "/" + path
+}
+
+var (
+	rdfType            = NewIRI(RDF + "type")
+	rdfStatement       = NewIRI(RDF + "Statement")
+	rdfSubject         = NewIRI(RDF + "subject")
+	rdfPredicate       = NewIRI(RDF + "predicate")
+	rdfObject          = NewIRI(RDF + "object")
+	provWasDerivedFrom = NewIRI(PROV + "wasDerivedFrom")
+)
+
+type tripleKey struct {
+	subject, predicate, object string
+}
+
+// Encode converts the triples to RDF statements.
+func (m Mapping) Encode(triples []db.Triple) (statements []Statement) {
+	var keys []tripleKey
+	sources := map[tripleKey][]string{}
+	for _, t := range triples {
+		k := tripleKey{t.Subject, t.Predicate, t.Object}
+		if _, ok := sources[k]; !ok {
+			keys = append(keys, k)
+		}
+		sources[k] = append(sources[k], t.Source)
+	}
+	var reified int
+	for _, k := range keys {
+		s, p, o := NewIRI(m.TermIRI(k.subject)), NewIRI(m.TermIRI(k.predicate)), NewIRI(m.TermIRI(k.object))
+		statements = append(statements, Statement{Subject: s, Predicate: p, Object: o})
+		if len(sources[k]) == 1 && sources[k][0] == "" {
+			continue
+		}
+		for _, source := range sources[k] {
+			reified++
+			node := NewBlankNode(fmt.Sprintf("s%d", reified))
+			statements = append(statements,
+				Statement{Subject: node, Predicate: rdfType, Object: rdfStatement},
+				Statement{Subject: node, Predicate: rdfSubject, Object: s},
+				Statement{Subject: node, Predicate: rdfPredicate, Object: p},
+				Statement{Subject: node, Predicate: rdfObject, Object: o},
+			)
+			if source != "" {
+				statements = append(statements, Statement{Subject: node, Predicate: provWasDerivedFrom, Object: NewIRI(m.DocumentIRI(source))})
+			}
+		}
+	}
+	return statements
+}
+
+type reification struct {
+	subject, predicate, object *Term
+	sources                    []string
+}
+
+// Decode converts RDF statements to triples. Reified statements set the source of the
+// triple that they describe. Triples that are reified more than once are returned once for
+// each source.
+func (m Mapping) Decode(statements []Statement) (triples []db.Triple, err error) {
+	reifications := map[Term]*reification{}
+	for _, s := range statements {
+		if s.Predicate == rdfType && s.Object == rdfStatement {
+			reifications[s.Subject] = &reification{}
+		}
+	}
+	var asserted []Statement
+	for _, s := range statements {
+		r, ok := reifications[s.Subject]
+		if !ok {
+			asserted = append(asserted, s)
+			continue
+		}
+		object := s.Object
+		switch s.Predicate {
+		case rdfType:
+			if s.Object != rdfStatement {
+				asserted = append(asserted, s)
+			}
+		case rdfSubject:
+			r.subject = &object
+		case rdfPredicate:
+			r.predicate = &object
+		case rdfObject:
+			r.object = &object
+		case provWasDerivedFrom:
+			if object.Kind == Literal {
+				r.sources = append(r.sources, object.Value)
+				continue
+			}
+			r.sources = append(r.sources, m.DocumentPath(object.Value))
+		default:
+			asserted = append(asserted, s)
+		}
+	}
+	sources := map[tripleKey][]string{}
+	for node, r := range reifications {
+		if r.subject == nil || r.predicate == nil || r.object == nil {
+			return nil, fmt.Errorf("rdf: reified statement %s must have a subject, predicate and object", node)
+		}
+		k := tripleKey{m.term(*r.subject), m.term(*r.predicate), m.term(*r.object)}
+		if len(r.sources) == 0 {
+			r.sources = []string{""}
+		}
+		sources[k] = append(sources[k], r.sources...)
+	}
+	seen := map[db.Triple]bool{}
+	for _, s := range asserted {
+		if s.Predicate.Kind != IRI {
+			return nil, fmt.Errorf("rdf: the predicate of %s %s %s must be an IRI", s.Subject, s.Predicate, s.Object)
+		}
+		k := tripleKey{m.term(s.Subject), m.term(s.Predicate), m.term(s.Object)}
+		tripleSources, ok := sources[k]
+		if !ok {
+			tripleSources = []string{""}
+		}
+		for _, source := range tripleSources {
+			t := db.Triple{Subject: k.subject, Predicate: k.predicate, Object: k.object, Source: source}
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			triples = append(triples, t)
+		}
+	}
+	return triples, nil
+}
+
+// term returns the triple store term of an RDF term. Literals are stored as their value.
+func (m Mapping) term(t Term) string {
+	switch t.Kind {
+	case BlankNode:
+		return "_:" + t.Value
+	case Literal:
+		return t.Value
+	}
+	return m.Term(t.Value)
+}
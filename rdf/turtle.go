@@ -0,0 +1,550 @@
+package rdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// WriteTurtle writes the statements, grouped by subject, using the prefixes for IRIs in
+// their namespaces.
+func WriteTurtle(w io.Writer, statements []Statement, prefixes []Prefix) (err error) {
+	bw := bufio.NewWriter(w)
+	for _, p := range prefixes {
+		fmt.Fprintf(bw, "@prefix %s: %s .\n", p.Name, formatIRI(p.IRI))
+	}
+	term := func(t Term) string {
+		if t.Kind == IRI {
+			if name, ok := compact(prefixes, t.Value); ok {
+				return name
+			}
+		}
+		if t.Kind == Literal && t.Language == "" && t.Datatype != "" && t.Datatype != XSD+"string" {
+			if name, ok := compact(prefixes, t.Datatype); ok {
+				return quote(t.Value) + "^^" + name
+			}
+		}
+		return t.String()
+	}
+	for _, group := range groupBySubject(statements) {
+		fmt.Fprintf(bw, "\n%s", term(group[0].Subject))
+		for i, s := range group {
+			switch {
+			case i == 0:
+				bw.WriteString(" ")
+			case s.Predicate == group[i-1].Predicate:
+				bw.WriteString(", ")
+				bw.WriteString(term(s.Object))
+				continue
+			default:
+				bw.WriteString(" ;\n    ")
+			}
+			if s.Predicate == NewIRI(RDF+"type") {
+				bw.WriteString("a")
+			} else {
+				bw.WriteString(term(s.Predicate))
+			}
+			bw.WriteString(" ")
+			bw.WriteString(term(s.Object))
+		}
+		bw.WriteString(" .\n")
+	}
+	return bw.Flush()
+}
+
+// groupBySubject returns the statements of each subject, in the order that the subjects first
+// appear. Within each group, statements with the same predicate are together.
+func groupBySubject(statements []Statement) (groups [][]Statement) {
+	index := map[Term]int{}
+	for _, s := range statements {
+		i, ok := index[s.Subject]
+		if !ok {
+			i = len(groups)
+			index[s.Subject] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], s)
+	}
+	for gi, group := range groups {
+		var sorted []Statement
+		done := make([]bool, len(group))
+		for i := range group {
+			if done[i] {
+				continue
+			}
+			for j := i; j < len(group); j++ {
+				if !done[j] && group[j].Predicate == group[i].Predicate {
+					sorted = append(sorted, group[j])
+					done[j] = true
+				}
+			}
+		}
+		groups[gi] = sorted
+	}
+	return groups
+}
+
+// ReadTurtle parses a Turtle document. Collections, e.g. ( 1 2 3 ), aren't supported.
+func ReadTurtle(r io.Reader) (statements []Statement, err error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("rdf: failed to read turtle: %w", err)
+	}
+	p := &turtleParser{
+		src:      []rune(string(src)),
+		line:     1,
+		prefixes: map[string]string{},
+	}
+	if err = p.parse(); err != nil {
+		return nil, err
+	}
+	return p.statements, nil
+}
+
+type turtleParser struct {
+	src        []rune
+	pos        int
+	line       int
+	prefixes   map[string]string
+	base       *url.URL
+	blankNodes int
+	statements []Statement
+}
+
+func (p *turtleParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("rdf: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *turtleParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *turtleParser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *turtleParser) next() rune {
+	r := p.peek()
+	p.pos++
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *turtleParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:min(p.pos+len(s), len(p.src))]), s)
+}
+
+func (p *turtleParser) hasKeyword(s string) bool {
+	end := p.pos + len(s)
+	if end > len(p.src) || !strings.EqualFold(string(p.src[p.pos:end]), s) {
+		return false
+	}
+	return end == len(p.src) || !isNameRune(p.src[end])
+}
+
+func (p *turtleParser) skipSpace() {
+	for !p.eof() {
+		switch r := p.peek(); {
+		case r == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		case unicode.IsSpace(r):
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+func (p *turtleParser) expect(r rune) error {
+	p.skipSpace()
+	if got := p.peek(); got != r {
+		if p.eof() {
+			return p.errorf("expected %q, got end of input", r)
+		}
+		return p.errorf("expected %q, got %q", r, got)
+	}
+	p.next()
+	return nil
+}
+
+func (p *turtleParser) parse() (err error) {
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil
+		}
+		switch {
+		case p.hasKeyword("@prefix"), p.hasKeyword("prefix"):
+			err = p.prefixDirective()
+		case p.hasKeyword("@base"), p.hasKeyword("base"):
+			err = p.baseDirective()
+		default:
+			err = p.triples()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *turtleParser) prefixDirective() (err error) {
+	sparql := p.peek() != '@'
+	for !unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+	p.skipSpace()
+	var name strings.Builder
+	for !p.eof() && p.peek() != ':' {
+		name.WriteRune(p.next())
+	}
+	if err = p.expect(':'); err != nil {
+		return err
+	}
+	p.skipSpace()
+	iri, err := p.iriRef()
+	if err != nil {
+		return err
+	}
+	p.prefixes[strings.TrimSpace(name.String())] = iri
+	if sparql {
+		return nil
+	}
+	return p.expect('.')
+}
+
+func (p *turtleParser) baseDirective() (err error) {
+	sparql := p.peek() != '@'
+	for !unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+	p.skipSpace()
+	iri, err := p.iriRef()
+	if err != nil {
+		return err
+	}
+	if p.base, err = url.Parse(iri); err != nil {
+		return p.errorf("invalid base IRI %q: %v", iri, err)
+	}
+	if sparql {
+		return nil
+	}
+	return p.expect('.')
+}
+
+func (p *turtleParser) triples() (err error) {
+	var subject Term
+	if p.peek() == '[' {
+		if subject, err = p.blankNodePropertyList(); err != nil {
+			return err
+		}
+		p.skipSpace()
+		if p.peek() == '.' {
+			p.next()
+			return nil
+		}
+	} else if subject, err = p.term(); err != nil {
+		return err
+	}
+	if subject.Kind == Literal {
+		return p.errorf("a literal can't be a subject")
+	}
+	if err = p.predicateObjectList(subject); err != nil {
+		return err
+	}
+	return p.expect('.')
+}
+
+func (p *turtleParser) predicateObjectList(subject Term) (err error) {
+	for {
+		p.skipSpace()
+		var predicate Term
+		if p.peek() == 'a' && p.hasKeyword("a") {
+			p.next()
+			predicate = NewIRI(RDF + "type")
+		} else if predicate, err = p.term(); err != nil {
+			return err
+		}
+		if predicate.Kind != IRI {
+			return p.errorf("a predicate must be an IRI")
+		}
+		for {
+			p.skipSpace()
+			var object Term
+			if p.peek() == '[' {
+				object, err = p.blankNodePropertyList()
+			} else {
+				object, err = p.term()
+			}
+			if err != nil {
+				return err
+			}
+			p.statements = append(p.statements, Statement{Subject: subject, Predicate: predicate, Object: object})
+			p.skipSpace()
+			if p.peek() != ',' {
+				break
+			}
+			p.next()
+		}
+		if p.peek() != ';' {
+			return nil
+		}
+		for p.peek() == ';' {
+			p.next()
+			p.skipSpace()
+		}
+		if p.peek() == '.' || p.peek() == ']' {
+			return nil
+		}
+	}
+}
+
+func (p *turtleParser) newBlankNode() Term {
+	p.blankNodes++
+	return NewBlankNode(fmt.Sprintf("anon%d", p.blankNodes))
+}
+
+func (p *turtleParser) blankNodePropertyList() (node Term, err error) {
+	p.next()
+	node = p.newBlankNode()
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.next()
+		return node, nil
+	}
+	if err = p.predicateObjectList(node); err != nil {
+		return node, err
+	}
+	return node, p.expect(']')
+}
+
+func (p *turtleParser) term() (t Term, err error) {
+	p.skipSpace()
+	switch r := p.peek(); {
+	case p.eof():
+		return t, p.errorf("unexpected end of input")
+	case r == '<':
+		iri, err := p.iriRef()
+		return NewIRI(iri), err
+	case r == '"' || r == '\'':
+		return p.literal()
+	case r == '(':
+		return t, p.errorf("collections aren't supported")
+	case r == '_' && p.hasPrefix("_:"):
+		p.pos += 2
+		return NewBlankNode(p.name()), nil
+	case r == '+' || r == '-' || r == '.' || unicode.IsDigit(r):
+		return p.number()
+	case p.hasKeyword("true") || p.hasKeyword("false"):
+		value := "true"
+		if r == 'f' {
+			value = "false"
+		}
+		p.pos += len(value)
+		return Term{Kind: Literal, Value: value, Datatype: XSD + "boolean"}, nil
+	}
+	return p.prefixedName()
+}
+
+// name reads a blank node label or local name. Names can contain dots, but not end with one.
+func (p *turtleParser) name() string {
+	var sb strings.Builder
+	for !p.eof() {
+		r := p.peek()
+		if r == '\\' && p.pos+1 < len(p.src) {
+			p.next()
+			sb.WriteRune(p.next())
+			continue
+		}
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:%", r)) {
+			break
+		}
+		if r == '.' && (p.pos+1 >= len(p.src) || !isNameRune(p.src[p.pos+1])) {
+			break
+		}
+		sb.WriteRune(p.next())
+	}
+	return sb.String()
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-:%", r)
+}
+
+func (p *turtleParser) prefixedName() (t Term, err error) {
+	var prefix strings.Builder
+	for !p.eof() && p.peek() != ':' && isNameRune(p.peek()) {
+		prefix.WriteRune(p.next())
+	}
+	if p.peek() != ':' {
+		if p.eof() {
+			return t, p.errorf("unexpected end of input")
+		}
+		return t, p.errorf("unexpected %q", p.peek())
+	}
+	p.next()
+	namespace, ok := p.prefixes[prefix.String()]
+	if !ok {
+		return t, p.errorf("unknown prefix %q", prefix.String())
+	}
+	return NewIRI(namespace + p.name()), nil
+}
+
+func (p *turtleParser) iriRef() (iri string, err error) {
+	if err = p.expect('<'); err != nil {
+		return iri, err
+	}
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return iri, p.errorf("unterminated IRI")
+		}
+		r := p.next()
+		if r == '>' {
+			break
+		}
+		if r == '\\' {
+			if r, err = p.unicodeEscape(); err != nil {
+				return iri, err
+			}
+		}
+		sb.WriteRune(r)
+	}
+	iri = sb.String()
+	if p.base != nil {
+		ref, err := url.Parse(iri)
+		if err != nil {
+			return iri, p.errorf("invalid IRI %q: %v", iri, err)
+		}
+		iri = p.base.ResolveReference(ref).String()
+	}
+	return iri, nil
+}
+
+func (p *turtleParser) unicodeEscape() (r rune, err error) {
+	var digits int
+	switch p.next() {
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	default:
+		return r, p.errorf("invalid escape sequence")
+	}
+	if p.pos+digits > len(p.src) {
+		return r, p.errorf("invalid escape sequence")
+	}
+	hex := string(p.src[p.pos : p.pos+digits])
+	p.pos += digits
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return r, p.errorf("invalid escape sequence \\u%s", hex)
+	}
+	return rune(v), nil
+}
+
+func (p *turtleParser) literal() (t Term, err error) {
+	quoteRune := p.peek()
+	delimiter := string(quoteRune)
+	if p.hasPrefix(strings.Repeat(delimiter, 3)) {
+		delimiter = strings.Repeat(delimiter, 3)
+	}
+	p.pos += len(delimiter)
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return t, p.errorf("unterminated string")
+		}
+		if p.hasPrefix(delimiter) {
+			p.pos += len(delimiter)
+			break
+		}
+		r := p.next()
+		if r == '\n' && len(delimiter) == 1 {
+			return t, p.errorf("unterminated string")
+		}
+		if r == '\\' {
+			switch e := p.peek(); e {
+			case 't':
+				r = '\t'
+			case 'b':
+				r = '\b'
+			case 'n':
+				r = '\n'
+			case 'r':
+				r = '\r'
+			case 'f':
+				r = '\f'
+			case '"', '\'', '\\':
+				r = e
+			case 'u', 'U':
+				if r, err = p.unicodeEscape(); err != nil {
+					return t, err
+				}
+				sb.WriteRune(r)
+				continue
+			default:
+				return t, p.errorf("invalid escape sequence \\%c", e)
+			}
+			p.next()
+		}
+		sb.WriteRune(r)
+	}
+	t = NewLiteral(sb.String())
+	switch {
+	case p.peek() == '@':
+		p.next()
+		var lang strings.Builder
+		for !p.eof() && (unicode.IsLetter(p.peek()) || unicode.IsDigit(p.peek()) || p.peek() == '-') {
+			lang.WriteRune(p.next())
+		}
+		t.Language = lang.String()
+	case p.hasPrefix("^^"):
+		p.pos += 2
+		datatype, err := p.term()
+		if err != nil {
+			return t, err
+		}
+		if datatype.Kind != IRI {
+			return t, p.errorf("a datatype must be an IRI")
+		}
+		t.Datatype = datatype.Value
+	}
+	return t, nil
+}
+
+func (p *turtleParser) number() (t Term, err error) {
+	var sb strings.Builder
+	for !p.eof() {
+		r := p.peek()
+		if r == '.' && (p.pos+1 >= len(p.src) || !unicode.IsDigit(p.src[p.pos+1])) {
+			break
+		}
+		if !(unicode.IsDigit(r) || strings.ContainsRune("+-.eE", r)) {
+			break
+		}
+		sb.WriteRune(p.next())
+	}
+	value := sb.String()
+	datatype := XSD + "integer"
+	switch {
+	case strings.ContainsAny(value, "eE"):
+		datatype = XSD + "double"
+	case strings.Contains(value, "."):
+		datatype = XSD + "decimal"
+	}
+	if _, err = strconv.ParseFloat(value, 64); err != nil {
+		return t, p.errorf("invalid number %q", value)
+	}
+	return Term{Kind: Literal, Value: value, Datatype: datatype}, nil
+}
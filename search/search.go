@@ -0,0 +1,47 @@
+package search
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/site"
+	"github.com/a-h/ragmark/templates"
+	"github.com/a-h/templ"
+)
+
+func NewHandler(log *slog.Logger, s *site.Site, queries db.Querier) Handler {
+	return Handler{
+		Log:     log,
+		Site:    s,
+		queries: queries,
+	}
+}
+
+// Handler renders the full-text search page, e.g. /search?q=term.
+type Handler struct {
+	Log     *slog.Logger
+	Site    *site.Site
+	queries db.Querier
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	results, err := h.queries.DocumentFTSSearch(r.Context(), db.DocumentFTSSearchArgs{
+		Query: query,
+		Limit: 20,
+	})
+	if err != nil {
+		h.Log.Error("failed to search documents", slog.String("query", query), slog.Any("error", err))
+		http.Error(w, "failed to search documents", http.StatusInternalServerError)
+		return
+	}
+	left := templates.Left(h.Site)
+	middle := templates.Search(query, results)
+	right := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		return nil
+	})
+	templ.Handler(templates.Page(left, middle, right)).ServeHTTP(w, r)
+}
@@ -0,0 +1,105 @@
+package search_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/a-h/ragmark/db"
+	"github.com/a-h/ragmark/search"
+	"github.com/a-h/ragmark/site"
+)
+
+type querier struct {
+	db.Querier
+	results []db.DocumentFTSSearchResult
+	err     error
+}
+
+func (q querier) DocumentFTSSearch(ctx context.Context, args db.DocumentFTSSearchArgs) ([]db.DocumentFTSSearchResult, error) {
+	if args.Query == "" {
+		return nil, q.err
+	}
+	return q.results, q.err
+}
+
+func TestHandler(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	s, err := site.New(site.SiteArgs{
+		Log: log,
+		Dir: fstest.MapFS{"apache.md": &fstest.MapFile{Data: []byte("# Apache\n\nAn attack helicopter.")}},
+		ContentHandlers: []site.DirEntryHandler{
+			site.NewMarkdownDirEntryHandler(func(site *site.Site, page site.Metadata, toc []site.MenuItem, outputHTML string, err error) http.Handler {
+				return nil
+			}),
+			site.NewDirectoryDirEntryHandler(func(s *site.Site, dir site.Metadata, children []site.Metadata) http.Handler {
+				return nil
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get := func(t *testing.T, q querier, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		search.NewHandler(log, s, q).ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	t.Run("an empty query renders the search form without results", func(t *testing.T) {
+		w := get(t, querier{}, "/search?q=")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, `role="search"`) {
+			t.Error("expected the search form to be rendered")
+		}
+		if strings.Contains(body, "search-results") || strings.Contains(body, "No results") {
+			t.Errorf("expected no results to be rendered, got:\n%s", body)
+		}
+	})
+	t.Run("matching terms are highlighted", func(t *testing.T) {
+		q := querier{
+			results: []db.DocumentFTSSearchResult{
+				{
+					Path:    "/apache",
+					Title:   db.HighlightStart + "Apache" + db.HighlightEnd,
+					Snippet: "An attack " + db.HighlightStart + "helicopter" + db.HighlightEnd + " <made> by Boeing…",
+				},
+			},
+		}
+		w := get(t, q, "/search?q=apache+helicopter")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		body := w.Body.String()
+		for _, expected := range []string{
+			`<a href="/apache"><mark>Apache</mark></a>`,
+			"An attack <mark>helicopter</mark> &lt;made&gt; by Boeing…",
+		} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("expected %q in body:\n%s", expected, body)
+			}
+		}
+		if strings.ContainsAny(body, db.HighlightStart+db.HighlightEnd) {
+			t.Error("expected the highlight markers to be replaced")
+		}
+	})
+	t.Run("query errors return a 500", func(t *testing.T) {
+		w := get(t, querier{err: errors.New("database unavailable")}, "/search?q=apache")
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", w.Code)
+		}
+		if strings.Contains(w.Body.String(), "database unavailable") {
+			t.Error("expected the error not to be returned to the client")
+		}
+	})
+}
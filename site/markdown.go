@@ -88,7 +88,9 @@ func (p *Markdown) Text() (s string, err error) {
 }
 
 func (p *Markdown) TOC() (items []MenuItem) {
-	return items
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.toc
 }
 
 func (p *Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -134,6 +134,18 @@ func (s Site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler.ServeHTTP(w, r)
 }
 
+// HasChildren returns true if there is content below the URL, e.g. /aircraft/apache is below
+// /aircraft.
+func (s Site) HasChildren(url string) bool {
+	prefix := strings.TrimSuffix(url, "/") + "/"
+	for k := range s.content {
+		if k != url && strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 type MenuItem struct {
 	URL      string
 	Title    string
@@ -72,3 +72,45 @@ func TestMenu(t *testing.T) {
 		t.Fatalf("unexpected menu (-want +got):\n%s", diff)
 	}
 }
+
+func TestHasChildren(t *testing.T) {
+	dirFS := make(fstest.MapFS)
+	dirFS["index.md"] = &fstest.MapFile{
+		Data: []byte("/"),
+	}
+	dirFS["aircraft/index.md"] = &fstest.MapFile{
+		Data: []byte("/aircraft"),
+	}
+	dirFS["aircraft/apache.md"] = &fstest.MapFile{
+		Data: []byte("/aircraft/apache"),
+	}
+	dirFS["aircraft-carriers.md"] = &fstest.MapFile{
+		Data: []byte("/aircraft-carriers"),
+	}
+	s, err := site.New(site.SiteArgs{
+		Dir: dirFS,
+		ContentHandlers: []site.DirEntryHandler{
+			site.NewMarkdownDirEntryHandler(func(site *site.Site, page site.Metadata, toc []site.MenuItem, outputHTML string, err error) http.Handler {
+				return nil
+			}),
+			site.NewDirectoryDirEntryHandler(func(s *site.Site, dir site.Metadata, children []site.Metadata) http.Handler {
+				return nil
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]bool{
+		"/":                  true,
+		"/aircraft":          true,
+		"/aircraft/apache":   false,
+		"/aircraft-carriers": false,
+	}
+	for url, want := range expected {
+		if got := s.HasChildren(url); got != want {
+			t.Errorf("%s: expected %v, got %v", url, want, got)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package splitter
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// Options control the size of the chunks created by Markdown.
+type Options struct {
+	// MaxSize is the maximum size of a chunk, measured by Size. Tables, code blocks and
+	// long paragraphs that are larger than MaxSize are split.
+	MaxSize int
+	// Overlap is the amount of text from the end of the previous chunk in the same
+	// section that is repeated at the start of the next chunk.
+	Overlap int
+	// Size measures text. Defaults to the number of characters, use tokens.Estimate
+	// to measure approximate tokens.
+	Size func(s string) int
+	// SizeUnit names the unit that Size measures, e.g. characters or tokens.
+	SizeUnit string
+}
+
+// DefaultOptions returns chunks of up to 1000 characters, with 100 characters of overlap.
+func DefaultOptions() Options {
+	return Options{
+		MaxSize:  1000,
+		Overlap:  100,
+		Size:     utf8.RuneCountInString,
+		SizeUnit: "characters",
+	}
+}
+
+// Version of the Markdown splitter. Change it when the way that documents are split
+// changes, so that documents are split again when they're next indexed.
+const Version = "markdown-1"
+
+// Version identifies the splitter and its options. If it changes, documents that were
+// split with the previous version need to be split again.
+func (o Options) Version() string {
+	return fmt.Sprintf("%s;max=%d;overlap=%d;unit=%s", Version, o.MaxSize, o.Overlap, o.SizeUnit)
+}
+
+// HeadingSeparator separates the headings in a Chunk's heading breadcrumb.
+const HeadingSeparator = " > "
+
+// Chunk is a section of a Markdown document.
+type Chunk struct {
+	// Heading is the breadcrumb of headings that the chunk is within, e.g. "Install > Linux".
+	Heading string
+	Text    string
+}
+
+// Markdown splits a parsed Markdown document into chunks. Paragraphs are grouped
+// by the heading that they're under, up to the maximum size, and lists, tables and
+// code blocks are kept together where possible.
+func Markdown(src []byte, doc ast.Node, opts Options) (chunks []Chunk) {
+	if opts.Size == nil {
+		opts.Size = utf8.RuneCountInString
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultOptions().MaxSize
+	}
+	if opts.Overlap >= opts.MaxSize {
+		opts.Overlap = opts.MaxSize / 2
+	}
+	b := &builder{opts: opts}
+	var headings []string
+	var levels []int
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		if h, isHeading := n.(*ast.Heading); isHeading {
+			b.flush(false)
+			for len(levels) > 0 && levels[len(levels)-1] >= h.Level {
+				levels = levels[:len(levels)-1]
+				headings = headings[:len(headings)-1]
+			}
+			levels = append(levels, h.Level)
+			headings = append(headings, inlineText(src, h))
+			b.heading = strings.Join(headings, HeadingSeparator)
+			continue
+		}
+		if table, isTable := n.(*east.Table); isTable {
+			for _, part := range splitTable(tableRows(src, table), opts) {
+				b.add(part)
+			}
+			continue
+		}
+		text := blockText(src, n)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		for _, part := range splitText(text, opts) {
+			b.add(part)
+		}
+	}
+	b.flush(false)
+	return b.chunks
+}
+
+// builder packs blocks of text into chunks.
+type builder struct {
+	opts    Options
+	heading string
+	chunks  []Chunk
+	// parts of the current chunk.
+	parts []string
+	// overlap is true if the only part is overlap from the previous chunk.
+	overlap bool
+}
+
+const blockSeparator = "\n\n"
+
+func (b *builder) add(part string) {
+	if len(b.parts) > 0 && b.opts.Size(b.text()+blockSeparator+part) > b.opts.MaxSize {
+		if b.overlap {
+			b.parts = nil
+		} else {
+			b.flush(true)
+			if len(b.parts) > 0 && b.opts.Size(b.text()+blockSeparator+part) > b.opts.MaxSize {
+				b.parts = nil
+			}
+		}
+	}
+	b.parts = append(b.parts, part)
+	b.overlap = false
+}
+
+func (b *builder) text() string {
+	return strings.Join(b.parts, blockSeparator)
+}
+
+// flush completes the current chunk, and optionally starts the next chunk with the end
+// of its text.
+func (b *builder) flush(keepOverlap bool) {
+	if len(b.parts) == 0 || b.overlap {
+		b.parts, b.overlap = nil, false
+		return
+	}
+	text := b.text()
+	b.chunks = append(b.chunks, Chunk{Heading: b.heading, Text: text})
+	b.parts = nil
+	if !keepOverlap || b.opts.Overlap <= 0 {
+		return
+	}
+	if tail := tail(text, b.opts); tail != "" {
+		b.parts, b.overlap = []string{tail}, true
+	}
+}
+
+// tail returns the longest run of whole words from the end of the text that fits within the overlap.
+func tail(text string, opts Options) string {
+	words := strings.Fields(text)
+	start := len(words)
+	for start > 0 && opts.Size(strings.Join(words[start-1:], " ")) <= opts.Overlap {
+		start--
+	}
+	return strings.Join(words[start:], " ")
+}
+
+// splitText splits text that is larger than the maximum size on line boundaries,
+// or word boundaries if a line is too long.
+func splitText(text string, opts Options) (parts []string) {
+	if opts.Size(text) <= opts.MaxSize {
+		return []string{text}
+	}
+	var current []string
+	for _, line := range strings.Split(text, "\n") {
+		if opts.Size(line) > opts.MaxSize {
+			if len(current) > 0 {
+				parts = append(parts, strings.Join(current, "\n"))
+				current = nil
+			}
+			parts = append(parts, splitWords(line, opts)...)
+			continue
+		}
+		if len(current) > 0 && opts.Size(strings.Join(append(current, line), "\n")) > opts.MaxSize {
+			parts = append(parts, strings.Join(current, "\n"))
+			current = nil
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		parts = append(parts, strings.Join(current, "\n"))
+	}
+	return parts
+}
+
+func splitWords(line string, opts Options) (parts []string) {
+	var current []string
+	for _, word := range strings.Fields(line) {
+		if len(current) > 0 && opts.Size(strings.Join(append(current, word), " ")) > opts.MaxSize {
+			parts = append(parts, strings.Join(current, " "))
+			current = nil
+		}
+		current = append(current, word)
+	}
+	if len(current) > 0 {
+		parts = append(parts, strings.Join(current, " "))
+	}
+	return parts
+}
+
+// splitTable returns the table as a single part if it fits, otherwise the rows are
+// split into parts that each start with the header row.
+func splitTable(rows []string, opts Options) (parts []string) {
+	if len(rows) == 0 {
+		return nil
+	}
+	table := strings.Join(rows, "\n")
+	if opts.Size(table) <= opts.MaxSize || len(rows) <= 2 {
+		return []string{table}
+	}
+	header := rows[:2]
+	current := append([]string{}, header...)
+	for _, row := range rows[2:] {
+		if len(current) > len(header) && opts.Size(strings.Join(append(current, row), "\n")) > opts.MaxSize {
+			parts = append(parts, strings.Join(current, "\n"))
+			current = append([]string{}, header...)
+		}
+		current = append(current, row)
+	}
+	return append(parts, strings.Join(current, "\n"))
+}
+
+// tableRows renders the table as Markdown, including the delimiter row after the header.
+func tableRows(src []byte, table *east.Table) (rows []string) {
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, inlineText(src, cell))
+		}
+		rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+		if _, isHeader := row.(*east.TableHeader); isHeader {
+			rows = append(rows, "|"+strings.Repeat(" --- |", len(cells)))
+		}
+	}
+	return rows
+}
+
+// blockText returns the text of a block node.
+func blockText(src []byte, n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		return inlineText(src, n)
+	case *ast.List:
+		return listText(src, n, "")
+	case *ast.FencedCodeBlock:
+		return "```" + string(n.Language(src)) + "\n" + linesText(src, n) + "```"
+	case *ast.CodeBlock:
+		return "```\n" + linesText(src, n) + "```"
+	case *ast.Blockquote:
+		var paragraphs []string
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			paragraphs = append(paragraphs, blockText(src, c))
+		}
+		return strings.Join(paragraphs, blockSeparator)
+	case *ast.ThematicBreak, *ast.HTMLBlock:
+		return ""
+	}
+	if n.Type() == ast.TypeBlock && n.FirstChild() == nil {
+		return linesText(src, n)
+	}
+	var paragraphs []string
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		paragraphs = append(paragraphs, blockText(src, c))
+	}
+	return strings.Join(paragraphs, blockSeparator)
+}
+
+// listText renders each list item on its own line, with nested lists indented.
+func listText(src []byte, list *ast.List, indent string) string {
+	var lines []string
+	index := list.Start
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "- "
+		if list.IsOrdered() {
+			marker = fmt.Sprintf("%d. ", index)
+			index++
+		}
+		var text []string
+		var nested []string
+		for c := item.FirstChild(); c != nil; c = c.NextSibling() {
+			if l, isList := c.(*ast.List); isList {
+				nested = append(nested, listText(src, l, indent+"  "))
+				continue
+			}
+			text = append(text, blockText(src, c))
+		}
+		lines = append(lines, indent+marker+strings.Join(text, " "))
+		lines = append(lines, nested...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func linesText(src []byte, n ast.Node) string {
+	var sb strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		sb.Write(segment.Value(src))
+	}
+	return sb.String()
+}
+
+// inlineText returns the text content of the node's inline children.
+func inlineText(src []byte, n ast.Node) string {
+	var sb strings.Builder
+	writeInlineText(&sb, src, n)
+	return strings.TrimSpace(html.UnescapeString(sb.String()))
+}
+
+func writeInlineText(sb *strings.Builder, src []byte, n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			sb.Write(c.Segment.Value(src))
+			if c.HardLineBreak() {
+				sb.WriteString("\n")
+			} else if c.SoftLineBreak() {
+				sb.WriteString(" ")
+			}
+		case *ast.String:
+			sb.Write(c.Value)
+		case *ast.AutoLink:
+			sb.Write(c.Label(src))
+		case *ast.RawHTML:
+			continue
+		default:
+			writeInlineText(sb, src, c)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package splitter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/a-h/ragmark/splitter"
+	"github.com/google/go-cmp/cmp"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+func split(md string, opts splitter.Options) []splitter.Chunk {
+	src := []byte(md)
+	doc := goldmark.New(goldmark.WithExtensions(extension.Table)).Parser().Parse(text.NewReader(src))
+	return splitter.Markdown(src, doc, opts)
+}
+
+func TestMarkdown(t *testing.T) {
+	t.Run("paragraphs are grouped under their heading breadcrumb", func(t *testing.T) {
+		md := `Introduction.
+
+# Install
+
+Download the binary.
+
+## Linux
+
+Use the *tarball*.
+Extract it.
+
+## macOS
+
+Use Homebrew &amp; friends.
+
+# Usage
+
+Run it.
+`
+		expected := []splitter.Chunk{
+			{Heading: "", Text: "Introduction."},
+			{Heading: "Install", Text: "Download the binary."},
+			{Heading: "Install > Linux", Text: "Use the tarball. Extract it."},
+			{Heading: "Install > macOS", Text: "Use Homebrew & friends."},
+			{Heading: "Usage", Text: "Run it."},
+		}
+		if diff := cmp.Diff(expected, split(md, splitter.DefaultOptions())); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("tables and lists are kept intact", func(t *testing.T) {
+		md := `# Parts
+
+| Part | Stock |
+| ---- | ----- |
+| XR-200 | 4 |
+| XR-300 | 0 |
+
+1. First
+2. Second
+   - Nested
+`
+		expected := []splitter.Chunk{
+			{Heading: "Parts", Text: "| Part | Stock |\n| --- | --- |\n| XR-200 | 4 |\n| XR-300 | 0 |\n\n1. First\n2. Second\n  - Nested"},
+		}
+		if diff := cmp.Diff(expected, split(md, splitter.DefaultOptions())); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("chunks are limited to the maximum size, and overlap", func(t *testing.T) {
+		md := "# Words\n\none two three.\n\nfour five six.\n\nseven eight nine.\n"
+		opts := splitter.Options{MaxSize: 32, Overlap: 10}
+		expected := []splitter.Chunk{
+			{Heading: "Words", Text: "one two three.\n\nfour five six."},
+			{Heading: "Words", Text: "five six.\n\nseven eight nine."},
+		}
+		if diff := cmp.Diff(expected, split(md, opts)); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("overlap does not cross headings", func(t *testing.T) {
+		md := "# A\n\none two three.\n\n# B\n\nfour five six.\n"
+		opts := splitter.Options{MaxSize: 20, Overlap: 10}
+		expected := []splitter.Chunk{
+			{Heading: "A", Text: "one two three."},
+			{Heading: "B", Text: "four five six."},
+		}
+		if diff := cmp.Diff(expected, split(md, opts)); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("paragraphs larger than the maximum size are split on words", func(t *testing.T) {
+		md := "one two three four five six seven eight nine ten\n"
+		opts := splitter.Options{MaxSize: 20, Size: func(s string) int { return len(strings.Fields(s)) * 4 }}
+		expected := []splitter.Chunk{
+			{Text: "one two three four five"},
+			{Text: "six seven eight nine ten"},
+		}
+		if diff := cmp.Diff(expected, split(md, opts)); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("tables larger than the maximum size repeat the header row", func(t *testing.T) {
+		md := "| Part | Stock |\n| --- | --- |\n| XR-200 | 4 |\n| XR-300 | 0 |\n"
+		opts := splitter.Options{MaxSize: 45}
+		expected := []splitter.Chunk{
+			{Text: "| Part | Stock |\n| --- | --- |\n| XR-200 | 4 |"},
+			{Text: "| Part | Stock |\n| --- | --- |\n| XR-300 | 0 |"},
+		}
+		if diff := cmp.Diff(expected, split(md, opts)); diff != "" {
+			t.Errorf("unexpected chunks (-want +got):\n%s", diff)
+		}
+	})
+}
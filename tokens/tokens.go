@@ -0,0 +1,17 @@
+// Package tokens estimates the number of tokens in text, without loading a model's tokenizer.
+package tokens
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Estimate returns the approximate number of tokens in s.
+//
+// English text averages around 4 characters, or 0.75 words, per token, so the larger
+// of the two estimates is used, to avoid underestimating text with many short words.
+func Estimate(s string) int {
+	byChars := (utf8.RuneCountInString(s) + 3) / 4
+	byWords := (len(strings.Fields(s))*4 + 2) / 3
+	return max(byChars, byWords)
+}
@@ -0,0 +1,27 @@
+package tokens_test
+
+import (
+	"testing"
+
+	"github.com/a-h/ragmark/tokens"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected int
+	}{
+		{name: "empty text has no tokens", input: "", expected: 0},
+		{name: "characters are counted, not bytes", input: "héllo wörld", expected: 3},
+		{name: "long words are estimated by characters", input: "internationalisation", expected: 5},
+		{name: "short words are estimated by words", input: "a b c d e f", expected: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tokens.Estimate(tt.input); actual != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, actual)
+			}
+		})
+	}
+}